@@ -2,7 +2,10 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"path/filepath"
+	"strings"
 
 	"github.com/asticode/go-astikit"
 	"github.com/asticode/go-astisub"
@@ -15,16 +18,19 @@ var (
 	desired1         = flag.Duration("d1", 0, "the first desired duration")
 	desired2         = flag.Duration("d2", 0, "the second desired duration")
 	fragmentDuration = flag.Duration("f", 0, "the fragment duration")
+	from             = flag.Duration("from", 0, "the trim start")
 	inputPath        = astikit.NewFlagStrings()
 	teletextPage     = flag.Int("p", 0, "the teletext page")
-	outputPath       = flag.String("o", "", "the output path")
+	outputPath       = astikit.NewFlagStrings()
 	syncDuration     = flag.Duration("s", 0, "the sync duration")
+	to               = flag.Duration("to", 0, "the trim end")
 )
 
 func main() {
 	// Init
 	cmd := astikit.FlagCmd()
 	flag.Var(&inputPath, "i", "the input paths")
+	flag.Var(&outputPath, "o", "the output paths")
 	flag.Parse()
 
 	// Validate input path
@@ -33,8 +39,8 @@ func main() {
 	}
 
 	// Validate output path
-	if len(*outputPath) <= 0 {
-		log.Fatal("Use -o to provide an output path")
+	if len(*outputPath.Slice) == 0 && cmd != "info" {
+		log.Fatal("Use -o to provide at least one output path")
 	}
 
 	// Open first input path
@@ -65,14 +71,10 @@ func main() {
 		sub.ApplyLinearCorrection(*actual1, *desired1, *actual2, *desired2)
 
 		// Write
-		if err = sub.Write(*outputPath); err != nil {
-			log.Fatalf("%s while writing to %s", err, *outputPath)
-		}
+		write(sub)
 	case "convert":
 		// Write
-		if err = sub.Write(*outputPath); err != nil {
-			log.Fatalf("%s while writing to %s", err, *outputPath)
-		}
+		write(sub)
 	case "fragment":
 		// Validate fragment duration
 		if *fragmentDuration <= 0 {
@@ -83,8 +85,24 @@ func main() {
 		sub.Fragment(*fragmentDuration)
 
 		// Write
-		if err = sub.Write(*outputPath); err != nil {
-			log.Fatalf("%s while writing to %s", err, *outputPath)
+		write(sub)
+	case "info":
+		// Print info
+		fmt.Printf("Format: %s\n", strings.TrimPrefix(filepath.Ext(strings.ToLower((*inputPath.Slice)[0])), "."))
+		fmt.Printf("Items: %d\n", len(sub.Items))
+		fmt.Printf("Duration: %s\n", sub.Duration())
+		fmt.Printf("Regions: %d\n", len(sub.Regions))
+		fmt.Printf("Styles: %d\n", len(sub.Styles))
+		if sub.Metadata != nil {
+			if sub.Metadata.Framerate > 0 {
+				fmt.Printf("Framerate: %d\n", sub.Metadata.Framerate)
+			}
+			if len(sub.Metadata.Language) > 0 {
+				fmt.Printf("Language: %s\n", sub.Metadata.Language)
+			}
+			if len(sub.Metadata.Title) > 0 {
+				fmt.Printf("Title: %s\n", sub.Metadata.Title)
+			}
 		}
 	case "merge":
 		// Validate second input path
@@ -102,17 +120,13 @@ func main() {
 		sub.Merge(sub2)
 
 		// Write
-		if err = sub.Write(*outputPath); err != nil {
-			log.Fatalf("%s while writing to %s", err, *outputPath)
-		}
+		write(sub)
 	case "optimize":
 		// Optimize
 		sub.Optimize()
 
 		// Write
-		if err = sub.Write(*outputPath); err != nil {
-			log.Fatalf("%s while writing to %s", err, *outputPath)
-		}
+		write(sub)
 	case "sync":
 		// Validate sync duration
 		if *syncDuration == 0 {
@@ -123,18 +137,37 @@ func main() {
 		sub.Add(*syncDuration)
 
 		// Write
-		if err = sub.Write(*outputPath); err != nil {
-			log.Fatalf("%s while writing to %s", err, *outputPath)
+		write(sub)
+	case "trim":
+		// Validate trim durations
+		if *from < 0 {
+			log.Fatal("Use -from to provide a positive trim start")
 		}
+		if *to > 0 && *to <= *from {
+			log.Fatal("Use -to to provide a trim end bigger than the trim start")
+		}
+
+		// Trim
+		sub.Trim(*from, *to)
+
+		// Write
+		write(sub)
 	case "unfragment":
 		// Unfragment
 		sub.Unfragment()
 
 		// Write
-		if err = sub.Write(*outputPath); err != nil {
-			log.Fatalf("%s while writing to %s", err, *outputPath)
-		}
+		write(sub)
 	default:
 		log.Fatalf("Invalid subcommand %s", cmd)
 	}
 }
+
+func write(sub *astisub.Subtitles) {
+	// Loop through output paths
+	for _, p := range *outputPath.Slice {
+		if err := sub.Write(p); err != nil {
+			log.Fatalf("%s while writing to %s", err, p)
+		}
+	}
+}
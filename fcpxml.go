@@ -0,0 +1,268 @@
+package astisub
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// https://developer.apple.com/documentation/professional_video_applications/fcpxml_reference
+
+// FCPXML defaults
+const (
+	fcpxmlDefaultFramerate = 25
+	fcpxmlDefaultHeight    = 1080
+	fcpxmlDefaultLanguage  = "en"
+	fcpxmlDefaultName      = "astisub"
+	fcpxmlDefaultWidth     = 1920
+	fcpxmlVersion          = "1.9"
+)
+
+// FCPXMLOptions represents FCPXML write options
+type FCPXMLOptions struct {
+	EventName   string // Default is "astisub"
+	Height      int    // Default is 1080
+	Language    string // Used in the captions role. Default is "en".
+	NTSC        bool   // Metadata.Framerate is the nominal one of an NTSC framerate, e.g. 30 for 29.97
+	ProjectName string // Default is "astisub"
+	Width       int    // Default is 1920
+}
+
+// FCPXML represents an output FCPXML document
+type FCPXML struct {
+	XMLName   xml.Name        `xml:"fcpxml"`
+	Version   string          `xml:"version,attr"`
+	Resources FCPXMLResources `xml:"resources"` // Must be before library
+	Library   FCPXMLLibrary   `xml:"library"`
+}
+
+// FCPXMLResources represents FCPXML resources
+type FCPXMLResources struct {
+	Formats []FCPXMLFormat `xml:"format"`
+}
+
+// FCPXMLFormat represents an FCPXML format
+type FCPXMLFormat struct {
+	FrameDuration FCPXMLTime `xml:"frameDuration,attr"`
+	Height        int        `xml:"height,attr"`
+	ID            string     `xml:"id,attr"`
+	Width         int        `xml:"width,attr"`
+}
+
+// FCPXMLLibrary represents an FCPXML library
+type FCPXMLLibrary struct {
+	Event FCPXMLEvent `xml:"event"`
+}
+
+// FCPXMLEvent represents an FCPXML event
+type FCPXMLEvent struct {
+	Name    string        `xml:"name,attr"`
+	Project FCPXMLProject `xml:"project"`
+}
+
+// FCPXMLProject represents an FCPXML project
+type FCPXMLProject struct {
+	Name     string         `xml:"name,attr"`
+	Sequence FCPXMLSequence `xml:"sequence"`
+}
+
+// FCPXMLSequence represents an FCPXML sequence
+type FCPXMLSequence struct {
+	Duration FCPXMLTime  `xml:"duration,attr"`
+	Format   string      `xml:"format,attr"`
+	Spine    FCPXMLSpine `xml:"spine"`
+	TCFormat string      `xml:"tcFormat,attr"`
+	TCStart  FCPXMLTime  `xml:"tcStart,attr"`
+}
+
+// FCPXMLSpine represents an FCPXML spine
+type FCPXMLSpine struct {
+	Gap FCPXMLGap `xml:"gap"`
+}
+
+// FCPXMLGap represents an FCPXML gap captions are anchored to
+type FCPXMLGap struct {
+	Captions []FCPXMLCaption `xml:"caption"`
+	Duration FCPXMLTime      `xml:"duration,attr"`
+	Name     string          `xml:"name,attr"`
+	Offset   FCPXMLTime      `xml:"offset,attr"`
+	Start    FCPXMLTime      `xml:"start,attr"`
+}
+
+// FCPXMLCaption represents an FCPXML caption
+type FCPXMLCaption struct {
+	Duration     FCPXMLTime         `xml:"duration,attr"`
+	Lane         int                `xml:"lane,attr"`
+	Name         string             `xml:"name,attr"`
+	Offset       FCPXMLTime         `xml:"offset,attr"`
+	Role         string             `xml:"role,attr"`
+	Start        FCPXMLTime         `xml:"start,attr"`
+	Text         FCPXMLText         `xml:"text"`
+	TextStyleDef FCPXMLTextStyleDef `xml:"text-style-def"`
+}
+
+// FCPXMLText represents an FCPXML caption text
+type FCPXMLText struct {
+	Placement string          `xml:"placement,attr,omitempty"`
+	TextStyle FCPXMLTextStyle `xml:"text-style"`
+}
+
+// FCPXMLTextStyle represents an FCPXML text style, either referencing a definition or defining it
+type FCPXMLTextStyle struct {
+	Ref  string `xml:"ref,attr,omitempty"`
+	Text string `xml:",chardata"`
+}
+
+// FCPXMLTextStyleDef represents an FCPXML text style definition
+type FCPXMLTextStyleDef struct {
+	ID        string          `xml:"id,attr"`
+	TextStyle FCPXMLTextStyle `xml:"text-style"`
+}
+
+// FCPXMLTime represents an FCPXML rational time expressed in seconds
+type FCPXMLTime struct {
+	Duration  time.Duration
+	Framerate int
+	NTSC      bool // Framerate being the nominal one, frames last 1001/1000 of their nominal duration
+}
+
+// frames returns the number of frames rounded to the closest one
+func (t FCPXMLTime) frames() int64 {
+	if t.NTSC {
+		return (int64(t.Duration)*int64(t.Framerate)*1000 + int64(time.Second)*1001/2) / (int64(time.Second) * 1001)
+	}
+	return (int64(t.Duration)*int64(t.Framerate) + int64(time.Second)/2) / int64(time.Second)
+}
+
+// MarshalText implements the TextMarshaler interface
+// Times are rounded to the closest frame
+func (t FCPXMLTime) MarshalText() ([]byte, error) {
+	n, d := t.frames(), int64(t.Framerate)
+	if t.NTSC {
+		n, d = n*1001, d*1000
+	}
+	if n%d == 0 {
+		return []byte(strconv.FormatInt(n/d, 10) + "s"), nil
+	}
+	return []byte(strconv.FormatInt(n, 10) + "/" + strconv.FormatInt(d, 10) + "s"), nil
+}
+
+// WriteToFCPXML writes subtitles as Final Cut Pro captions in .fcpxml format, using Metadata.Framerate (default
+// is 25) and FCPXMLOptions.NTSC. Only texts and timings are written.
+func (s Subtitles) WriteToFCPXML(o io.Writer, opts FCPXMLOptions) (err error) {
+	// Do not write anything if no subtitles
+	if len(s.Items) == 0 {
+		return ErrNoSubtitlesToWrite
+	}
+
+	// Default options
+	if opts.EventName == "" {
+		opts.EventName = fcpxmlDefaultName
+	}
+	if opts.Height <= 0 {
+		opts.Height = fcpxmlDefaultHeight
+	}
+	if opts.Language == "" {
+		opts.Language = fcpxmlDefaultLanguage
+	}
+	if opts.ProjectName == "" {
+		opts.ProjectName = fcpxmlDefaultName
+	}
+	if opts.Width <= 0 {
+		opts.Width = fcpxmlDefaultWidth
+	}
+
+	// Get framerate
+	var framerate = fcpxmlDefaultFramerate
+	if s.Metadata != nil && s.Metadata.Framerate > 0 {
+		framerate = s.Metadata.Framerate
+	}
+	newTime := func(d time.Duration) FCPXMLTime {
+		return FCPXMLTime{Duration: d, Framerate: framerate, NTSC: opts.NTSC}
+	}
+
+	// Durations between 2 times are computed from their rounded frames so that they add up with offsets
+	newDuration := func(start, end time.Duration) FCPXMLTime {
+		n := newTime(end).frames() - newTime(start).frames()
+		if opts.NTSC {
+			return newTime(time.Duration(n * 1001 * int64(time.Second) / int64(framerate*1000)))
+		}
+		return newTime(time.Duration(n * int64(time.Second) / int64(framerate)))
+	}
+
+	// Items may not be ordered, therefore Duration can't be used
+	var d time.Duration
+	for _, i := range s.Items {
+		if i.EndAt > d {
+			d = i.EndAt
+		}
+	}
+
+	// Init FCPXML
+	const formatID = "r1"
+	var f = FCPXML{
+		Library: FCPXMLLibrary{Event: FCPXMLEvent{
+			Name: opts.EventName,
+			Project: FCPXMLProject{
+				Name: opts.ProjectName,
+				Sequence: FCPXMLSequence{
+					Duration: newTime(d),
+					Format:   formatID,
+					Spine: FCPXMLSpine{Gap: FCPXMLGap{
+						Duration: newTime(d),
+						Name:     "Gap",
+						Offset:   newTime(0),
+						Start:    newTime(0),
+					}},
+					TCFormat: "NDF",
+					TCStart:  newTime(0),
+				},
+			},
+		}},
+		Resources: FCPXMLResources{Formats: []FCPXMLFormat{{
+			FrameDuration: newTime(time.Second / time.Duration(framerate)),
+			Height:        opts.Height,
+			ID:            formatID,
+			Width:         opts.Width,
+		}}},
+		Version: fcpxmlVersion,
+	}
+
+	// Loop through items
+	for idx, item := range s.Items {
+		// Captions are anchored to the gap which starts at 0, therefore their offset is their start time
+		text := item.StringSep("\n")
+		textStyleID := "ts" + strconv.Itoa(idx+1)
+		f.Library.Event.Project.Sequence.Spine.Gap.Captions = append(f.Library.Event.Project.Sequence.Spine.Gap.Captions, FCPXMLCaption{
+			Duration: newDuration(item.StartAt, item.EndAt),
+			Lane:     1,
+			Name:     strings.ReplaceAll(text, "\n", " "),
+			Offset:   newTime(item.StartAt),
+			Role:     "iTT?captionFormat=ITT." + opts.Language,
+			Start:    newTime(0),
+			Text: FCPXMLText{
+				Placement: "bottom",
+				TextStyle: FCPXMLTextStyle{Ref: textStyleID, Text: text},
+			},
+			TextStyleDef: FCPXMLTextStyleDef{ID: textStyleID},
+		})
+	}
+
+	// Write header
+	if _, err = io.WriteString(o, xml.Header+"<!DOCTYPE fcpxml>\n"); err != nil {
+		err = fmt.Errorf("astisub: writing header failed: %w", err)
+		return
+	}
+
+	// Marshal XML
+	var e = xml.NewEncoder(o)
+	e.Indent("", "    ")
+	if err = e.Encode(f); err != nil {
+		err = fmt.Errorf("astisub: xml encoding failed: %w", err)
+		return
+	}
+	return
+}
@@ -0,0 +1,50 @@
+package astisub_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astisub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteToFCPXML(t *testing.T) {
+	// No subtitles to write
+	w := &bytes.Buffer{}
+	err := astisub.Subtitles{}.WriteToFCPXML(w, astisub.FCPXMLOptions{})
+	assert.EqualError(t, err, astisub.ErrNoSubtitlesToWrite.Error())
+
+	// Write
+	s := mockSubtitles()
+	s.Items[1].StartAt += 40 * time.Millisecond
+	s.Metadata = &astisub.Metadata{Framerate: 25}
+	err = s.WriteToFCPXML(w, astisub.FCPXMLOptions{Language: "fr"})
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), `<format frameDuration="1/25s" height="1080" id="r1" width="1920"></format>`)
+	assert.Contains(t, w.String(), `<sequence duration="7s" format="r1" tcFormat="NDF" tcStart="0s">`)
+	assert.Contains(t, w.String(), `<caption duration="2s" lane="1" name="subtitle-1" offset="1s" role="iTT?captionFormat=ITT.fr" start="0s">`)
+	assert.Contains(t, w.String(), `<text-style ref="ts1">subtitle-1</text-style>`)
+	assert.Contains(t, w.String(), `<caption duration="99/25s" lane="1" name="subtitle-2" offset="76/25s" role="iTT?captionFormat=ITT.fr" start="0s">`)
+	assert.Contains(t, w.String(), `<text-style-def id="ts2">`)
+
+	// Durations add up with rounded offsets
+	s = &astisub.Subtitles{
+		Items:    []*astisub.Item{{EndAt: 3031 * time.Millisecond, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "subtitle-1"}}}}, StartAt: 1019 * time.Millisecond}},
+		Metadata: &astisub.Metadata{Framerate: 25},
+	}
+	w.Reset()
+	err = s.WriteToFCPXML(w, astisub.FCPXMLOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), `<caption duration="51/25s" lane="1" name="subtitle-1" offset="1s"`)
+
+	// NTSC
+	s = mockSubtitles()
+	s.Metadata = &astisub.Metadata{Framerate: 30}
+	w.Reset()
+	err = s.WriteToFCPXML(w, astisub.FCPXMLOptions{NTSC: true})
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), `<format frameDuration="1001/30000s" height="1080" id="r1" width="1920"></format>`)
+	assert.Contains(t, w.String(), `<caption duration="60060/30000s" lane="1" name="subtitle-1" offset="30030/30000s"`)
+}
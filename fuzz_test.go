@@ -0,0 +1,41 @@
+//go:build go1.18
+// +build go1.18
+
+package astisub_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/asticode/go-astisub"
+)
+
+func FuzzReadFromSRT(f *testing.F) {
+	for _, s := range []string{
+		"1\n00:00:01,000 --> 00:00:02,000\nHello\n",
+		"1\n-->\n",
+		"-->",
+		"1\n00:00:01,000 -->\n",
+		"\ufeff1\n00:00:01,000 --> 00:00:02,000 X1:0\n<i>a</i>\n\n2\n",
+	} {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		astisub.ReadFromSRT(bytes.NewReader(b))
+	})
+}
+
+func FuzzReadFromWebVTT(f *testing.F) {
+	for _, s := range []string{
+		"WEBVTT\n\n00:01.000 --> 00:02.000\nHello\n",
+		"WEBVTT\n\n-->\n",
+		"WEBVTT\n\n00:01.000 -->\n",
+		"WEBVTT\n\nREGION\nid:fred width:40%\n\nSTYLE\n::cue { color: red }\n\nNOTE comment\n\nid\n00:01.000 --> 00:02.000 region:fred align:left\n<v Bob><b>a</b></v>\n",
+		"WEBVTT\nX-TIMESTAMP-MAP=MPEGTS:900000,LOCAL:00:00:00.000\n",
+	} {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		astisub.ReadFromWebVTT(bytes.NewReader(b))
+	})
+}
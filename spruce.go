@@ -0,0 +1,141 @@
+package astisub
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Constants
+const (
+	spruceCommentPrefix      = "//"
+	spruceDefaultFramerate   = 25
+	spruceFieldSeparator     = ","
+	spruceHeaderCommandToken = "$"
+	spruceLineSeparator      = "|"
+	spruceTimecodeSeparator  = ":"
+)
+
+// parseDurationSpruce parses a Spruce STL duration such as 00:00:01:12
+func parseDurationSpruce(i string, framerate int) (time.Duration, error) {
+	return DurationFormat{FrameRate: framerate, Sep: spruceTimecodeSeparator, UseFrames: true}.Parse(i)
+}
+
+// formatDurationSpruce formats a Spruce STL duration
+func formatDurationSpruce(d time.Duration, framerate int) string {
+	return DurationFormat{FrameRate: framerate, Sep: spruceTimecodeSeparator, UseFrames: true}.Format(d)
+}
+
+// SpruceSTLOptions represents Spruce STL parsing options
+type SpruceSTLOptions struct {
+	// MaxItems - if > 0, reading fails with ErrMaxItemsExceeded as soon as more items are parsed
+	MaxItems int
+}
+
+// ReadFromSpruceSTL parses a text Spruce .stl content
+func ReadFromSpruceSTL(i io.Reader) (o *Subtitles, err error) {
+	return ReadFromSpruceSTLWithOptions(i, SpruceSTLOptions{})
+}
+
+// ReadFromSpruceSTLWithOptions parses a text Spruce .stl content
+func ReadFromSpruceSTLWithOptions(i io.Reader, opts SpruceSTLOptions) (o *Subtitles, err error) {
+	// Init
+	o = NewSubtitles()
+	o.Metadata = &Metadata{Framerate: spruceDefaultFramerate}
+	var scanner = newScanner(i)
+	var lineNum int
+
+	// Scan
+	for scanner.Scan() {
+		// Fetch line
+		line := strings.TrimSpace(scanner.Text())
+		lineNum++
+		if lineNum == 1 {
+			line = strings.TrimPrefix(line, string(BytesBOM))
+		}
+		if !utf8.ValidString(line) {
+			err = fmt.Errorf("astisub: line %d is not valid utf-8", lineNum)
+			return
+		}
+
+		// Skip empty lines, comments and header commands
+		if len(line) == 0 || strings.HasPrefix(line, spruceCommentPrefix) || strings.HasPrefix(line, spruceHeaderCommandToken) {
+			continue
+		}
+
+		// Split line
+		split := strings.SplitN(line, spruceFieldSeparator, 3)
+		if len(split) < 3 {
+			err = fmt.Errorf("astisub: line %d: invalid spruce line %s", lineNum, line)
+			return
+		}
+
+		// Parse time boundaries
+		var s = &Item{}
+		if s.StartAt, err = parseDurationSpruce(split[0], o.Metadata.Framerate); err != nil {
+			err = fmt.Errorf("astisub: line %d: parsing spruce duration %s failed: %w", lineNum, split[0], err)
+			return
+		}
+		if s.EndAt, err = parseDurationSpruce(split[1], o.Metadata.Framerate); err != nil {
+			err = fmt.Errorf("astisub: line %d: parsing spruce duration %s failed: %w", lineNum, split[1], err)
+			return
+		}
+
+		// Add lines
+		for _, t := range strings.Split(strings.TrimSpace(split[2]), spruceLineSeparator) {
+			s.Lines = append(s.Lines, Line{Items: []LineItem{{Text: strings.TrimSpace(t)}}})
+		}
+
+		// Append item
+		o.Items = append(o.Items, s)
+
+		// Check limit
+		if opts.MaxItems > 0 && len(o.Items) > opts.MaxItems {
+			err = ErrMaxItemsExceeded
+			return
+		}
+	}
+	return
+}
+
+// WriteToSpruceSTL writes subtitles in text Spruce .stl format
+func (s Subtitles) WriteToSpruceSTL(o io.Writer) (err error) {
+	// Do not write anything if no subtitles
+	if len(s.Items) == 0 {
+		err = ErrNoSubtitlesToWrite
+		return
+	}
+
+	// Get framerate
+	var framerate = spruceDefaultFramerate
+	if s.Metadata != nil && s.Metadata.Framerate > 0 {
+		framerate = s.Metadata.Framerate
+	}
+
+	// Loop through items
+	var c []byte
+	for _, item := range s.Items {
+		// Add time boundaries
+		c = append(c, []byte(formatDurationSpruce(item.StartAt, framerate))...)
+		c = append(c, []byte(" "+spruceFieldSeparator+" ")...)
+		c = append(c, []byte(formatDurationSpruce(item.EndAt, framerate))...)
+		c = append(c, []byte(" "+spruceFieldSeparator+" ")...)
+
+		// Add lines
+		var lines []string
+		for _, l := range item.Lines {
+			lines = append(lines, l.String())
+		}
+		c = append(c, []byte(strings.Join(lines, spruceLineSeparator))...)
+		c = append(c, bytesLineSeparator...)
+	}
+
+	// Write
+	if _, err = o.Write(c); err != nil {
+		err = fmt.Errorf("astisub: writing failed: %w", err)
+		return
+	}
+	return
+}
@@ -0,0 +1,29 @@
+package astisub_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/asticode/go-astisub"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpruceSTL(t *testing.T) {
+	// Open
+	s, err := astisub.OpenFile("./testdata/example-in-spruce.stl")
+	assert.NoError(t, err)
+	assertSubtitleItems(t, s)
+
+	// No subtitles to write
+	w := &bytes.Buffer{}
+	err = astisub.Subtitles{}.WriteToSpruceSTL(w)
+	assert.EqualError(t, err, astisub.ErrNoSubtitlesToWrite.Error())
+
+	// Write
+	c, err := os.ReadFile("./testdata/example-out-spruce.stl")
+	assert.NoError(t, err)
+	err = s.WriteToSpruceSTL(w)
+	assert.NoError(t, err)
+	assert.Equal(t, string(c), w.String())
+}
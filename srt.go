@@ -1,13 +1,18 @@
 package astisub
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"math"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 	"unicode/utf8"
 
+	"github.com/asticode/go-astikit"
 	"golang.org/x/net/html"
 )
 
@@ -19,12 +24,40 @@ const (
 // Vars
 var (
 	bytesSRTTimeBoundariesSeparator = []byte(" "+srtTimeBoundariesSeparator+" ")
+	srtRegexpMicroDVDCode           = regexp.MustCompile(`^\{([yYcC]):([^\}]*)\}`)
+	srtRegexpPosition               = regexp.MustCompile(`\{\\an([1-9])\}`)
+	srtRegexpTimeBoundaries         = regexp.MustCompile(`^\d+(:\d+){1,2}([,.]\d+)?\s*` + srtTimeBoundariesSeparator)
 )
 
+// SRTOptions represents SRT parsing and writing options
+type SRTOptions struct {
+	// CoalesceIdenticalTimings - merge consecutive items sharing the same time boundaries, e.g. one per language,
+	// into a single multi-line item
+	CoalesceIdenticalTimings bool
+	// KeepRawText - store the original unparsed text of each item in Item.Raw. Open uses Options.KeepRawText instead
+	KeepRawText bool
+	// MaxItems - if > 0, reading fails with ErrMaxItemsExceeded as soon as more items are parsed
+	MaxItems int
+	// MicroDVDInlineCodes - parse MicroDVD-style inline codes such as {y:i} or {c:$0000ff}
+	MicroDVDInlineCodes bool
+	// MillisecondSeparator - separator used when writing durations, either "," (default) or "."
+	MillisecondSeparator string
+	// PreserveBOM - only write a BOM if Metadata.SRTHadBOM is true, instead of always writing one
+	PreserveBOM bool
+	// SingleLine - join the lines of each item into a single line, using SingleLineSeparator or a space if empty
+	SingleLine          bool
+	SingleLineSeparator string
+	// WritePositions - write legacy "X1: X2: Y1: Y2:" coordinates computed from TTML or WebVTT positions.
+	// FrameWidth and FrameHeight are then mandatory
+	WritePositions bool
+	FrameHeight    int
+	FrameWidth     int
+}
+
 // parseDurationSRT parses an .srt duration
 func parseDurationSRT(i string) (d time.Duration, err error) {
 	for _, s := range []string{",", "."} {
-		if d, err = parseDuration(i, s, 3); err == nil {
+		if d, err = (DurationFormat{Digits: 3, Sep: s}).Parse(i); err == nil {
 			return
 		}
 	}
@@ -33,6 +66,16 @@ func parseDurationSRT(i string) (d time.Duration, err error) {
 
 // ReadFromSRT parses an .srt content
 func ReadFromSRT(i io.Reader) (o *Subtitles, err error) {
+	return ReadFromSRTWithOptions(i, SRTOptions{})
+}
+
+// ReadFromSRTWithOptions parses an .srt content
+func ReadFromSRTWithOptions(i io.Reader, opts SRTOptions) (o *Subtitles, err error) {
+	return ReadFromSRTContext(context.Background(), i, opts)
+}
+
+// ReadFromSRTContext parses an .srt content and returns early once the context is cancelled
+func ReadFromSRTContext(ctx context.Context, i io.Reader, opts SRTOptions) (o *Subtitles, err error) {
 	// Init
 	o = NewSubtitles()
 	var scanner = newScanner(i)
@@ -42,7 +85,14 @@ func ReadFromSRT(i io.Reader) (o *Subtitles, err error) {
 	var lineNum int
 	var s = &Item{}
 	var sa = &StyleAttributes{}
+	var raw []string
 	for scanner.Scan() {
+		// Check context
+		if err = ctx.Err(); err != nil {
+			err = fmt.Errorf("astisub: checking context failed: %w", err)
+			return
+		}
+
 		// Fetch line
 		line = strings.TrimSpace(scanner.Text())
 		lineNum++
@@ -52,12 +102,17 @@ func ReadFromSRT(i io.Reader) (o *Subtitles, err error) {
 		}
 
 		// Remove BOM header
-		if lineNum == 1 {
+		if lineNum == 1 && strings.HasPrefix(line, string(BytesBOM)) {
 			line = strings.TrimPrefix(line, string(BytesBOM))
+			if o.Metadata == nil {
+				o.Metadata = &Metadata{}
+			}
+			o.Metadata.SRTHadBOM = true
 		}
 
 		// Line contains time boundaries
-		if strings.Contains(line, srtTimeBoundariesSeparator) {
+		// Text may contain the separator as well, therefore the line must start with a timestamp
+		if srtRegexpTimeBoundaries.MatchString(line) {
 			// Reset style attributes
 			sa = &StyleAttributes{}
 
@@ -68,9 +123,18 @@ func ReadFromSRT(i io.Reader) (o *Subtitles, err error) {
 				index = s.Lines[len(s.Lines)-1].String()
 				if index != "" {
 					s.Lines = s.Lines[:len(s.Lines)-1]
+					if len(raw) > 0 {
+						raw = raw[:len(raw)-1]
+					}
 				}
 			}
 
+			// Store raw text
+			if opts.KeepRawText {
+				s.Raw = rawTextSRT(raw)
+			}
+			raw = []string{}
+
 			// Remove trailing empty lines
 			if len(s.Lines) > 0 {
 				for i := len(s.Lines) - 1; i >= 0; i-- {
@@ -106,6 +170,10 @@ func ReadFromSRT(i io.Reader) (o *Subtitles, err error) {
 			}
 			// We do this to eliminate extra stuff like positions which are not documented anywhere
 			s2 := strings.Fields(s1[1])
+			if len(s2) == 0 {
+				err = fmt.Errorf("astisub: line %d: time boundaries has no end time", lineNum)
+				return
+			}
 
 			// Parse time boundaries
 			if s.StartAt, err = parseDurationSRT(s1[0]); err != nil {
@@ -119,16 +187,136 @@ func ReadFromSRT(i io.Reader) (o *Subtitles, err error) {
 
 			// Append subtitle
 			o.Items = append(o.Items, s)
+
+			// Check limit
+			if opts.MaxItems > 0 && len(o.Items) > opts.MaxItems {
+				err = ErrMaxItemsExceeded
+				return
+			}
 		} else {
+			// Store raw line
+			raw = append(raw, line)
+
+			// Parse position which applies to the whole item
+			if m := srtRegexpPosition.FindStringSubmatch(line); m != nil {
+				if s.InlineStyle == nil {
+					s.InlineStyle = &StyleAttributes{}
+				}
+				s.InlineStyle.SRTPosition = m[1][0] - '0'
+				s.InlineStyle.propagateSRTAttributes()
+				line = strings.TrimSpace(srtRegexpPosition.ReplaceAllString(line, ""))
+			}
+
+			// Parse MicroDVD inline codes
+			var reset func()
+			if opts.MicroDVDInlineCodes {
+				line, reset = parseMicroDVDInlineCodesSRT(line, sa)
+			}
+
 			// Add text
 			if l := parseTextSrt(line, sa); len(l.Items) > 0 {
 				s.Lines = append(s.Lines, l)
 			}
+
+			// Reset line-scoped codes
+			if reset != nil {
+				reset()
+			}
+		}
+	}
+
+	// Store raw text of last item
+	if opts.KeepRawText {
+		s.Raw = rawTextSRT(raw)
+	}
+
+	// Coalesce items with identical timings
+	if opts.CoalesceIdenticalTimings && len(o.Items) > 1 {
+		items := []*Item{o.Items[0]}
+		for _, i := range o.Items[1:] {
+			if last := items[len(items)-1]; last.StartAt == i.StartAt && last.EndAt == i.EndAt {
+				last.Merge(i)
+				continue
+			}
+			items = append(items, i)
 		}
+		o.Items = items
 	}
 	return
 }
 
+// rawTextSRT joins raw lines without trailing empty lines
+func rawTextSRT(lines []string) string {
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseMicroDVDInlineCodesSRT strips the MicroDVD inline codes at the beginning of the line and updates the
+// style attributes accordingly. Lowercase codes only apply to the current line, therefore the returned func
+// must be called once the line has been parsed.
+// http://devel.aegisub.org/wiki/SubtitleFormats/MicroDVD
+func parseMicroDVDInlineCodesSRT(i string, sa *StyleAttributes) (o string, reset func()) {
+	// Extract codes
+	o = i
+	var itemCodes, lineCodes [][]string
+	for {
+		matches := srtRegexpMicroDVDCode.FindStringSubmatch(o)
+		if matches == nil {
+			break
+		}
+		o = strings.TrimSpace(o[len(matches[0]):])
+		if matches[1] == "c" || matches[1] == "y" {
+			lineCodes = append(lineCodes, matches)
+		} else {
+			itemCodes = append(itemCodes, matches)
+		}
+	}
+
+	// Uppercase codes apply to the whole item
+	for _, c := range itemCodes {
+		applyMicroDVDInlineCodeSRT(c[1], c[2], sa)
+	}
+
+	// Lowercase codes only apply to the current line
+	if len(lineCodes) > 0 {
+		previous := *sa
+		for _, c := range lineCodes {
+			applyMicroDVDInlineCodeSRT(c[1], c[2], sa)
+		}
+		reset = func() {
+			sa.SRTBold = previous.SRTBold
+			sa.SRTColor = previous.SRTColor
+			sa.SRTItalics = previous.SRTItalics
+			sa.SRTUnderline = previous.SRTUnderline
+		}
+	}
+	return
+}
+
+// applyMicroDVDInlineCodeSRT updates the style attributes based on a MicroDVD inline code
+func applyMicroDVDInlineCodeSRT(name, value string, sa *StyleAttributes) {
+	switch strings.ToLower(name) {
+	case "c":
+		// Color is in $BBGGRR format
+		if v := strings.TrimPrefix(strings.TrimSpace(value), "$"); len(v) == 6 {
+			sa.SRTColor = astikit.StrPtr("#" + strings.ToLower(v[4:6]+v[2:4]+v[0:2]))
+		}
+	case "y":
+		for _, v := range strings.Split(value, ",") {
+			switch strings.ToLower(strings.TrimSpace(v)) {
+			case "b":
+				sa.SRTBold = true
+			case "i":
+				sa.SRTItalics = true
+			case "u":
+				sa.SRTUnderline = true
+			}
+		}
+	}
+}
+
 // parseTextSrt parses the input line to fill the Line
 func parseTextSrt(i string, sa *StyleAttributes) (o Line) {
 	// special handling needed for empty line
@@ -208,12 +396,34 @@ func parseTextSrt(i string, sa *StyleAttributes) (o Line) {
 }
 
 // formatDurationSRT formats an .srt duration
-func formatDurationSRT(i time.Duration) string {
-	return formatDuration(i, ",", 3)
+func formatDurationSRT(i time.Duration, millisecondSep string) string {
+	return DurationFormat{Digits: 3, Sep: millisecondSep}.Format(i)
 }
 
 // WriteToSRT writes subtitles in .srt format
 func (s Subtitles) WriteToSRT(o io.Writer) (err error) {
+	return s.WriteToSRTWithOptions(o, SRTOptions{})
+}
+
+// WriteToSRTWithOptions writes subtitles in .srt format
+func (s Subtitles) WriteToSRTWithOptions(o io.Writer, opts SRTOptions) (err error) {
+	// Get millisecond separator
+	millisecondSep := ","
+	switch opts.MillisecondSeparator {
+	case "":
+	case ",", ".":
+		millisecondSep = opts.MillisecondSeparator
+	default:
+		err = fmt.Errorf("astisub: invalid millisecond separator %s", opts.MillisecondSeparator)
+		return
+	}
+
+	// Check frame size
+	if opts.WritePositions && (opts.FrameWidth <= 0 || opts.FrameHeight <= 0) {
+		err = fmt.Errorf("astisub: invalid frame size %dx%d", opts.FrameWidth, opts.FrameHeight)
+		return
+	}
+
 	// Do not write anything if no subtitles
 	if len(s.Items) == 0 {
 		err = ErrNoSubtitlesToWrite
@@ -222,21 +432,52 @@ func (s Subtitles) WriteToSRT(o io.Writer) (err error) {
 
 	// Add BOM header
 	var c []byte
-	c = append(c, BytesBOM...)
+	if !opts.PreserveBOM || (s.Metadata != nil && s.Metadata.SRTHadBOM) {
+		c = append(c, BytesBOM...)
+	}
 
 	// Loop through subtitles
 	for k, v := range s.Items {
 		// Add time boundaries
 		c = append(c, []byte(strconv.Itoa(k+1))...)
 		c = append(c, bytesLineSeparator...)
-		c = append(c, []byte(formatDurationSRT(v.StartAt))...)
+		c = append(c, []byte(formatDurationSRT(v.StartAt, millisecondSep))...)
 		c = append(c, bytesSRTTimeBoundariesSeparator...)
-		c = append(c, []byte(formatDurationSRT(v.EndAt))...)
+		c = append(c, []byte(formatDurationSRT(v.EndAt, millisecondSep))...)
+
+		// Add coordinates
+		if opts.WritePositions {
+			if x1, x2, y1, y2, ok := srtCoordinatesFromStyle(v.InlineStyle, len(v.Lines), opts.FrameWidth, opts.FrameHeight); ok {
+				c = append(c, []byte(fmt.Sprintf(" X1:%d X2:%d Y1:%d Y2:%d", x1, x2, y1, y2))...)
+			}
+		}
 		c = append(c, bytesLineSeparator...)
 
+		// Add position unless the first line item already has one
+		if v.InlineStyle != nil && v.InlineStyle.SRTPosition != 0 && len(v.Lines) > 0 &&
+			(len(v.Lines[0].Items) == 0 || v.Lines[0].Items[0].InlineStyle == nil || v.Lines[0].Items[0].InlineStyle.SRTPosition == 0) {
+			c = append(c, []byte(fmt.Sprintf(`{\an%d}`, v.InlineStyle.SRTPosition))...)
+		}
+
 		// Loop through lines
-		for _, l := range v.Lines {
-			c = append(c, []byte(l.srtBytes())...)
+		if opts.SingleLine {
+			sep := opts.SingleLineSeparator
+			if sep == "" {
+				sep = " "
+			}
+			for idx, l := range v.Lines {
+				if idx > 0 {
+					c = append(c, []byte(sep)...)
+				}
+				c = append(c, bytes.TrimSuffix(l.srtBytes(), bytesLineSeparator)...)
+			}
+			if len(v.Lines) > 0 {
+				c = append(c, bytesLineSeparator...)
+			}
+		} else {
+			for _, l := range v.Lines {
+				c = append(c, []byte(l.srtBytes())...)
+			}
 		}
 
 		// Add new line
@@ -254,6 +495,74 @@ func (s Subtitles) WriteToSRT(o io.Writer) (err error) {
 	return
 }
 
+// srtCoordinatesFromStyle computes the box, in pixels, of an item based on its TTML origin/extent or, as a
+// fallback, on its WebVTT position/size/line
+func srtCoordinatesFromStyle(sa *StyleAttributes, lines, frameWidth, frameHeight int) (x1, x2, y1, y2 int, ok bool) {
+	// No style
+	if sa == nil {
+		return
+	}
+
+	// Get box in percentages
+	var left, top, width, height float64
+	if sa.TTMLOrigin != nil && sa.TTMLExtent != nil {
+		var ok1, ok2 bool
+		if left, top, ok1 = parsePercentPair(*sa.TTMLOrigin); !ok1 {
+			return
+		}
+		if width, height, ok2 = parsePercentPair(*sa.TTMLExtent); !ok2 {
+			return
+		}
+	} else if sa.WebVTTLine != "" || sa.WebVTTPosition != "" {
+		// Line
+		top = 100 - webvttLineHeight*float64(lines)
+		if sa.WebVTTLine != "" {
+			var ok1 bool
+			if top, ok1 = parsePercent(strings.Split(sa.WebVTTLine, ",")[0]); !ok1 {
+				return
+			}
+		}
+		height = webvttLineHeight * float64(lines)
+
+		// Size
+		width = 100
+		if sa.WebVTTSize != "" {
+			var ok1 bool
+			if width, ok1 = parsePercent(sa.WebVTTSize); !ok1 {
+				return
+			}
+		}
+
+		// Position, which is the center of the box unless aligned otherwise
+		center := 50.0
+		if sa.WebVTTPosition != "" {
+			var ok1 bool
+			if center, ok1 = parsePercent(strings.Split(sa.WebVTTPosition, ",")[0]); !ok1 {
+				return
+			}
+		}
+		switch sa.WebVTTAlign {
+		case "left", "start":
+			left = center
+		case "right", "end":
+			left = center - width
+		default:
+			left = center - width/2
+		}
+	} else {
+		return
+	}
+
+	// Convert to pixels
+	clamp := func(v float64) float64 { return math.Max(0, math.Min(100, v)) }
+	x1 = int(math.Round(clamp(left) * float64(frameWidth) / 100))
+	x2 = int(math.Round(clamp(left+width) * float64(frameWidth) / 100))
+	y1 = int(math.Round(clamp(top) * float64(frameHeight) / 100))
+	y2 = int(math.Round(clamp(top+height) * float64(frameHeight) / 100))
+	ok = true
+	return
+}
+
 func (l Line) srtBytes() (c []byte) {
 	for idx, li := range l.Items {
 		c = append(c, li.srtBytes()...)
@@ -2,12 +2,15 @@ package astisub_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io/ioutil"
 	"os"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/asticode/go-astikit"
 	"github.com/asticode/go-astisub"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -155,3 +158,252 @@ func TestSRTParseDuration(t *testing.T) {
 	assert.Equal(t, 3*time.Second+390*time.Millisecond, s.Items[0].EndAt)
 	assert.Equal(t, "Duration without enclosing space", s.Items[0].Lines[0].String())
 }
+
+func TestSRTMicroDVDInlineCodes(t *testing.T) {
+	testData := `1
+00:00:01,000 --> 00:00:02,000
+{y:i}Line italics
+No style
+
+2
+00:00:03,000 --> 00:00:04,000
+{C:$0000ff}{y:b}Item color
+Still colored`
+
+	s, err := astisub.ReadFromSRT(strings.NewReader(testData))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 2)
+	assert.Equal(t, "{y:i}Line italics", s.Items[0].Lines[0].String())
+
+	s, err = astisub.ReadFromSRTWithOptions(strings.NewReader(testData), astisub.SRTOptions{MicroDVDInlineCodes: true})
+	require.NoError(t, err)
+	require.Len(t, s.Items, 2)
+	assert.Equal(t, "Line italics", s.Items[0].Lines[0].String())
+	assert.True(t, s.Items[0].Lines[0].Items[0].InlineStyle.SRTItalics)
+	assert.Nil(t, s.Items[0].Lines[1].Items[0].InlineStyle)
+	assert.Equal(t, "Item color", s.Items[1].Lines[0].String())
+	assert.Equal(t, "#ff0000", *s.Items[1].Lines[0].Items[0].InlineStyle.SRTColor)
+	assert.True(t, s.Items[1].Lines[0].Items[0].InlineStyle.SRTBold)
+	assert.Equal(t, "#ff0000", *s.Items[1].Lines[1].Items[0].InlineStyle.SRTColor)
+	assert.False(t, s.Items[1].Lines[1].Items[0].InlineStyle.SRTBold)
+}
+
+func TestSRTKeepRawText(t *testing.T) {
+	testData := `1
+00:00:01,000 --> 00:00:02,000
+<i>Italics</i>
+Second line
+
+2
+00:00:03,000 --> 00:00:04,000
+<font color="#ff0000">Red</font>
+`
+
+	s, err := astisub.ReadFromSRT(strings.NewReader(testData))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 2)
+	assert.Empty(t, s.Items[0].Raw)
+
+	s, err = astisub.ReadFromSRTWithOptions(strings.NewReader(testData), astisub.SRTOptions{KeepRawText: true})
+	require.NoError(t, err)
+	require.Len(t, s.Items, 2)
+	assert.Equal(t, "<i>Italics</i>\nSecond line", s.Items[0].Raw)
+	assert.Equal(t, "<font color=\"#ff0000\">Red</font>", s.Items[1].Raw)
+}
+
+func TestSRTMillisecondSeparator(t *testing.T) {
+	s, err := astisub.OpenFile("./testdata/example-in.srt")
+	require.NoError(t, err)
+
+	// Dot
+	w := &bytes.Buffer{}
+	err = s.WriteToSRTWithOptions(w, astisub.SRTOptions{MillisecondSeparator: "."})
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), "00:01:39.000 --> 00:01:41.040")
+	assert.NotContains(t, w.String(), "00:01:39,000")
+
+	// Invalid
+	err = s.WriteToSRTWithOptions(w, astisub.SRTOptions{MillisecondSeparator: ";"})
+	assert.Error(t, err)
+}
+
+func TestSRTWritePositions(t *testing.T) {
+	s := &astisub.Subtitles{Items: []*astisub.Item{
+		{
+			EndAt:       2 * time.Second,
+			InlineStyle: &astisub.StyleAttributes{TTMLExtent: astikit.StrPtr("80% 10%"), TTMLOrigin: astikit.StrPtr("10% 80%")},
+			Lines:       []astisub.Line{{Items: []astisub.LineItem{{Text: "TTML"}}}},
+			StartAt:     time.Second,
+		},
+		{
+			EndAt:       4 * time.Second,
+			InlineStyle: &astisub.StyleAttributes{WebVTTLine: "10%", WebVTTPosition: "50%", WebVTTSize: "50%"},
+			Lines:       []astisub.Line{{Items: []astisub.LineItem{{Text: "WebVTT"}}}},
+			StartAt:     3 * time.Second,
+		},
+		{
+			EndAt:   6 * time.Second,
+			Lines:   []astisub.Line{{Items: []astisub.LineItem{{Text: "None"}}}},
+			StartAt: 5 * time.Second,
+		},
+	}}
+
+	// Invalid frame size
+	w := &bytes.Buffer{}
+	err := s.WriteToSRTWithOptions(w, astisub.SRTOptions{WritePositions: true})
+	assert.Error(t, err)
+
+	// Write
+	err = s.WriteToSRTWithOptions(w, astisub.SRTOptions{FrameHeight: 480, FrameWidth: 640, WritePositions: true})
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), "00:00:01,000 --> 00:00:02,000 X1:64 X2:576 Y1:384 Y2:432\n")
+	assert.Contains(t, w.String(), "00:00:03,000 --> 00:00:04,000 X1:160 X2:480 Y1:48 Y2:74\n")
+	assert.Contains(t, w.String(), "00:00:05,000 --> 00:00:06,000\n")
+}
+
+func TestSRTContext(t *testing.T) {
+	r, err := os.Open("./testdata/example-in.srt")
+	require.NoError(t, err)
+	defer r.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = astisub.ReadFromSRTContext(ctx, r, astisub.SRTOptions{})
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestSRTPreserveBOM(t *testing.T) {
+	for _, bom := range []bool{true, false} {
+		i := "1\n00:00:01,000 --> 00:00:02,000\nTest\n"
+		if bom {
+			i = string(astisub.BytesBOM) + i
+		}
+		s, err := astisub.ReadFromSRT(strings.NewReader(i))
+		require.NoError(t, err)
+		assert.Equal(t, bom, s.Metadata != nil && s.Metadata.SRTHadBOM)
+
+		w := &bytes.Buffer{}
+		err = s.WriteToSRTWithOptions(w, astisub.SRTOptions{PreserveBOM: true})
+		require.NoError(t, err)
+		assert.Equal(t, i, w.String())
+
+		w.Reset()
+		err = s.WriteToSRT(w)
+		require.NoError(t, err)
+		assert.True(t, bytes.HasPrefix(w.Bytes(), astisub.BytesBOM))
+	}
+}
+
+func TestSRTSeparatorInText(t *testing.T) {
+	s, err := astisub.ReadFromSRT(strings.NewReader(`1
+00:00:01,000 --> 00:00:02,000
+Press A --> B
+
+2
+00:00:03,000 --> 00:00:04,000
+x --> y
+`))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 2)
+	assert.Equal(t, "Press A --> B", s.Items[0].String())
+	assert.Equal(t, 1, s.Items[0].Index)
+	assert.Equal(t, "x --> y", s.Items[1].String())
+	assert.Equal(t, 3*time.Second, s.Items[1].StartAt)
+}
+
+func TestSRTSingleLine(t *testing.T) {
+	s := mockSubtitles()
+	s.Items[0].Lines = append(s.Items[0].Lines, astisub.Line{Items: []astisub.LineItem{{InlineStyle: &astisub.StyleAttributes{SRTItalics: true}, Text: "italic"}}})
+
+	// Default separator
+	w := &bytes.Buffer{}
+	err := s.WriteToSRTWithOptions(w, astisub.SRTOptions{SingleLine: true})
+	require.NoError(t, err)
+	assert.Equal(t, "\ufeff1\n00:00:01,000 --> 00:00:03,000\nsubtitle-1 <i>italic</i>\n\n2\n00:00:03,000 --> 00:00:07,000\nsubtitle-2\n", w.String())
+
+	// Custom separator
+	w.Reset()
+	err = s.WriteToSRTWithOptions(w, astisub.SRTOptions{SingleLine: true, SingleLineSeparator: " / "})
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), "subtitle-1 / <i>italic</i>\n")
+}
+
+func TestSRTCoalesceIdenticalTimings(t *testing.T) {
+	const i = `1
+00:00:01,000 --> 00:00:02,000
+Hello
+
+2
+00:00:01,000 --> 00:00:02,000
+Bonjour
+
+3
+00:00:03,000 --> 00:00:04,000
+World`
+
+	// Default
+	s, err := astisub.ReadFromSRT(strings.NewReader(i))
+	require.NoError(t, err)
+	assert.Len(t, s.Items, 3)
+
+	// Coalesce
+	s, err = astisub.ReadFromSRTWithOptions(strings.NewReader(i), astisub.SRTOptions{CoalesceIdenticalTimings: true})
+	require.NoError(t, err)
+	require.Len(t, s.Items, 2)
+	assert.Equal(t, "Hello\nBonjour", s.Items[0].StringSep("\n"))
+	assert.Equal(t, time.Second, s.Items[0].StartAt)
+	assert.Equal(t, 2*time.Second, s.Items[0].EndAt)
+	assert.Equal(t, "World", s.Items[1].String())
+}
+
+func TestSRTMissingEndTime(t *testing.T) {
+	_, err := astisub.ReadFromSRT(strings.NewReader("1\n00:00:01,000 -->\nHello\n"))
+	assert.EqualError(t, err, "astisub: line 2: time boundaries has no end time")
+}
+
+func TestSRTPosition(t *testing.T) {
+	s, err := astisub.ReadFromSRT(strings.NewReader(`1
+00:00:01,000 --> 00:00:02,000
+{\an8}Top
+second line
+
+2
+00:00:03,000 --> 00:00:04,000
+<i>{\an1}Bottom left</i>
+
+3
+00:00:05,000 --> 00:00:06,000
+Default`))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 3)
+	assert.Equal(t, byte(8), s.Items[0].InlineStyle.SRTPosition)
+	assert.Equal(t, "Top\nsecond line", s.Items[0].StringSep("\n"))
+	assert.Equal(t, byte(1), s.Items[1].InlineStyle.SRTPosition)
+	assert.Equal(t, "Bottom left", s.Items[1].String())
+	assert.Nil(t, s.Items[2].InlineStyle)
+
+	// SRT
+	w := &bytes.Buffer{}
+	require.NoError(t, s.WriteToSRT(w))
+	assert.Contains(t, w.String(), "00:00:01,000 --> 00:00:02,000\n{\\an8}Top\nsecond line\n")
+	assert.Contains(t, w.String(), "00:00:03,000 --> 00:00:04,000\n{\\an1}<i>Bottom left</i>\n")
+
+	// WebVTT
+	w.Reset()
+	require.NoError(t, s.WriteToWebVTT(w))
+	assert.Contains(t, w.String(), "00:00:01.000 --> 00:00:02.000 line:10%\n")
+	assert.Contains(t, w.String(), "00:00:03.000 --> 00:00:04.000 align:left line:90%\n")
+	assert.Contains(t, w.String(), "00:00:05.000 --> 00:00:06.000\n")
+}
+
+func TestSRTBidiMarks(t *testing.T) {
+	s, err := astisub.ReadFromSRT(strings.NewReader("1\n00:00:01,000 --> 00:00:02,000\n\u200fשלום\u200e!\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "\u200fשלום\u200e!", s.Items[0].String())
+
+	// Bidi marks are written as raw bytes since SRT players don't decode their entities
+	w := &bytes.Buffer{}
+	require.NoError(t, s.WriteToSRT(w))
+	assert.Contains(t, w.String(), "00:00:02,000\n\u200fשלום\u200e!\n")
+	assert.NotContains(t, w.String(), "&")
+}
@@ -1,6 +1,8 @@
 package astisub
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -39,6 +41,18 @@ const (
 	ssaCollisionsReverse = "Reverse"
 )
 
+// SSA default style
+const (
+	ssaDefaultStyleName      = "Default"
+	ssaScriptTypeV4          = "v4.00"
+	ssaScriptTypeV4Plus      = "v4.00+"
+	ssaReferencePlayResX     = 384
+	ssaReferencePlayResY     = 288
+	ssaReferenceFontSize     = 20
+	ssaReferenceMargin       = 10
+	ssaReferenceOutlineWidth = 2
+)
+
 // SSA event categories
 const (
 	ssaEventCategoryCommand  = "Command"
@@ -66,21 +80,23 @@ const (
 
 // SSA script info names
 const (
-	ssaScriptInfoNameCollisions          = "Collisions"
-	ssaScriptInfoNameOriginalEditing     = "Original Editing"
-	ssaScriptInfoNameOriginalScript      = "Original Script"
-	ssaScriptInfoNameOriginalTiming      = "Original Timing"
-	ssaScriptInfoNameOriginalTranslation = "Original Translation"
-	ssaScriptInfoNamePlayDepth           = "PlayDepth"
-	ssaScriptInfoNamePlayResX            = "PlayResX"
-	ssaScriptInfoNamePlayResY            = "PlayResY"
-	ssaScriptInfoNameScriptType          = "ScriptType"
-	ssaScriptInfoNameScriptUpdatedBy     = "Script Updated By"
-	ssaScriptInfoNameSynchPoint          = "Synch Point"
-	ssaScriptInfoNameTimer               = "Timer"
-	ssaScriptInfoNameTitle               = "Title"
-	ssaScriptInfoNameUpdateDetails       = "Update Details"
-	ssaScriptInfoNameWrapStyle           = "WrapStyle"
+	ssaScriptInfoNameCollisions            = "Collisions"
+	ssaScriptInfoNameOriginalEditing       = "Original Editing"
+	ssaScriptInfoNameOriginalScript        = "Original Script"
+	ssaScriptInfoNameOriginalTiming        = "Original Timing"
+	ssaScriptInfoNameOriginalTranslation   = "Original Translation"
+	ssaScriptInfoNamePlayDepth             = "PlayDepth"
+	ssaScriptInfoNamePlayResX              = "PlayResX"
+	ssaScriptInfoNamePlayResY              = "PlayResY"
+	ssaScriptInfoNameScaledBorderAndShadow = "ScaledBorderAndShadow"
+	ssaScriptInfoNameScriptType            = "ScriptType"
+	ssaScriptInfoNameScriptUpdatedBy       = "Script Updated By"
+	ssaScriptInfoNameSynchPoint            = "Synch Point"
+	ssaScriptInfoNameTimer                 = "Timer"
+	ssaScriptInfoNameTitle                 = "Title"
+	ssaScriptInfoNameUpdateDetails         = "Update Details"
+	ssaScriptInfoNameWrapStyle             = "WrapStyle"
+	ssaScriptInfoNameYCbCrMatrix           = "YCbCr Matrix"
 )
 
 // SSA section names
@@ -120,8 +136,174 @@ const (
 	ssaStyleFormatNameUnderline       = "Underline"
 )
 
+// SSA v4.00+ style format, as expected by players reading .ass files
+var (
+	ssaV4PlusStyleFormat = []string{
+		ssaStyleFormatNameName,
+		ssaStyleFormatNameFontName,
+		ssaStyleFormatNameFontSize,
+		ssaStyleFormatNamePrimaryColour,
+		ssaStyleFormatNameSecondaryColour,
+		ssaStyleFormatNameOutlineColour,
+		ssaStyleFormatNameBackColour,
+		ssaStyleFormatNameBold,
+		ssaStyleFormatNameItalic,
+		ssaStyleFormatNameUnderline,
+		ssaStyleFormatNameStrikeout,
+		ssaStyleFormatNameScaleX,
+		ssaStyleFormatNameScaleY,
+		ssaStyleFormatNameSpacing,
+		ssaStyleFormatNameAngle,
+		ssaStyleFormatNameBorderStyle,
+		ssaStyleFormatNameOutline,
+		ssaStyleFormatNameShadow,
+		ssaStyleFormatNameAlignment,
+		ssaStyleFormatNameMarginL,
+		ssaStyleFormatNameMarginR,
+		ssaStyleFormatNameMarginV,
+		ssaStyleFormatNameEncoding,
+	}
+	ssaV4PlusStyleDefaults = map[string]string{
+		ssaStyleFormatNameAlignment:       "2",
+		ssaStyleFormatNameAngle:           "0",
+		ssaStyleFormatNameBackColour:      "&H00000000",
+		ssaStyleFormatNameBold:            "0",
+		ssaStyleFormatNameBorderStyle:     "1",
+		ssaStyleFormatNameEncoding:        "1",
+		ssaStyleFormatNameFontName:        "Arial",
+		ssaStyleFormatNameFontSize:        "20",
+		ssaStyleFormatNameItalic:          "0",
+		ssaStyleFormatNameMarginL:         "10",
+		ssaStyleFormatNameMarginR:         "10",
+		ssaStyleFormatNameMarginV:         "10",
+		ssaStyleFormatNameOutline:         "2",
+		ssaStyleFormatNameOutlineColour:   "&H00000000",
+		ssaStyleFormatNamePrimaryColour:   "&H00FFFFFF",
+		ssaStyleFormatNameScaleX:          "100",
+		ssaStyleFormatNameScaleY:          "100",
+		ssaStyleFormatNameSecondaryColour: "&H000000FF",
+		ssaStyleFormatNameShadow:          "2",
+		ssaStyleFormatNameSpacing:         "0",
+		ssaStyleFormatNameStrikeout:       "0",
+		ssaStyleFormatNameUnderline:       "0",
+	}
+)
+
 // SSA regexp
-var ssaRegexpEffect = regexp.MustCompile(`\{[^\{]+\}`)
+var (
+	ssaRegexpEffect = regexp.MustCompile(`\{[^\{]+\}`)
+	ssaRegexpFad    = regexp.MustCompile(`\\fad\(\s*(\d+)\s*,\s*(\d+)\s*\)`)
+	ssaRegexpMove   = regexp.MustCompile(`\\move\(([^\)]*)\)`)
+	ssaRegexpReset  = regexp.MustCompile(`\\r([^\\\}]*)`)
+)
+
+// SSA text escapes
+// \N and \n are handled when splitting lines
+var (
+	ssaTextEscaper   = strings.NewReplacer("\u00A0", "\\h")
+	ssaTextUnescaper = strings.NewReplacer("\\h", "\u00A0")
+)
+
+// SSAMove represents an SSA \move override tag
+type SSAMove struct {
+	EndAt   time.Duration // Relative to the item's start, both EndAt and StartAt are optional
+	StartAt time.Duration
+	X1      float64
+	X2      float64
+	Y1      float64
+	Y2      float64
+}
+
+// SSA event effects names
+const (
+	SSAEventEffectNameBanner     = "Banner"
+	SSAEventEffectNameScrollDown = "Scroll down"
+	SSAEventEffectNameScrollUp   = "Scroll up"
+)
+
+// SSAEventEffect represents a standard effect of an SSA event Effect field, as opposed to override tags
+type SSAEventEffect struct {
+	Delay       int // Milliseconds per pixel
+	FadeAway    int // Banner's fade away width or scroll's fade away height, in pixels. Optional.
+	LeftToRight bool
+	Name        string
+	Y1          int // Scroll only
+	Y2          int // Scroll only
+}
+
+// newSSAEventEffectFromString parses a standard SSA event effect and returns false if i is not one
+func newSSAEventEffectFromString(i string) (e *SSAEventEffect, ok bool) {
+	// Parse values
+	split := strings.Split(i, ";")
+	var vs []int
+	for _, v := range split[1:] {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return
+		}
+		vs = append(vs, n)
+	}
+
+	// Switch on name
+	e = &SSAEventEffect{}
+	switch name := strings.TrimSpace(split[0]); {
+	case strings.EqualFold(name, SSAEventEffectNameBanner):
+		if len(vs) < 1 || len(vs) > 3 {
+			return nil, false
+		}
+		e.Name = SSAEventEffectNameBanner
+		e.Delay = vs[0]
+		if len(vs) > 1 {
+			e.LeftToRight = vs[1] == 1
+		}
+		if len(vs) > 2 {
+			e.FadeAway = vs[2]
+		}
+	case strings.EqualFold(name, SSAEventEffectNameScrollDown), strings.EqualFold(name, SSAEventEffectNameScrollUp):
+		if len(vs) < 3 || len(vs) > 4 {
+			return nil, false
+		}
+		e.Name = SSAEventEffectNameScrollUp
+		if strings.EqualFold(name, SSAEventEffectNameScrollDown) {
+			e.Name = SSAEventEffectNameScrollDown
+		}
+		e.Y1 = vs[0]
+		e.Y2 = vs[1]
+		e.Delay = vs[2]
+		if len(vs) > 3 {
+			e.FadeAway = vs[3]
+		}
+	default:
+		return nil, false
+	}
+	return e, true
+}
+
+// String implements the Stringer interface
+func (e SSAEventEffect) String() string {
+	var vs []int
+	switch e.Name {
+	case SSAEventEffectNameBanner:
+		vs = append(vs, e.Delay)
+		if e.LeftToRight || e.FadeAway > 0 {
+			var ltr int
+			if e.LeftToRight {
+				ltr = 1
+			}
+			vs = append(vs, ltr)
+		}
+	default:
+		vs = append(vs, e.Y1, e.Y2, e.Delay)
+	}
+	if e.FadeAway > 0 {
+		vs = append(vs, e.FadeAway)
+	}
+	ss := []string{e.Name}
+	for _, v := range vs {
+		ss = append(ss, strconv.Itoa(v))
+	}
+	return strings.Join(ss, ";")
+}
 
 // ReadFromSSA parses an .ssa content
 func ReadFromSSA(i io.Reader) (o *Subtitles, err error) {
@@ -131,6 +313,11 @@ func ReadFromSSA(i io.Reader) (o *Subtitles, err error) {
 
 // ReadFromSSAWithOptions parses an .ssa content
 func ReadFromSSAWithOptions(i io.Reader, opts SSAOptions) (o *Subtitles, err error) {
+	return ReadFromSSAContext(context.Background(), i, opts)
+}
+
+// ReadFromSSAContext parses an .ssa content and returns early once the context is cancelled
+func ReadFromSSAContext(ctx context.Context, i io.Reader, opts SSAOptions) (o *Subtitles, err error) {
 	// Init
 	o = NewSubtitles()
 	var scanner = newScanner(i)
@@ -141,8 +328,15 @@ func ReadFromSSAWithOptions(i io.Reader, opts SSAOptions) (o *Subtitles, err err
 	// Scan
 	var line, sectionName string
 	var format map[int]string
+	var scriptInfoSections int
 	isFirstLine := true
 	for scanner.Scan() {
+		// Check context
+		if err = ctx.Err(); err != nil {
+			err = fmt.Errorf("astisub: checking context failed: %w", err)
+			return
+		}
+
 		// Fetch line
 		line = strings.TrimSpace(scanner.Text())
 
@@ -166,6 +360,7 @@ func ReadFromSSAWithOptions(i io.Reader, opts SSAOptions) (o *Subtitles, err err
 				continue
 			case "script info":
 				sectionName = ssaSectionNameScriptInfo
+				scriptInfoSections++
 				continue
 			case "v4 styles", "v4+ styles", "v4 styles+":
 				sectionName = ssaSectionNameStyles
@@ -205,6 +400,12 @@ func ReadFromSSAWithOptions(i io.Reader, opts SSAOptions) (o *Subtitles, err err
 		// Switch on section name
 		switch sectionName {
 		case ssaSectionNameScriptInfo:
+			// Only the first script info section is kept, which happens when several files have been concatenated
+			if scriptInfoSections > 1 {
+				continue
+			}
+
+			// Parse
 			if err = si.parse(header, content); err != nil {
 				err = fmt.Errorf("astisub: parsing script info block failed: %w", err)
 				return
@@ -212,6 +413,7 @@ func ReadFromSSAWithOptions(i io.Reader, opts SSAOptions) (o *Subtitles, err err
 		case ssaSectionNameEvents, ssaSectionNameStyles:
 			// Parse format
 			if header == "Format" {
+				format = make(map[int]string)
 				for idx, item := range strings.Split(content, ",") {
 					format[idx] = strings.TrimSpace(item)
 				}
@@ -231,6 +433,10 @@ func ReadFromSSAWithOptions(i io.Reader, opts SSAOptions) (o *Subtitles, err err
 						return
 					}
 					es = append(es, e)
+					if opts.MaxItems > 0 && len(es) > opts.MaxItems {
+						err = ErrMaxItemsExceeded
+						return
+					}
 				case ssaSectionNameStyles:
 					var s *ssaStyle
 					if s, err = newSSAStyleFromString(content, format); err != nil {
@@ -253,15 +459,28 @@ func ReadFromSSAWithOptions(i io.Reader, opts SSAOptions) (o *Subtitles, err err
 	}
 
 	// Loop through events
-	for _, e := range es {
-		// Only process dialogues
-		if e.category == ssaEventCategoryDialogue {
+	for idx, e := range es {
+		// Only process dialogues, and comments if requested
+		if e.category == ssaEventCategoryDialogue || (opts.KeepCommentEvents && e.category == ssaEventCategoryComment) {
 			// Build item
 			var item *Item
-			if item, err = e.item(o.Styles); err != nil {
+			if item, err = e.item(o.Styles, opts.CaseInsensitiveStyleNames); err != nil {
 				return
 			}
 
+			// Skip empty items
+			if len(item.Lines) == 0 && !opts.KeepEmptyItems {
+				continue
+			}
+
+			// Store raw text
+			if opts.KeepRawText {
+				item.Raw = e.text
+			}
+
+			// Store declaration order since layering of items sharing the same timestamps relies on it
+			item.Index = idx + 1
+
 			// Append item
 			o.Items = append(o.Items, item)
 		}
@@ -293,21 +512,23 @@ func newSSAColorFromColor(i *Color) string {
 
 // ssaScriptInfo represents an SSA script info block
 type ssaScriptInfo struct {
-	collisions          string
-	comments            []string
-	originalEditing     string
-	originalScript      string
-	originalTiming      string
-	originalTranslation string
-	playDepth           *int
-	playResX, playResY  *int
-	scriptType          string
-	scriptUpdatedBy     string
-	synchPoint          string
-	timer               *float64
-	title               string
-	updateDetails       string
-	wrapStyle           string
+	collisions            string
+	comments              []string
+	originalEditing       string
+	originalScript        string
+	originalTiming        string
+	originalTranslation   string
+	playDepth             *int
+	playResX, playResY    *int
+	scaledBorderAndShadow string
+	scriptType            string
+	scriptUpdatedBy       string
+	synchPoint            string
+	timer                 *float64
+	title                 string
+	updateDetails         string
+	wrapStyle             string
+	yCbCrMatrix           string
 }
 
 // newSSAScriptInfo builds an SSA script info block based on metadata
@@ -326,6 +547,7 @@ func newSSAScriptInfo(m *Metadata) (o *ssaScriptInfo) {
 		o.playDepth = m.SSAPlayDepth
 		o.playResX = m.SSAPlayResX
 		o.playResY = m.SSAPlayResY
+		o.scaledBorderAndShadow = m.SSAScaledBorderAndShadow
 		o.scriptType = m.SSAScriptType
 		o.scriptUpdatedBy = m.SSAScriptUpdatedBy
 		o.synchPoint = m.SSASynchPoint
@@ -333,6 +555,7 @@ func newSSAScriptInfo(m *Metadata) (o *ssaScriptInfo) {
 		o.title = m.Title
 		o.updateDetails = m.SSAUpdateDetails
 		o.wrapStyle = m.SSAWrapStyle
+		o.yCbCrMatrix = m.SSAYCbCrMatrix
 	}
 	return
 }
@@ -350,6 +573,8 @@ func (b *ssaScriptInfo) parse(header, content string) (err error) {
 		b.originalTiming = content
 	case ssaScriptInfoNameOriginalTranslation:
 		b.originalTranslation = content
+	case ssaScriptInfoNameScaledBorderAndShadow:
+		b.scaledBorderAndShadow = content
 	case ssaScriptInfoNameScriptType:
 		b.scriptType = content
 	case ssaScriptInfoNameScriptUpdatedBy:
@@ -362,6 +587,8 @@ func (b *ssaScriptInfo) parse(header, content string) (err error) {
 		b.updateDetails = content
 	case ssaScriptInfoNameWrapStyle:
 		b.wrapStyle = content
+	case ssaScriptInfoNameYCbCrMatrix:
+		b.yCbCrMatrix = content
 	// Int
 	case ssaScriptInfoNamePlayResX, ssaScriptInfoNamePlayResY, ssaScriptInfoNamePlayDepth:
 		var v int
@@ -390,22 +617,24 @@ func (b *ssaScriptInfo) parse(header, content string) (err error) {
 // metadata returns the block as Metadata
 func (b *ssaScriptInfo) metadata() *Metadata {
 	return &Metadata{
-		Comments:               b.comments,
-		SSACollisions:          b.collisions,
-		SSAOriginalEditing:     b.originalEditing,
-		SSAOriginalScript:      b.originalScript,
-		SSAOriginalTiming:      b.originalTiming,
-		SSAOriginalTranslation: b.originalTranslation,
-		SSAPlayDepth:           b.playDepth,
-		SSAPlayResX:            b.playResX,
-		SSAPlayResY:            b.playResY,
-		SSAScriptType:          b.scriptType,
-		SSAScriptUpdatedBy:     b.scriptUpdatedBy,
-		SSASynchPoint:          b.synchPoint,
-		SSATimer:               b.timer,
-		SSAUpdateDetails:       b.updateDetails,
-		SSAWrapStyle:           b.wrapStyle,
-		Title:                  b.title,
+		Comments:                 b.comments,
+		SSACollisions:            b.collisions,
+		SSAOriginalEditing:       b.originalEditing,
+		SSAOriginalScript:        b.originalScript,
+		SSAOriginalTiming:        b.originalTiming,
+		SSAOriginalTranslation:   b.originalTranslation,
+		SSAPlayDepth:             b.playDepth,
+		SSAPlayResX:              b.playResX,
+		SSAPlayResY:              b.playResY,
+		SSAScaledBorderAndShadow: b.scaledBorderAndShadow,
+		SSAScriptType:            b.scriptType,
+		SSAScriptUpdatedBy:       b.scriptUpdatedBy,
+		SSASynchPoint:            b.synchPoint,
+		SSATimer:                 b.timer,
+		SSAUpdateDetails:         b.updateDetails,
+		SSAWrapStyle:             b.wrapStyle,
+		SSAYCbCrMatrix:           b.yCbCrMatrix,
+		Title:                    b.title,
 	}
 }
 
@@ -440,6 +669,9 @@ func (b *ssaScriptInfo) bytes() (o []byte) {
 	if b.playResY != nil {
 		o = appendStringToBytesWithNewLine(o, ssaScriptInfoNamePlayResY+": "+strconv.Itoa(*b.playResY))
 	}
+	if len(b.scaledBorderAndShadow) > 0 {
+		o = appendStringToBytesWithNewLine(o, ssaScriptInfoNameScaledBorderAndShadow+": "+b.scaledBorderAndShadow)
+	}
 	if len(b.scriptType) > 0 {
 		o = appendStringToBytesWithNewLine(o, ssaScriptInfoNameScriptType+": "+b.scriptType)
 	}
@@ -461,6 +693,9 @@ func (b *ssaScriptInfo) bytes() (o []byte) {
 	if len(b.wrapStyle) > 0 {
 		o = appendStringToBytesWithNewLine(o, ssaScriptInfoNameWrapStyle+": "+b.wrapStyle)
 	}
+	if len(b.yCbCrMatrix) > 0 {
+		o = appendStringToBytesWithNewLine(o, ssaScriptInfoNameYCbCrMatrix+": "+b.yCbCrMatrix)
+	}
 	return
 }
 
@@ -732,8 +967,8 @@ func (s ssaStyle) updateFormat(formatMap map[string]bool, format []string) []str
 	return format
 }
 
-// string returns the block as a string
-func (s ssaStyle) string(format []string) string {
+// string returns the block as a string. Defaults are used for attributes that are not set
+func (s ssaStyle) string(format []string, defaults map[string]string) string {
 	var ss = []string{s.name}
 	for _, attr := range format {
 		var v string
@@ -833,6 +1068,9 @@ func (s ssaStyle) string(format []string) string {
 			found = false
 		}
 		if found {
+			if len(v) == 0 {
+				v = defaults[attr]
+			}
 			ss = append(ss, v)
 		}
 	}
@@ -906,26 +1144,52 @@ func newSSAEventFromItem(i Item) (e *ssaEvent) {
 	// Inline style
 	if i.InlineStyle != nil {
 		e.effect = i.InlineStyle.SSAEffect
+		if i.InlineStyle.SSAEventEffect != nil {
+			e.effect = i.InlineStyle.SSAEventEffect.String()
+		}
 		e.layer = i.InlineStyle.SSALayer
 		e.marginLeft = i.InlineStyle.SSAMarginLeft
 		e.marginRight = i.InlineStyle.SSAMarginRight
 		e.marginVertical = i.InlineStyle.SSAMarginVertical
 		e.marked = i.InlineStyle.SSAMarked
+		if i.InlineStyle.SSAComment {
+			e.category = ssaEventCategoryComment
+		}
 	}
 
 	// Text
 	var lines []string
+	var currentStyle = i.Style
 	for _, l := range i.Lines {
 		var items []string
 		for _, item := range l.Items {
 			var s string
-			if item.InlineStyle != nil && len(item.InlineStyle.SSAEffect) > 0 {
-				s += item.InlineStyle.SSAEffect
+			if item.InlineStyle != nil {
+				s += item.InlineStyle.ssaEffectWithAnimations()
 			}
-			s += item.Text
+
+			// Add style reset
+			style := item.Style
+			if style == nil {
+				style = i.Style
+			}
+			if style != currentStyle {
+				tag := "\\r"
+				if style != i.Style {
+					tag += style.ID
+				}
+				if len(s) > 0 {
+					s = "{" + tag + strings.TrimPrefix(s, "{")
+				} else {
+					s = "{" + tag + "}"
+				}
+				currentStyle = style
+			}
+			s += ssaTextEscaper.Replace(item.Text)
 			items = append(items, s)
 		}
-		if len(l.VoiceName) > 0 {
+		// SSA events have a single name, the first line's voice name is used
+		if len(e.name) == 0 && len(l.VoiceName) > 0 {
 			e.name = l.VoiceName
 		}
 		lines = append(lines, strings.Join(items, " "))
@@ -1009,8 +1273,8 @@ func newSSAEventFromString(header, content string, format map[int]string) (e *ss
 			case ssaEventFormatNameStyle:
 				// *Default is reserved
 				// http://www.tcax.org/docs/ass-specs.htm
-				if item == "*Default" {
-					e.style = "Default"
+				if item == "*"+ssaDefaultStyleName {
+					e.style = ssaDefaultStyleName
 				} else {
 					e.style = item
 				}
@@ -1030,11 +1294,12 @@ func newSSAEventFromString(header, content string, format map[int]string) (e *ss
 }
 
 // item converts an SSA event to an Item
-func (e *ssaEvent) item(styles map[string]*Style) (i *Item, err error) {
+func (e *ssaEvent) item(styles map[string]*Style, caseInsensitiveStyleNames bool) (i *Item, err error) {
 	// Init item
 	i = &Item{
 		EndAt: e.end,
 		InlineStyle: &StyleAttributes{
+			SSAComment:        e.category == ssaEventCategoryComment,
 			SSAEffect:         e.effect,
 			SSALayer:          e.layer,
 			SSAMarginLeft:     e.marginLeft,
@@ -1045,24 +1310,40 @@ func (e *ssaEvent) item(styles map[string]*Style) (i *Item, err error) {
 		StartAt: e.start,
 	}
 
+	// Standard effects are parsed separately from other effects
+	if ee, ok := newSSAEventEffectFromString(e.effect); ok {
+		i.InlineStyle.SSAEffect = ""
+		i.InlineStyle.SSAEventEffect = ee
+	}
+
 	// Set style
 	if len(e.style) > 0 {
-		// Sometimes there's an "*" before the style name (e.g. with ffmpeg)
-		for _, name := range []string{e.style, strings.TrimPrefix(e.style, "*")} {
-			if s, ok := styles[name]; ok {
-				i.Style = s
-				break
-			}
-		}
+		i.Style = ssaFindStyle(styles, e.style, caseInsensitiveStyleNames)
+	}
+
+	// Empty texts, e.g. timing markers in karaoke templates, don't produce any line
+	if strings.TrimSpace(e.text) == "" {
+		return
 	}
 
 	// \N and \n are both valid new line characters in SSA
 	text := strings.ReplaceAll(e.text, "\\N", "\\n")
 
+	// Style resets apply until the next reset, even across lines. Line items only get a style
+	// when it differs from the item's
+	var currentStyle = i.Style
+	lineItemStyle := func() *Style {
+		if currentStyle == i.Style {
+			return nil
+		}
+		return currentStyle
+	}
+
 	// Loop through lines
 	for _, s := range strings.Split(text, "\\n") {
 		// Init
 		s = strings.TrimSpace(s)
+		// The event name applies to every line
 		var l = Line{VoiceName: e.name}
 
 		// Extract effects
@@ -1076,15 +1357,32 @@ func (e *ssaEvent) item(styles map[string]*Style) (i *Item, err error) {
 					lineItem.Text = s[previousEffectEndOffset:idxs[0]]
 					l.Items = append(l.Items, *lineItem)
 				} else if idxs[0] > 0 {
-					l.Items = append(l.Items, LineItem{Text: s[previousEffectEndOffset:idxs[0]]})
+					l.Items = append(l.Items, LineItem{Style: lineItemStyle(), Text: s[previousEffectEndOffset:idxs[0]]})
 				}
 				previousEffectEndOffset = idxs[1]
 				lineItem = &LineItem{InlineStyle: &StyleAttributes{SSAEffect: s[idxs[0]:idxs[1]]}}
+
+				// Reset style
+				if name, ok := lineItem.InlineStyle.parseSSAReset(); ok {
+					currentStyle = i.Style
+					if len(name) > 0 {
+						if st := ssaFindStyle(styles, name, caseInsensitiveStyleNames); st != nil {
+							currentStyle = st
+						}
+					}
+				}
+				lineItem.Style = lineItemStyle()
+				lineItem.InlineStyle.parseSSAAnimations()
 			}
 			lineItem.Text = s[previousEffectEndOffset:]
 			l.Items = append(l.Items, *lineItem)
 		} else {
-			l.Items = append(l.Items, LineItem{Text: s})
+			l.Items = append(l.Items, LineItem{Style: lineItemStyle(), Text: s})
+		}
+
+		// Unescape texts
+		for idx := range l.Items {
+			l.Items[idx].Text = ssaTextUnescaper.Replace(l.Items[idx].Text)
 		}
 
 		// Add line
@@ -1093,9 +1391,99 @@ func (e *ssaEvent) item(styles map[string]*Style) (i *Item, err error) {
 	return
 }
 
+// parseSSAReset removes the last \r override tag from the SSA effect, as well as the tags preceding it
+// since it cancels them, and returns the name of the style it resets to which is empty when resetting
+// to the event's style
+func (sa *StyleAttributes) parseSSAReset() (name string, ok bool) {
+	// Get last reset
+	ms := ssaRegexpReset.FindAllStringSubmatchIndex(sa.SSAEffect, -1)
+	if len(ms) == 0 {
+		return
+	}
+	m := ms[len(ms)-1]
+
+	// Update effect
+	name = strings.TrimSpace(sa.SSAEffect[m[2]:m[3]])
+	sa.SSAEffect = "{" + sa.SSAEffect[m[1]:]
+	if sa.SSAEffect == "{}" {
+		sa.SSAEffect = ""
+	}
+	return name, true
+}
+
+// parseSSAAnimations moves \fad and \move override tags from the SSA effect to structured attributes
+func (sa *StyleAttributes) parseSSAAnimations() {
+	// Fade
+	if m := ssaRegexpFad.FindStringSubmatch(sa.SSAEffect); m != nil {
+		in, _ := strconv.Atoi(m[1])
+		out, _ := strconv.Atoi(m[2])
+		sa.SSAFadeIn = time.Duration(in) * time.Millisecond
+		sa.SSAFadeOut = time.Duration(out) * time.Millisecond
+		sa.SSAEffect = strings.Replace(sa.SSAEffect, m[0], "", 1)
+	}
+
+	// Move
+	if m := ssaRegexpMove.FindStringSubmatch(sa.SSAEffect); m != nil {
+		var vs []float64
+		for _, v := range strings.Split(m[1], ",") {
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return
+			}
+			vs = append(vs, f)
+		}
+		if len(vs) != 4 && len(vs) != 6 {
+			return
+		}
+		sa.SSAMove = &SSAMove{X1: vs[0], X2: vs[2], Y1: vs[1], Y2: vs[3]}
+		if len(vs) == 6 {
+			sa.SSAMove.StartAt = time.Duration(vs[4]) * time.Millisecond
+			sa.SSAMove.EndAt = time.Duration(vs[5]) * time.Millisecond
+		}
+		sa.SSAEffect = strings.Replace(sa.SSAEffect, m[0], "", 1)
+	}
+
+	// Effect is now empty
+	if sa.SSAEffect == "{}" {
+		sa.SSAEffect = ""
+	}
+}
+
+// ssaEffectWithAnimations returns the SSA effect with \fad and \move override tags added back
+func (sa *StyleAttributes) ssaEffectWithAnimations() string {
+	// Build tags
+	var tags string
+	if sa.SSAFadeIn > 0 || sa.SSAFadeOut > 0 {
+		tags += fmt.Sprintf("\\fad(%d,%d)", sa.SSAFadeIn.Milliseconds(), sa.SSAFadeOut.Milliseconds())
+	}
+	if m := sa.SSAMove; m != nil {
+		tags += "\\move(" + strings.Join([]string{
+			strconv.FormatFloat(m.X1, 'f', -1, 64),
+			strconv.FormatFloat(m.Y1, 'f', -1, 64),
+			strconv.FormatFloat(m.X2, 'f', -1, 64),
+			strconv.FormatFloat(m.Y2, 'f', -1, 64),
+		}, ",")
+		if m.StartAt > 0 || m.EndAt > 0 {
+			tags += fmt.Sprintf(",%d,%d", m.StartAt.Milliseconds(), m.EndAt.Milliseconds())
+		}
+		tags += ")"
+	}
+
+	// No tags
+	if len(tags) == 0 {
+		return sa.SSAEffect
+	}
+
+	// Add tags
+	if len(sa.SSAEffect) == 0 {
+		return "{" + tags + "}"
+	}
+	return "{" + tags + strings.TrimPrefix(sa.SSAEffect, "{")
+}
+
 // formatDurationSSA formats an .ssa duration
 func formatDurationSSA(i time.Duration) string {
-	return formatDuration(i, ".", 2)
+	return DurationFormat{Digits: 2, Sep: "."}.Format(i)
 }
 
 // string returns the block as a string
@@ -1162,25 +1550,59 @@ func (e *ssaEvent) string(format []string) string {
 
 // parseDurationSSA parses an .ssa duration
 func parseDurationSSA(i string) (time.Duration, error) {
-	return parseDuration(i, ".", 3)
+	return DurationFormat{Digits: 3, Sep: "."}.Parse(i)
 }
 
 // WriteToSSA writes subtitles in .ssa format
 func (s Subtitles) WriteToSSA(o io.Writer) (err error) {
+	return s.writeToSSA(o, false, SSAOptions{})
+}
+
+// WriteToSSAWithOptions writes subtitles in .ssa format with options
+func (s Subtitles) WriteToSSAWithOptions(o io.Writer, opts SSAOptions) (err error) {
+	return s.writeToSSA(o, false, opts)
+}
+
+// WriteToASS writes subtitles in .ass format, which is the v4.00+ version of the .ssa format.
+// Style alignments read from v4.00 files are converted to their v4.00+ numpad equivalent.
+func (s Subtitles) WriteToASS(o io.Writer) (err error) {
+	return s.writeToSSA(o, true, SSAOptions{})
+}
+
+// WriteToASSWithOptions writes subtitles in .ass format with options
+func (s Subtitles) WriteToASSWithOptions(o io.Writer, opts SSAOptions) (err error) {
+	return s.writeToSSA(o, true, opts)
+}
+
+// writeToSSA writes subtitles in .ssa format. If ass is true, the v4.00+ version is enforced
+func (s Subtitles) writeToSSA(o io.Writer, ass bool, opts SSAOptions) (err error) {
 	// Do not write anything if no subtitles
 	if len(s.Items) == 0 {
 		err = ErrNoSubtitlesToWrite
 		return
 	}
 
+	// Blocks are built with LF line endings, texts can't contain any since new lines are escaped
+	write := func(b []byte) (err error) {
+		if opts.CRLF {
+			b = bytes.ReplaceAll(b, bytesLineSeparator, []byte("\r\n"))
+		}
+		_, err = o.Write(b)
+		return
+	}
+
 	// Write Script Info block
 	var si = newSSAScriptInfo(s.Metadata)
-	if _, err = o.Write(si.bytes()); err != nil {
+	var legacyAlignments = ass && si.scriptType == ssaScriptTypeV4
+	if ass {
+		si.scriptType = ssaScriptTypeV4Plus
+	}
+	if err = write(si.bytes()); err != nil {
 		err = fmt.Errorf("astisub: writing script info block failed: %w", err)
 		return
 	}
 
-	var v4plus = s.Metadata.SSAScriptType == "v4.00+"
+	var v4plus = si.scriptType == ssaScriptTypeV4Plus
 
 	// Write Styles block
 	if len(s.Styles) > 0 {
@@ -1193,11 +1615,27 @@ func (s Subtitles) WriteToSSA(o io.Writer) (err error) {
 		// Format
 		var formatMap = make(map[string]bool)
 		var format = []string{ssaStyleFormatNameName}
+		var defaults map[string]string
+		if ass {
+			format = ssaV4PlusStyleFormat
+			defaults = ssaV4PlusStyleDefaults
+		}
+		// Styles are looped through in a deterministic order since it impacts the format
+		var ids []string
+		for id := range s.Styles {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
 		var styles = make(map[string]*ssaStyle)
 		var styleNames []string
-		for _, s := range s.Styles {
-			var ss = newSSAStyleFromStyle(*s)
-			format = ss.updateFormat(formatMap, format)
+		for _, id := range ids {
+			var ss = newSSAStyleFromStyle(*s.Styles[id])
+			if !ass {
+				format = ss.updateFormat(formatMap, format)
+			} else if legacyAlignments && ss.alignment != nil {
+				ss.alignment = astikit.IntPtr(ssaNumpadAlignment(*ss.alignment))
+			}
 			styles[ss.name] = ss
 			styleNames = append(styleNames, ss.name)
 		}
@@ -1206,11 +1644,11 @@ func (s Subtitles) WriteToSSA(o io.Writer) (err error) {
 		// Styles
 		sort.Strings(styleNames)
 		for _, n := range styleNames {
-			b = append(b, []byte("Style: "+styles[n].string(format)+"\n")...)
+			b = append(b, []byte("Style: "+styles[n].string(format, defaults)+"\n")...)
 		}
 
 		// Write
-		if _, err = o.Write(b); err != nil {
+		if err = write(b); err != nil {
 			err = fmt.Errorf("astisub: writing styles block failed: %w", err)
 			return
 		}
@@ -1237,8 +1675,17 @@ func (s Subtitles) WriteToSSA(o io.Writer) (err error) {
 		if v4plus {
 			format[0] = ssaEventFormatNameLayer
 		}
+		// Items are written in their declaration order if requested and if all of them have one
+		items := s.Items
+		if opts.KeepEventOrder && ssaItemsHaveIndexes(items) {
+			items = make([]*Item, len(s.Items))
+			copy(items, s.Items)
+			sort.SliceStable(items, func(i, j int) bool {
+				return items[i].Index < items[j].Index
+			})
+		}
 		var events []*ssaEvent
-		for _, i := range s.Items {
+		for _, i := range items {
 			events = append(events, newSSAEventFromItem(*i))
 		}
 		format = append(format, ssaEventFormatNameText)
@@ -1246,11 +1693,11 @@ func (s Subtitles) WriteToSSA(o io.Writer) (err error) {
 
 		// Styles
 		for _, e := range events {
-			b = append(b, []byte(ssaEventCategoryDialogue+": "+e.string(format)+"\n")...)
+			b = append(b, []byte(e.category+": "+e.string(format)+"\n")...)
 		}
 
 		// Write
-		if _, err = o.Write(b); err != nil {
+		if err = write(b); err != nil {
 			err = fmt.Errorf("astisub: writing events block failed: %w", err)
 			return
 		}
@@ -1258,8 +1705,131 @@ func (s Subtitles) WriteToSSA(o io.Writer) (err error) {
 	return
 }
 
+// EnsureSSADefaults makes sure subtitles can be written as a playable .ass file: it adds a "Default" style
+// scaled to the play resolution, assigns it to items without style and sets the play resolution
+func (s *Subtitles) EnsureSSADefaults(playResX, playResY int) {
+	// Update metadata
+	if s.Metadata == nil {
+		s.Metadata = &Metadata{}
+	}
+	s.Metadata.SSAPlayResX = astikit.IntPtr(playResX)
+	s.Metadata.SSAPlayResY = astikit.IntPtr(playResY)
+	if s.Metadata.SSAScriptType == "" {
+		s.Metadata.SSAScriptType = ssaScriptTypeV4Plus
+	}
+
+	// Add default style
+	if s.Styles == nil {
+		s.Styles = make(map[string]*Style)
+	}
+	st, ok := s.Styles[ssaDefaultStyleName]
+	if !ok {
+		st = &Style{
+			ID: ssaDefaultStyleName,
+			InlineStyle: &StyleAttributes{
+				SSAAlignment:       astikit.IntPtr(ssaAlignmentCentered),
+				SSABackColour:      &Color{Alpha: 128},
+				SSABold:            astikit.BoolPtr(false),
+				SSABorderStyle:     astikit.IntPtr(ssaBorderStyleOutlineAndDropShadow),
+				SSAEncoding:        astikit.IntPtr(1),
+				SSAFontName:        "Arial",
+				SSAFontSize:        astikit.Float64Ptr(float64(ssaReferenceFontSize * playResY / ssaReferencePlayResY)),
+				SSAItalic:          astikit.BoolPtr(false),
+				SSAMarginLeft:      astikit.IntPtr(ssaReferenceMargin * playResX / ssaReferencePlayResX),
+				SSAMarginRight:     astikit.IntPtr(ssaReferenceMargin * playResX / ssaReferencePlayResX),
+				SSAMarginVertical:  astikit.IntPtr(ssaReferenceMargin * playResY / ssaReferencePlayResY),
+				SSAOutline:         astikit.Float64Ptr(float64(ssaReferenceOutlineWidth * playResY / ssaReferencePlayResY)),
+				SSAOutlineColour:   ColorBlack,
+				SSAPrimaryColour:   ColorWhite,
+				SSASecondaryColour: ColorRed,
+				SSAShadow:          astikit.Float64Ptr(0),
+			},
+		}
+		s.Styles[ssaDefaultStyleName] = st
+	}
+
+	// Assign default style
+	for _, i := range s.Items {
+		if i.Style == nil {
+			i.Style = st
+		}
+	}
+}
+
+// ssaFindStyle finds the style an event references. Style names are kept as is in styles, but surrounding spaces
+// and a leading "*" are ignored when comparing them with the reference.
+func ssaFindStyle(styles map[string]*Style, name string, caseInsensitive bool) *Style {
+	// Exact match
+	if s, ok := styles[name]; ok {
+		return s
+	}
+
+	// Get ids in a deterministic order
+	var ids []string
+	for id := range styles {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	// Sometimes there's an "*" before the style name (e.g. with ffmpeg)
+	n := strings.TrimPrefix(strings.TrimSpace(name), "*")
+	for _, id := range ids {
+		if strings.TrimSpace(id) == n {
+			return styles[id]
+		}
+	}
+
+	// Case insensitive match
+	if caseInsensitive {
+		for _, id := range ids {
+			if strings.EqualFold(strings.TrimSpace(id), n) {
+				return styles[id]
+			}
+		}
+	}
+	return nil
+}
+
+// ssaNumpadAlignment converts a v4.00 alignment, where 1-3 are subtitles, 5-7 toptitles and 9-11 midtitles,
+// to a v4.00+ alignment which follows the numpad layout
+func ssaNumpadAlignment(i int) int {
+	switch {
+	case i >= 5 && i <= 7:
+		return i + 2
+	case i >= 9 && i <= 11:
+		return i - 5
+	}
+	return i
+}
+
+// ssaItemsHaveIndexes checks whether all items have an index
+func ssaItemsHaveIndexes(is []*Item) bool {
+	for _, i := range is {
+		if i.Index <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // SSAOptions
 type SSAOptions struct {
+	// Events referencing styles are matched with style names case-insensitively
+	CaseInsensitiveStyleNames bool
+	// Written files use CRLF line endings instead of LF
+	CRLF bool
+	// "Comment" events are read as items flagged with InlineStyle.SSAComment so that they can be written back as is.
+	// Beware, other formats will write them as regular items.
+	KeepCommentEvents bool
+	// Events with an empty text, e.g. timing markers in karaoke templates, are kept as items without lines
+	KeepEmptyItems bool
+	// Written events are sorted by Item.Index, i.e. their declaration order when they were read,
+	// provided all items have one. Otherwise they're written in items order.
+	KeepEventOrder bool
+	// The original unparsed text of each event, override blocks included, is stored in Item.Raw
+	KeepRawText bool
+	// If > 0, reading fails with ErrMaxItemsExceeded as soon as more events are parsed
+	MaxItems             int
 	OnUnknownSectionName func(name string)
 	OnInvalidLine        func(line string)
 }
@@ -2,12 +2,18 @@ package astisub_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/asticode/go-astikit"
 	"github.com/asticode/go-astisub"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func assertSSAStyle(t *testing.T, e, a astisub.Style) {
@@ -122,6 +128,27 @@ func TestSSAv4plus(t *testing.T) {
 	assert.Equal(t, string(c), w.String())
 }
 
+func TestSubtitles_EnsureSSADefaults(t *testing.T) {
+	s, err := astisub.OpenFile("./testdata/example-in.srt")
+	assert.NoError(t, err)
+	s.EnsureSSADefaults(1920, 1080)
+	assert.Equal(t, 1920, *s.Metadata.SSAPlayResX)
+	assert.Equal(t, 1080, *s.Metadata.SSAPlayResY)
+	assert.Equal(t, "v4.00+", s.Metadata.SSAScriptType)
+	assert.Len(t, s.Styles, 1)
+	assert.Equal(t, float64(75), *s.Styles["Default"].InlineStyle.SSAFontSize)
+	assert.Equal(t, astisub.ColorWhite, s.Styles["Default"].InlineStyle.SSAPrimaryColour)
+	for _, i := range s.Items {
+		assert.Equal(t, s.Styles["Default"], i.Style)
+	}
+
+	w := &bytes.Buffer{}
+	err = s.WriteToSSA(w)
+	assert.NoError(t, err)
+	assert.Contains(t, w.String(), "[V4+ Styles]")
+	assert.Contains(t, w.String(), "Dialogue: 0,00:01:39.00,00:01:41.04,Default,")
+}
+
 func TestInBetweenSSAEffect(t *testing.T) {
 	s, err := astisub.ReadFromSSA(bytes.NewReader([]byte(`[Events]
 Format: Marked, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
@@ -134,3 +161,496 @@ Dialogue: Marked=0,0:01:39.00,0:01:41.04,,Cher,1234,2345,3456,test,First item{\p
 		Text:        "Second item",
 	}, s.Items[0].Lines[0].Items[1])
 }
+
+func TestSSAConcatenated(t *testing.T) {
+	s, err := astisub.ReadFromSSA(bytes.NewReader([]byte(`[Script Info]
+Title: First
+ScriptType: v4.00+
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+Dialogue: 0,0:00:01.00,0:00:02.00,,,0,0,0,,First item
+
+[Script Info]
+Title: Second
+ScriptType: v4.00+
+
+[Events]
+Format: Start, End, Text
+Dialogue: 0:00:03.00,0:00:04.00,Second item`)))
+	assert.NoError(t, err)
+	assert.Equal(t, "First", s.Metadata.Title)
+	assert.Len(t, s.Items, 2)
+	assert.Equal(t, "First item", s.Items[0].String())
+	assert.Equal(t, "Second item", s.Items[1].String())
+}
+
+func TestSSAAnimations(t *testing.T) {
+	s, err := astisub.ReadFromSSA(bytes.NewReader([]byte(`[Events]
+Format: Start, End, Text
+Dialogue: 0:00:01.00,0:00:04.00,{\fad(200,300)\pos(10,20)}First{\move(1,2,3.5,4,100,900)}Second`)))
+	assert.NoError(t, err)
+	assert.Len(t, s.Items[0].Lines[0].Items, 2)
+	sa := s.Items[0].Lines[0].Items[0].InlineStyle
+	assert.Equal(t, "{\\pos(10,20)}", sa.SSAEffect)
+	assert.Equal(t, 200*time.Millisecond, sa.SSAFadeIn)
+	assert.Equal(t, 300*time.Millisecond, sa.SSAFadeOut)
+	sa = s.Items[0].Lines[0].Items[1].InlineStyle
+	assert.Equal(t, "", sa.SSAEffect)
+	assert.Equal(t, &astisub.SSAMove{EndAt: 900 * time.Millisecond, StartAt: 100 * time.Millisecond, X1: 1, X2: 3.5, Y1: 2, Y2: 4}, sa.SSAMove)
+
+	// Edit and write
+	s.Items[0].Lines[0].Items[0].InlineStyle.SSAFadeOut = 500 * time.Millisecond
+	w := &bytes.Buffer{}
+	err = s.WriteToSSA(w)
+	assert.NoError(t, err)
+	assert.Contains(t, w.String(), "{\\fad(200,500)\\pos(10,20)}First {\\move(1,2,3.5,4,100,900)}Second")
+}
+
+func TestWriteToASS(t *testing.T) {
+	s, err := astisub.OpenFile("./testdata/example-in.ssa")
+	assert.NoError(t, err)
+	s.Metadata.SSAScriptType = "v4.00"
+
+	// SSA
+	w := &bytes.Buffer{}
+	err = s.WriteToSSA(w)
+	assert.NoError(t, err)
+	assert.Contains(t, w.String(), "ScriptType: v4.00\n")
+	assert.Contains(t, w.String(), "[V4 Styles]")
+
+	// ASS
+	w = &bytes.Buffer{}
+	err = s.WriteToASS(w)
+	assert.NoError(t, err)
+	assert.Contains(t, w.String(), "ScriptType: v4.00+\n")
+	assert.Contains(t, w.String(), "[V4+ Styles]\nFormat: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, Strikeout, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding\n")
+	assert.Contains(t, w.String(), "Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n")
+}
+
+func TestSSAToASSAlignment(t *testing.T) {
+	s, err := astisub.ReadFromSSA(strings.NewReader(`[Script Info]
+ScriptType: v4.00
+
+[V4 Styles]
+Format: Name, Alignment
+Style: Bottom,1
+Style: Mid,10
+Style: Top,6
+
+[Events]
+Format: Marked, Start, End, Style, Text
+Dialogue: Marked=0,0:00:01.00,0:00:02.00,Top,Text`))
+	require.NoError(t, err)
+
+	// Write
+	w := &bytes.Buffer{}
+	err = s.WriteToASS(w)
+	require.NoError(t, err)
+
+	// Read
+	s, err = astisub.ReadFromSSA(bytes.NewReader(w.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, astikit.IntPtr(1), s.Styles["Bottom"].InlineStyle.SSAAlignment)
+	assert.Equal(t, astikit.IntPtr(5), s.Styles["Mid"].InlineStyle.SSAAlignment)
+	assert.Equal(t, astikit.IntPtr(8), s.Styles["Top"].InlineStyle.SSAAlignment)
+}
+
+func TestSSAContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := astisub.ReadFromSSAContext(ctx, strings.NewReader("[Script Info]\n"), astisub.SSAOptions{})
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestSSAHardSpace(t *testing.T) {
+	s, err := astisub.ReadFromSSA(bytes.NewReader([]byte(`[Events]
+Format: Start, End, Text
+Dialogue: 0:00:01.00,0:00:02.00,Hard\hspace{\i1}and\hmore`)))
+	assert.NoError(t, err)
+	assert.Equal(t, []astisub.LineItem{
+		{Text: "Hard\u00a0space"},
+		{InlineStyle: &astisub.StyleAttributes{SSAEffect: "{\\i1}"}, Text: "and\u00a0more"},
+	}, s.Items[0].Lines[0].Items)
+
+	// Convert
+	w := &bytes.Buffer{}
+	err = s.WriteToSRT(w)
+	assert.NoError(t, err)
+	assert.NotContains(t, w.String(), "\\h")
+
+	// Write
+	w.Reset()
+	err = s.WriteToSSA(w)
+	assert.NoError(t, err)
+	assert.Contains(t, w.String(), "Hard\\hspace {\\i1}and\\hmore")
+}
+
+func TestSSAVoiceName(t *testing.T) {
+	// Read
+	s, err := astisub.ReadFromSSA(bytes.NewReader([]byte(`[Events]
+Format: Start, End, Name, Text
+Dialogue: 0:00:01.00,0:00:02.00,Cher,First line\NSecond line`)))
+	assert.NoError(t, err)
+	assert.Len(t, s.Items[0].Lines, 2)
+	assert.Equal(t, "Cher", s.Items[0].Lines[0].VoiceName)
+	assert.Equal(t, "Cher", s.Items[0].Lines[1].VoiceName)
+
+	// SSA to WebVTT
+	w := &bytes.Buffer{}
+	err = s.WriteToWebVTT(w)
+	assert.NoError(t, err)
+	assert.Contains(t, w.String(), "<v Cher>First line\n<v Cher>Second line\n")
+
+	// WebVTT to SSA
+	s, err = astisub.ReadFromWebVTT(strings.NewReader(w.String()))
+	assert.NoError(t, err)
+	s.Items[0].Lines[1].VoiceName = "Other"
+	w.Reset()
+	err = s.WriteToSSA(w)
+	assert.NoError(t, err)
+	assert.Contains(t, w.String(), ",Cher,")
+	assert.NotContains(t, w.String(), "Other")
+}
+
+func TestSSAStyleNames(t *testing.T) {
+	const i = `[V4+ Styles]
+Format: Name, Fontsize
+Style: Main,20
+Style: Top ,30
+Style: TOP,40
+
+[Events]
+Format: Start, End, Style, Text
+Dialogue: 0:00:01.00,0:00:02.00,*Main,1
+Dialogue: 0:00:02.00,0:00:03.00,Main ,2
+Dialogue: 0:00:03.00,0:00:04.00,Top,3
+Dialogue: 0:00:04.00,0:00:05.00,main,4
+Dialogue: 0:00:05.00,0:00:06.00,top,5`
+
+	// Default
+	s, err := astisub.ReadFromSSA(strings.NewReader(i))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 5)
+	assert.Equal(t, s.Styles["Main"], s.Items[0].Style)
+	assert.Equal(t, s.Styles["Main"], s.Items[1].Style)
+	assert.Equal(t, s.Styles["Top "], s.Items[2].Style)
+	assert.Nil(t, s.Items[3].Style)
+
+	// Case insensitive
+	s, err = astisub.ReadFromSSAWithOptions(strings.NewReader(i), astisub.SSAOptions{CaseInsensitiveStyleNames: true})
+	require.NoError(t, err)
+	assert.Equal(t, s.Styles["Main"], s.Items[3].Style)
+	for idx := 0; idx < 10; idx++ {
+		s, err = astisub.ReadFromSSAWithOptions(strings.NewReader(i), astisub.SSAOptions{CaseInsensitiveStyleNames: true})
+		require.NoError(t, err)
+		assert.Equal(t, s.Styles["TOP"], s.Items[4].Style)
+	}
+}
+
+func TestSSAStarredStyleNames(t *testing.T) {
+	s, err := astisub.ReadFromSSA(strings.NewReader(`[V4+ Styles]
+Format: Name, Fontsize
+Style: eng,20
+Style: chs,30
+
+[Events]
+Format: Start, End, Style, Text
+Dialogue: 0:00:01.00,0:00:02.00,*eng,Hello
+Dialogue: 0:00:01.00,0:00:02.00,*chs,你好`))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 2)
+	assert.Equal(t, s.Styles["eng"], s.Items[0].Style)
+	assert.Equal(t, s.Styles["chs"], s.Items[1].Style)
+
+	// Convert
+	w := &bytes.Buffer{}
+	err = s.WriteToWebVTT(w)
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), "Hello")
+	assert.Contains(t, w.String(), "你好")
+}
+
+func TestSSACommentEvents(t *testing.T) {
+	const i = `[Script Info]
+; First comment
+; Second comment
+
+[Events]
+Format: Start, End, Text
+Dialogue: 0:00:01.00,0:00:02.00,First
+Comment: 0:00:02.00,0:00:03.00,Translator note
+Dialogue: 0:00:03.00,0:00:04.00,Second`
+
+	// Default
+	s, err := astisub.ReadFromSSA(strings.NewReader(i))
+	require.NoError(t, err)
+	assert.Len(t, s.Items, 2)
+
+	// Keep comment events
+	s, err = astisub.ReadFromSSAWithOptions(strings.NewReader(i), astisub.SSAOptions{KeepCommentEvents: true})
+	require.NoError(t, err)
+	require.Len(t, s.Items, 3)
+	assert.True(t, s.Items[1].InlineStyle.SSAComment)
+	assert.False(t, s.Items[0].InlineStyle.SSAComment)
+
+	// Write
+	w := &bytes.Buffer{}
+	err = s.WriteToSSA(w)
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), "; First comment\n; Second comment\n")
+	assert.Contains(t, w.String(), "Dialogue: Marked=0,00:00:01.00,00:00:02.00,,,0,0,0,,First\nComment: Marked=0,00:00:02.00,00:00:03.00,,,0,0,0,,Translator note\nDialogue: Marked=0,00:00:03.00,00:00:04.00,,,0,0,0,,Second\n")
+}
+
+func TestSSAFractionalOutlineAndShadow(t *testing.T) {
+	s, err := astisub.ReadFromSSA(strings.NewReader(`[V4+ Styles]
+Format: Name, Outline, Shadow
+Style: Default,1.5,0.5
+
+[Events]
+Format: Start, End, Style, Text
+Dialogue: 0:00:01.00,0:00:02.00,Default,Text`))
+	require.NoError(t, err)
+	st := s.Styles["Default"]
+	require.NotNil(t, st)
+	assert.Equal(t, astikit.Float64Ptr(1.5), st.InlineStyle.SSAOutline)
+	assert.Equal(t, astikit.Float64Ptr(0.5), st.InlineStyle.SSAShadow)
+
+	// Write
+	w := &bytes.Buffer{}
+	err = s.WriteToSSA(w)
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), "Style: Default,1.500,0.500\n")
+}
+
+func TestSSAScaledBorderAndShadowAndYCbCrMatrix(t *testing.T) {
+	s, err := astisub.ReadFromSSA(strings.NewReader(`[Script Info]
+ScaledBorderAndShadow: yes
+YCbCr Matrix: TV.709
+
+[Events]
+Format: Start, End, Text
+Dialogue: 0:00:01.00,0:00:02.00,Text`))
+	require.NoError(t, err)
+	assert.Equal(t, "yes", s.Metadata.SSAScaledBorderAndShadow)
+	assert.Equal(t, "TV.709", s.Metadata.SSAYCbCrMatrix)
+
+	// Write
+	w := &bytes.Buffer{}
+	err = s.WriteToASS(w)
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), "ScaledBorderAndShadow: yes\n")
+	assert.Contains(t, w.String(), "YCbCr Matrix: TV.709\n")
+}
+
+func TestSSAEmptyText(t *testing.T) {
+	const i = `[Events]
+Format: Start, End, Text
+Dialogue: 0:00:01.00,0:00:02.00,
+Dialogue: 0:00:02.00,0:00:03.00,Text
+Dialogue: 0:00:03.00,0:00:04.00, `
+
+	// Default
+	s, err := astisub.ReadFromSSA(strings.NewReader(i))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 1)
+	assert.Equal(t, "Text", s.Items[0].String())
+
+	// Keep empty items
+	s, err = astisub.ReadFromSSAWithOptions(strings.NewReader(i), astisub.SSAOptions{KeepEmptyItems: true})
+	require.NoError(t, err)
+	require.Len(t, s.Items, 3)
+	assert.Empty(t, s.Items[0].Lines)
+	assert.Equal(t, time.Second, s.Items[0].StartAt)
+	assert.Empty(t, s.Items[2].Lines)
+
+	// Write
+	w := &bytes.Buffer{}
+	err = s.WriteToSSA(w)
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), "Dialogue: Marked=0,00:00:01.00,00:00:02.00,,,0,0,0,,\n")
+}
+
+func TestSSADeclarationOrder(t *testing.T) {
+	s, err := astisub.ReadFromSSA(strings.NewReader(`[Events]
+Format: Start, End, Text
+Dialogue: 0:00:02.00,0:00:03.00,Third
+Dialogue: 0:00:01.00,0:00:02.00,Top
+Dialogue: 0:00:01.00,0:00:02.00,Bottom`))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 3)
+	assert.Equal(t, 1, s.Items[0].Index)
+	assert.Equal(t, 2, s.Items[1].Index)
+	assert.Equal(t, 3, s.Items[2].Index)
+	assert.Equal(t, s.Items[1].InlineStyle, s.Items[2].InlineStyle)
+
+	// Write in items order by default
+	s.Order()
+	assert.Equal(t, "Top", s.Items[0].String())
+	w := &bytes.Buffer{}
+	err = s.WriteToSSA(w)
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), ",Top\nDialogue: Marked=0,00:00:01.00,00:00:02.00,,,0,0,0,,Bottom\nDialogue: Marked=0,00:00:02.00,00:00:03.00,,,0,0,0,,Third\n")
+
+	// Write in declaration order
+	w.Reset()
+	err = s.WriteToSSAWithOptions(w, astisub.SSAOptions{KeepEventOrder: true})
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), ",Third\nDialogue: Marked=0,00:00:01.00,00:00:02.00,,,0,0,0,,Top\nDialogue: Marked=0,00:00:01.00,00:00:02.00,,,0,0,0,,Bottom\n")
+
+	// Write in items order when some event orders are missing
+	s.Items[0].Index = 0
+	w.Reset()
+	err = s.WriteToSSAWithOptions(w, astisub.SSAOptions{KeepEventOrder: true})
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), ",Top\nDialogue: Marked=0,00:00:01.00,00:00:02.00,,,0,0,0,,Bottom\nDialogue: Marked=0,00:00:02.00,00:00:03.00,,,0,0,0,,Third\n")
+}
+
+func TestSSAMergeOrder(t *testing.T) {
+	const i = `[Events]
+Format: Start, End, Text
+Dialogue: 0:00:01.00,0:00:02.00,%[1]s1
+Dialogue: 0:00:03.00,0:00:04.00,%[1]s2`
+	s1, err := astisub.ReadFromSSA(strings.NewReader(fmt.Sprintf(i, "A")))
+	require.NoError(t, err)
+	s2, err := astisub.ReadFromSSA(strings.NewReader(fmt.Sprintf(i, "B")))
+	require.NoError(t, err)
+	s2.Add(10 * time.Second)
+	s1.Merge(s2)
+
+	// Merged events must not be interleaved based on indexes
+	w := &bytes.Buffer{}
+	err = s1.WriteToSSA(w)
+	require.NoError(t, err)
+	assert.Regexp(t, `(?s),A1\n.*,A2\n.*,B1\n.*,B2\n`, w.String())
+}
+
+func TestSSAStyleResets(t *testing.T) {
+	s, err := astisub.ReadFromSSA(strings.NewReader(`[V4+ Styles]
+Format: Name, Fontsize
+Style: Main,20
+Style: Alt,30
+
+[Events]
+Format: Start, End, Style, Text
+Dialogue: 0:00:01.00,0:00:02.00,Main,a {\i1\rAlt\b1}b\Nc{\r}d`))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 1)
+	require.Len(t, s.Items[0].Lines, 2)
+	assert.Equal(t, s.Styles["Main"], s.Items[0].Style)
+	l1, l2 := s.Items[0].Lines[0], s.Items[0].Lines[1]
+	require.Len(t, l1.Items, 2)
+	assert.Nil(t, l1.Items[0].Style)
+	assert.Equal(t, s.Styles["Alt"], l1.Items[1].Style)
+	assert.Equal(t, `{\b1}`, l1.Items[1].InlineStyle.SSAEffect)
+	require.Len(t, l2.Items, 2)
+	assert.Equal(t, s.Styles["Alt"], l2.Items[0].Style)
+	assert.Nil(t, l2.Items[1].Style)
+	assert.Equal(t, "", l2.Items[1].InlineStyle.SSAEffect)
+
+	// Write
+	w := &bytes.Buffer{}
+	err = s.WriteToSSA(w)
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), `,a  {\rAlt\b1}b\nc {\r}d`)
+}
+
+func TestSSAEventEffects(t *testing.T) {
+	s, err := astisub.ReadFromSSA(strings.NewReader(`[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+Dialogue: 0,0:00:01.00,0:00:05.00,,,0,0,0,Scroll up;40;320;2;10,Credits
+Dialogue: 0,0:00:06.00,0:00:08.00,,,0,0,0,banner;5;1,Banner
+Dialogue: 0,0:00:09.00,0:00:10.00,,,0,0,0,Scroll up;invalid,Raw`))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 3)
+	assert.Equal(t, &astisub.SSAEventEffect{Delay: 2, FadeAway: 10, Name: astisub.SSAEventEffectNameScrollUp, Y1: 40, Y2: 320}, s.Items[0].InlineStyle.SSAEventEffect)
+	assert.Equal(t, "", s.Items[0].InlineStyle.SSAEffect)
+	assert.Equal(t, "Credits", s.Items[0].String())
+	assert.Equal(t, &astisub.SSAEventEffect{Delay: 5, LeftToRight: true, Name: astisub.SSAEventEffectNameBanner}, s.Items[1].InlineStyle.SSAEventEffect)
+	assert.Nil(t, s.Items[2].InlineStyle.SSAEventEffect)
+	assert.Equal(t, "Scroll up;invalid", s.Items[2].InlineStyle.SSAEffect)
+
+	// Write
+	w := &bytes.Buffer{}
+	err = s.WriteToSSA(w)
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), ",Scroll up;40;320;2;10,Credits")
+	assert.Contains(t, w.String(), ",Banner;5;1,Banner")
+	assert.Contains(t, w.String(), ",Scroll up;invalid,Raw")
+}
+
+func TestSSACRLF(t *testing.T) {
+	s := mockSubtitles()
+
+	// Default
+	w := &bytes.Buffer{}
+	err := s.WriteToSSA(w)
+	require.NoError(t, err)
+	assert.NotContains(t, w.String(), "\r")
+
+	// CRLF
+	w2 := &bytes.Buffer{}
+	err = s.WriteToASSWithOptions(w2, astisub.SSAOptions{CRLF: true})
+	require.NoError(t, err)
+	assert.Equal(t, strings.Count(w2.String(), "\n"), strings.Count(w2.String(), "\r\n"))
+	assert.Contains(t, w2.String(), "[Script Info]\r\n")
+	assert.Contains(t, w2.String(), "[Events]\r\n")
+
+	// Read
+	s2, err := astisub.ReadFromSSA(bytes.NewReader(w2.Bytes()))
+	require.NoError(t, err)
+	require.Len(t, s2.Items, 2)
+	assert.Equal(t, "subtitle-2", s2.Items[1].String())
+}
+
+func TestSSAMixedEventNames(t *testing.T) {
+	const i = `[Script Info]
+ScriptType: v4.00+
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+Dialogue: 0,0:00:01.00,0:00:02.00,Default,Alice,0,0,0,,named
+Dialogue: 0,0:00:03.00,0:00:04.00,Default,,0,0,0,,unnamed
+`
+	s, err := astisub.ReadFromSSA(strings.NewReader(i))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 2)
+	assert.Equal(t, "Alice", s.Items[0].Lines[0].VoiceName)
+	assert.Equal(t, "", s.Items[1].Lines[0].VoiceName)
+
+	// Empty names are written as empty fields
+	w := &bytes.Buffer{}
+	err = s.WriteToASS(w)
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), "Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n")
+	assert.Contains(t, w.String(), "Dialogue: 0,00:00:01.00,00:00:02.00,,Alice,0,0,0,,named\n")
+	assert.Contains(t, w.String(), "Dialogue: 0,00:00:03.00,00:00:04.00,,,0,0,0,,unnamed\n")
+
+	// Round trip
+	s, err = astisub.ReadFromSSA(bytes.NewReader(w.Bytes()))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 2)
+	assert.Equal(t, "Alice", s.Items[0].Lines[0].VoiceName)
+	assert.Equal(t, "", s.Items[1].Lines[0].VoiceName)
+	assert.Equal(t, "unnamed", s.Items[1].String())
+}
+
+func TestSSAStylesFormatOrder(t *testing.T) {
+	b := true
+	f := 20.0
+	s := mockSubtitles()
+	s.Styles = map[string]*astisub.Style{
+		"a": {ID: "a", InlineStyle: &astisub.StyleAttributes{SSABold: &b}},
+		"b": {ID: "b", InlineStyle: &astisub.StyleAttributes{SSAFontSize: &f}},
+	}
+	var o string
+	for idx := 0; idx < 10; idx++ {
+		w := &bytes.Buffer{}
+		require.NoError(t, s.WriteToSSA(w))
+		if idx == 0 {
+			o = w.String()
+		}
+		assert.Equal(t, o, w.String())
+	}
+	assert.Contains(t, o, "Format: Name, Bold, Fontsize\n")
+}
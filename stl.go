@@ -10,6 +10,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/asticode/go-astikit"
 	"golang.org/x/text/unicode/norm"
@@ -170,6 +171,9 @@ const extensionBlockNumberReservedUserData = 0xfe
 
 const stlLineSeparator = 0x8a
 
+// TTI text field length
+const stlTextFieldLength = 112
+
 type STLPosition struct {
 	VerticalPosition int
 	MaxRows          int
@@ -178,31 +182,49 @@ type STLPosition struct {
 
 // STLOptions represents STL parsing options
 type STLOptions struct {
+	// FramerateOverride - if > 0, framerate used to parse all timecodes (GSI and TTI) instead of the one declared in the GSI block
+	FramerateOverride int
 	// IgnoreTimecodeStartOfProgramme - set STLTimecodeStartOfProgramme to zero before parsing
 	IgnoreTimecodeStartOfProgramme bool
+	// MaxItems - if > 0, reading fails with ErrMaxItemsExceeded as soon as more items are parsed
+	MaxItems int
+	// ReplaceUnmappedCharacters - decode characters missing from the character code table as U+FFFD instead of
+	// dropping them. Control codes are still dropped
+	ReplaceUnmappedCharacters bool
 }
 
 // ReadFromSTL parses an .stl content
 func ReadFromSTL(i io.Reader, opts STLOptions) (o *Subtitles, err error) {
-	// Init
-	o = NewSubtitles()
-
 	// Read GSI block
-	var b []byte
-	if b, err = readNBytes(i, stlBlockSizeGSI); err != nil {
+	var b = make([]byte, stlBlockSizeGSI)
+	var n int
+	if n, err = io.ReadFull(i, b); err != nil && err != io.ErrUnexpectedEOF {
+		err = fmt.Errorf("astisub: reading %d bytes failed: %w", stlBlockSizeGSI, err)
+		return
+	}
+	err = nil
+
+	// Content is not a binary EBU STL, it may be a text Spruce STL that shares the same extension
+	if !isEBUSTL(b[:n]) {
+		return ReadFromSpruceSTLWithOptions(io.MultiReader(bytes.NewReader(b[:n]), i), SpruceSTLOptions{MaxItems: opts.MaxItems})
+	} else if n != stlBlockSizeGSI {
+		err = fmt.Errorf("astisub: read %d bytes, should have read %d", n, stlBlockSizeGSI)
 		return
 	}
 
+	// Init
+	o = NewSubtitles()
+
 	// Parse GSI block
 	var g *gsiBlock
-	if g, err = parseGSIBlock(b); err != nil {
+	if g, err = parseGSIBlock(b, opts.FramerateOverride); err != nil {
 		err = fmt.Errorf("astisub: building gsi block failed: %w", err)
 		return
 	}
 
 	// Create character handler
 	var ch *stlCharacterHandler
-	if ch, err = newSTLCharacterHandler(g.characterCodeTableNumber); err != nil {
+	if ch, err = newSTLCharacterHandler(g.characterCodeTableNumber, opts.ReplaceUnmappedCharacters); err != nil {
 		err = fmt.Errorf("astisub: creating stl character handler failed: %w", err)
 		return
 	}
@@ -237,6 +259,7 @@ func ReadFromSTL(i io.Reader, opts STLOptions) (o *Subtitles, err error) {
 	}
 
 	// Parse Text and Timing Information (TTI) blocks.
+	var cumulativeItem *Item
 	for {
 		// Read TTI block
 		if b, err = readNBytes(i, stlBlockSizeTTI); err != nil {
@@ -271,10 +294,20 @@ func ReadFromSTL(i io.Reader, opts STLOptions) (o *Subtitles, err error) {
 		styleAttributes.propagateSTLAttributes()
 
 		// Create item
-		var i = &Item{
-			EndAt:       t.timecodeOut - o.Metadata.STLTimecodeStartOfProgramme,
-			InlineStyle: &styleAttributes,
-			StartAt:     t.timecodeIn - o.Metadata.STLTimecodeStartOfProgramme,
+		// Blocks following the first block of a cumulative set are merged into its item
+		var i *Item
+		if cumulativeItem != nil && (t.cumulativeStatus == stlCumulativeStatusIntermediateSubtitleOfACumulativeSet || t.cumulativeStatus == stlCumulativeStatusLastSubtitleOfACumulativeSet) {
+			i = cumulativeItem
+			if endAt := t.timecodeOut - o.Metadata.STLTimecodeStartOfProgramme; endAt > i.EndAt {
+				i.EndAt = endAt
+			}
+			i.InlineStyle.STLPosition.Rows += len(rows)
+		} else {
+			i = &Item{
+				EndAt:       t.timecodeOut - o.Metadata.STLTimecodeStartOfProgramme,
+				InlineStyle: &styleAttributes,
+				StartAt:     t.timecodeIn - o.Metadata.STLTimecodeStartOfProgramme,
+			}
 		}
 
 		// Loop through rows
@@ -290,12 +323,29 @@ func ReadFromSTL(i io.Reader, opts STLOptions) (o *Subtitles, err error) {
 		}
 
 		// Append item
-		o.Items = append(o.Items, i)
+		if i != cumulativeItem {
+			o.Items = append(o.Items, i)
+			if opts.MaxItems > 0 && len(o.Items) > opts.MaxItems {
+				return nil, ErrMaxItemsExceeded
+			}
+		}
 
+		// Update cumulative item
+		switch t.cumulativeStatus {
+		case stlCumulativeStatusFirstSubtitleOfACumulativeSet:
+			cumulativeItem = i
+		case stlCumulativeStatusLastSubtitleOfACumulativeSet, stlCumulativeStatusSubtitleNotPartOfACumulativeSet:
+			cumulativeItem = nil
+		}
 	}
 	return
 }
 
+// isEBUSTL checks whether the beginning of the content contains an EBU STL disk format code
+func isEBUSTL(b []byte) bool {
+	return len(b) >= 11 && bytes.HasPrefix(b[3:11], []byte("STL"))
+}
+
 // readNBytes reads n bytes
 func readNBytes(i io.Reader, c int) (o []byte, err error) {
 	o = make([]byte, c)
@@ -414,7 +464,8 @@ func newGSIBlock(s Subtitles) (g *gsiBlock) {
 }
 
 // parseGSIBlock parses a GSI block
-func parseGSIBlock(b []byte) (g *gsiBlock, err error) {
+// If framerateOverride is > 0, it is used instead of the framerate declared in the block
+func parseGSIBlock(b []byte, framerateOverride int) (g *gsiBlock, err error) {
 	// Init
 	g = &gsiBlock{
 		characterCodeTableNumber:  binary.BigEndian.Uint16(b[12:14]),
@@ -437,7 +488,9 @@ func parseGSIBlock(b []byte) (g *gsiBlock, err error) {
 	}
 
 	// Framerate
-	if v, ok := stlFramerateMapping.Get(string(b[3:11])); ok {
+	if framerateOverride > 0 {
+		g.framerate = framerateOverride
+	} else if v, ok := stlFramerateMapping.Get(string(b[3:11])); ok {
 		g.framerate = v.(int)
 	}
 
@@ -583,73 +636,13 @@ func (b gsiBlock) bytes() (o []byte) {
 }
 
 // parseDurationSTL parses a STL duration
-func parseDurationSTL(i string, framerate int) (d time.Duration, err error) {
-	// Parse hours
-	var hours, hoursString = 0, i[0:2]
-	if hours, err = strconv.Atoi(hoursString); err != nil {
-		err = fmt.Errorf("astisub: atoi of %s failed: %w", hoursString, err)
-		return
-	}
-
-	// Parse minutes
-	var minutes, minutesString = 0, i[2:4]
-	if minutes, err = strconv.Atoi(minutesString); err != nil {
-		err = fmt.Errorf("astisub: atoi of %s failed: %w", minutesString, err)
-		return
-	}
-
-	// Parse seconds
-	var seconds, secondsString = 0, i[4:6]
-	if seconds, err = strconv.Atoi(secondsString); err != nil {
-		err = fmt.Errorf("astisub: atoi of %s failed: %w", secondsString, err)
-		return
-	}
-
-	// Parse frames
-	var frames, framesString = 0, i[6:8]
-	if frames, err = strconv.Atoi(framesString); err != nil {
-		err = fmt.Errorf("astisub: atoi of %s failed: %w", framesString, err)
-		return
-	}
-
-	// Set duration
-	d = time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second + time.Duration(1e9*frames/framerate)*time.Nanosecond
-	return
+func parseDurationSTL(i string, framerate int) (time.Duration, error) {
+	return DurationFormat{FrameRate: framerate, UseFrames: true}.Parse(i)
 }
 
 // formatDurationSTL formats a STL duration
-func formatDurationSTL(d time.Duration, framerate int) (o string) {
-	// Add hours
-	if d.Hours() < 10 {
-		o += "0"
-	}
-	var delta = int(math.Floor(d.Hours()))
-	o += strconv.Itoa(delta)
-	d -= time.Duration(delta) * time.Hour
-
-	// Add minutes
-	if d.Minutes() < 10 {
-		o += "0"
-	}
-	delta = int(math.Floor(d.Minutes()))
-	o += strconv.Itoa(delta)
-	d -= time.Duration(delta) * time.Minute
-
-	// Add seconds
-	if d.Seconds() < 10 {
-		o += "0"
-	}
-	delta = int(math.Floor(d.Seconds()))
-	o += strconv.Itoa(delta)
-	d -= time.Duration(delta) * time.Second
-
-	// Add frames
-	var frames = int(int(d.Nanoseconds()) * framerate / 1e9)
-	if frames < 10 {
-		o += "0"
-	}
-	o += strconv.Itoa(frames)
-	return
+func formatDurationSTL(d time.Duration, framerate int) string {
+	return strings.ReplaceAll(DurationFormat{FrameRate: framerate, Sep: ":", UseFrames: true}.Format(d), ":", "")
 }
 
 // ttiBlock represents a TTI block
@@ -666,8 +659,106 @@ type ttiBlock struct {
 	verticalPosition     int
 }
 
-// newTTIBlock builds an item TTI block
-func newTTIBlock(i *Item, idx int) (t *ttiBlock) {
+// newTTIBlocks builds an item TTI blocks, idx being the first block subtitle number. Lines exceeding maxChars
+// displayable characters are split into several rows and, if rows don't fit in a single text field, they're
+// spread over a cumulative set of blocks
+func newTTIBlocks(i *Item, idx, maxRows, maxChars int) (ts []*ttiBlock) {
+	// Get rows
+	var rows []string
+	for _, l := range i.Lines {
+		var lineItems []string
+		for _, li := range l.Items {
+			lineItems = append(lineItems, li.STLString())
+		}
+		rows = append(rows, stlSplitRow(strings.Join(lineItems, " "), maxChars)...)
+	}
+
+	// Group rows so that they fit in text fields
+	var groups [][]string
+	var size int
+	for _, row := range rows {
+		n := len(encodeTextSTL(row))
+		if len(groups) > 0 && size+1+n <= stlTextFieldLength {
+			groups[len(groups)-1] = append(groups[len(groups)-1], row)
+			size += 1 + n
+		} else {
+			groups = append(groups, []string{row})
+			size = n
+		}
+	}
+	if len(groups) == 0 {
+		groups = append(groups, nil)
+	}
+
+	// Cumulative sets must fit in the displayable rows
+	var rowIdx int
+	if vp := stlVerticalPositionFromStyle(i.InlineStyle, maxRows); len(groups) > 1 && maxRows > 0 && vp+len(rows)-1 > maxRows {
+		rowIdx = maxRows - len(rows) + 1 - vp
+		if vp+rowIdx < 1 {
+			rowIdx = 1 - vp
+		}
+	}
+
+	// Loop through groups
+	for idxGroup, g := range groups {
+		// Create block
+		t := newTTIBlock(i, idx+idxGroup, maxRows)
+		t.text = []byte(strings.Join(g, string(rune(stlLineSeparator))))
+
+		// Cumulative set
+		if len(groups) > 1 {
+			switch idxGroup {
+			case 0:
+				t.cumulativeStatus = stlCumulativeStatusFirstSubtitleOfACumulativeSet
+			case len(groups) - 1:
+				t.cumulativeStatus = stlCumulativeStatusLastSubtitleOfACumulativeSet
+			default:
+				t.cumulativeStatus = stlCumulativeStatusIntermediateSubtitleOfACumulativeSet
+			}
+			t.verticalPosition += rowIdx
+		}
+		rowIdx += len(g)
+		ts = append(ts, t)
+	}
+	return
+}
+
+// stlSplitRow splits a row into rows containing at most max displayable characters. Rows are split on spaces
+// only, which means a word longer than max is not split.
+func stlSplitRow(row string, max int) (rows []string) {
+	// Nothing to do
+	if max <= 0 || stlRowLength(row) <= max {
+		return []string{row}
+	}
+
+	// Loop through words
+	var current string
+	for idx, w := range strings.Split(row, " ") {
+		if idx == 0 {
+			current = w
+		} else if stlRowLength(current)+1+stlRowLength(w) <= max {
+			current += " " + w
+		} else {
+			rows = append(rows, current)
+			current = w
+		}
+	}
+	rows = append(rows, current)
+	return
+}
+
+// stlRowLength returns the number of displayable characters in a row, ignoring control codes
+func stlRowLength(row string) (n int) {
+	for _, r := range row {
+		if r < 0x80 || r > 0x9f {
+			n++
+		}
+	}
+	return
+}
+
+// newTTIBlock builds an item TTI block without text
+func newTTIBlock(i *Item, idx, maxRows int) (t *ttiBlock) {
 	// Init
 	t = &ttiBlock{
 		commentFlag:          stlCommentFlagTextContainsSubtitleData,
@@ -678,19 +769,8 @@ func newTTIBlock(i *Item, idx int) (t *ttiBlock) {
 		subtitleNumber:       idx,
 		timecodeIn:           i.StartAt,
 		timecodeOut:          i.EndAt,
-		verticalPosition:     stlVerticalPositionFromStyle(i.InlineStyle),
+		verticalPosition:     stlVerticalPositionFromStyle(i.InlineStyle, maxRows),
 	}
-
-	// Add text
-	var lines []string
-	for _, l := range i.Lines {
-		var lineItems []string
-		for _, li := range l.Items {
-			lineItems = append(lineItems, li.STLString())
-		}
-		lines = append(lines, strings.Join(lineItems, " "))
-	}
-	t.text = []byte(strings.Join(lines, string(rune(stlLineSeparator))))
 	return
 }
 
@@ -712,12 +792,53 @@ func stlJustificationCodeFromStyle(sa *StyleAttributes) byte {
 	}
 }
 
-func stlVerticalPositionFromStyle(sa *StyleAttributes) int {
+func stlVerticalPositionFromStyle(sa *StyleAttributes, maxRows int) int {
 	if sa != nil && sa.STLPosition != nil {
 		return sa.STLPosition.VerticalPosition
+	} else if sa != nil && sa.WebVTTLine != "" && maxRows > 0 {
+		if vp, ok := stlVerticalPositionFromWebVTTLine(sa.WebVTTLine, maxRows); ok {
+			return vp
+		}
+	}
+	return 20
+}
+
+// stlVerticalPositionFromWebVTTLine converts a WebVTT line to a STL vertical position (row number). It's the
+// inverse of the conversion done in propagateSTLAttributes: integer lines map to rows directly whereas
+// percentages map proportionally
+func stlVerticalPositionFromWebVTTLine(line string, maxRows int) (vp int, ok bool) {
+	// Remove line alignment
+	line = strings.TrimSpace(strings.Split(line, ",")[0])
+
+	// Percentage
+	if strings.HasSuffix(line, "%") {
+		pct, err := strconv.ParseFloat(strings.TrimSuffix(line, "%"), 64)
+		if err != nil {
+			return
+		}
+		vp = int(math.Round(pct * float64(maxRows) / 100))
+		if maxRows == 23 {
+			vp++
+		}
 	} else {
-		return 20
+		var err error
+		if vp, err = strconv.Atoi(line); err != nil {
+			return
+		}
+
+		// Negative lines count from the bottom
+		if vp < 0 {
+			vp = maxRows + vp + 1
+		}
+	}
+
+	// Clamp
+	if vp < 0 {
+		vp = 0
+	} else if vp > maxRows {
+		vp = maxRows
 	}
+	return vp, true
 }
 
 func (li LineItem) STLString() string {
@@ -757,18 +878,31 @@ func (t *ttiBlock) bytes(g *gsiBlock) (o []byte) {
 	o = append(o, byte(uint8(t.subtitleGroupNumber))) // Subtitle group number
 	var b = make([]byte, 2)
 	binary.LittleEndian.PutUint16(b, uint16(t.subtitleNumber))
-	o = append(o, b...)                                                                                              // Subtitle number
-	o = append(o, byte(uint8(t.extensionBlockNumber)))                                                               // Extension block number
-	o = append(o, t.cumulativeStatus)                                                                                // Cumulative status
-	o = append(o, formatDurationSTLBytes(t.timecodeIn, g.framerate)...)                                              // Timecode in
-	o = append(o, formatDurationSTLBytes(t.timecodeOut, g.framerate)...)                                             // Timecode out
-	o = append(o, validateVerticalPosition(t.verticalPosition, g.displayStandardCode))                               // Vertical position
-	o = append(o, t.justificationCode)                                                                               // Justification code
-	o = append(o, t.commentFlag)                                                                                     // Comment flag
-	o = append(o, astikit.BytesPad(encodeTextSTL(string(t.text)), '\x8f', 112, astikit.PadRight, astikit.PadCut)...) // Text field
+	o = append(o, b...)                                                                // Subtitle number
+	o = append(o, byte(uint8(t.extensionBlockNumber)))                                 // Extension block number
+	o = append(o, t.cumulativeStatus)                                                  // Cumulative status
+	o = append(o, formatDurationSTLBytes(t.timecodeIn, g.framerate)...)                // Timecode in
+	o = append(o, formatDurationSTLBytes(t.timecodeOut, g.framerate)...)               // Timecode out
+	o = append(o, validateVerticalPosition(t.verticalPosition, g.displayStandardCode)) // Vertical position
+	o = append(o, t.justificationCode)                                                 // Justification code
+	o = append(o, t.commentFlag)                                                       // Comment flag
+	o = append(o, stlTextField(encodeTextSTL(string(t.text)))...)                      // Text field
 	return
 }
 
+// stlTextField pads or cuts encoded text to the text field length. Text is never cut between a diacritic and the
+// character it applies to.
+func stlTextField(i []byte) []byte {
+	if len(i) > stlTextFieldLength {
+		n := stlTextFieldLength
+		if _, ok := stlUnicodeDiacritic.Get(i[n-1]); ok {
+			n--
+		}
+		i = i[:n]
+	}
+	return astikit.BytesPad(i, '\x8f', stlTextFieldLength, astikit.PadRight, astikit.PadCut)
+}
+
 // According to EBU 3264 (https://tech.ebu.ch/docs/tech/tech3264.pdf):
 // page 12:
 // for teletext subtitles, VP contains a value in the range 1-23 decimal (01h-17h)
@@ -820,16 +954,18 @@ func parseDurationSTLBytes(b []byte, framerate int) time.Duration {
 }
 
 type stlCharacterHandler struct {
-	accent string
-	c      uint16
-	m      *astikit.BiMap
+	accent          string
+	c               uint16
+	m               *astikit.BiMap
+	replaceUnmapped bool
 }
 
-func newSTLCharacterHandler(characterCodeTable uint16) (*stlCharacterHandler, error) {
+func newSTLCharacterHandler(characterCodeTable uint16, replaceUnmapped bool) (*stlCharacterHandler, error) {
 	if v, ok := stlCharacterCodeTables[characterCodeTable]; ok {
 		return &stlCharacterHandler{
-			c: characterCodeTable,
-			m: v,
+			c:               characterCodeTable,
+			m:               v,
+			replaceUnmapped: replaceUnmapped,
 		}, nil
 	}
 	return nil, fmt.Errorf("astisub: table doesn't exist for character code table %d", characterCodeTable)
@@ -845,6 +981,11 @@ func (h *stlCharacterHandler) decode(i byte) (o []byte) {
 	k := int(i)
 	vi, ok := h.m.Get(k)
 	if !ok {
+		// C0 and C1 control codes as well as DEL are never replaced
+		if h.replaceUnmapped && k >= 0x20 && (k < 0x7f || k > 0x9f) {
+			h.accent = ""
+			o = []byte(string(utf8.RuneError))
+		}
 		return
 	}
 	v := vi.(string)
@@ -918,17 +1059,28 @@ func (s Subtitles) WriteToSTL(o io.Writer) (err error) {
 		return
 	}
 
-	// Write GSI block
+	// Create GSI block
 	var g = newGSIBlock(s)
+
+	// Create TTI blocks
+	// Items may need several blocks, therefore totals must be updated
+	var ts []*ttiBlock
+	for _, item := range s.Items {
+		ts = append(ts, newTTIBlocks(item, len(ts)+1, g.maximumNumberOfDisplayableRows, g.maximumNumberOfDisplayableCharactersInAnyTextRow)...)
+	}
+	g.totalNumberOfSubtitles = len(ts)
+	g.totalNumberOfTTIBlocks = len(ts)
+
+	// Write GSI block
 	if _, err = o.Write(g.bytes()); err != nil {
 		err = fmt.Errorf("astisub: writing gsi block failed: %w", err)
 		return
 	}
 
-	// Loop through items
-	for idx, item := range s.Items {
+	// Loop through TTI blocks
+	for idx, t := range ts {
 		// Write tti block
-		if _, err = o.Write(newTTIBlock(item, idx+1).bytes(g)); err != nil {
+		if _, err = o.Write(t.bytes(g)); err != nil {
 			err = fmt.Errorf("astisub: writing tti block #%d failed: %w", idx+1, err)
 			return
 		}
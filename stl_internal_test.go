@@ -1,6 +1,8 @@
 package astisub
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 	"time"
 
@@ -24,7 +26,7 @@ func TestSTLDuration(t *testing.T) {
 }
 
 func TestSTLCharacterHandler(t *testing.T) {
-	h, err := newSTLCharacterHandler(stlCharacterCodeTableNumberLatin)
+	h, err := newSTLCharacterHandler(stlCharacterCodeTableNumberLatin, false)
 	assert.NoError(t, err)
 	o := h.decode(0x1f)
 	assert.Equal(t, []byte(nil), o)
@@ -36,8 +38,20 @@ func TestSTLCharacterHandler(t *testing.T) {
 	assert.Equal(t, []byte("è"), o)
 }
 
+func TestSTLCharacterHandlerReplaceUnmapped(t *testing.T) {
+	h, err := newSTLCharacterHandler(stlCharacterCodeTableNumberLatin, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(nil), h.decode(0xa6))
+	h, err = newSTLCharacterHandler(stlCharacterCodeTableNumberLatin, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("\ufffd"), h.decode(0xa6))
+	assert.Equal(t, []byte(nil), h.decode(0x1f))
+	assert.Equal(t, []byte(nil), h.decode(0x8a))
+	assert.Equal(t, []byte("e"), h.decode(0x65))
+}
+
 func TestSTLCharacterHandlerUmlaut(t *testing.T) {
-	h, err := newSTLCharacterHandler(stlCharacterCodeTableNumberLatin)
+	h, err := newSTLCharacterHandler(stlCharacterCodeTableNumberLatin, false)
 	assert.NoError(t, err)
 
 	o := h.decode(0xc8)
@@ -153,3 +167,76 @@ func TestSTLStyler(t *testing.T) {
 	s.update(sa)
 	assert.Equal(t, StyleAttributes{STLBoxing: s.boxing, STLItalics: s.italics, STLUnderline: s.underline}, *sa)
 }
+
+func TestSTLVerticalPositionFromStyle(t *testing.T) {
+	// STL position
+	assert.Equal(t, 5, stlVerticalPositionFromStyle(&StyleAttributes{STLPosition: &STLPosition{VerticalPosition: 5}, WebVTTLine: "2"}, 23))
+
+	// Default
+	assert.Equal(t, 20, stlVerticalPositionFromStyle(nil, 23))
+	assert.Equal(t, 20, stlVerticalPositionFromStyle(&StyleAttributes{WebVTTLine: "invalid"}, 23))
+
+	// Integer lines
+	assert.Equal(t, 5, stlVerticalPositionFromStyle(&StyleAttributes{WebVTTLine: "5"}, 23))
+	assert.Equal(t, 5, stlVerticalPositionFromStyle(&StyleAttributes{WebVTTLine: "5,start"}, 23))
+	assert.Equal(t, 23, stlVerticalPositionFromStyle(&StyleAttributes{WebVTTLine: "-1"}, 23))
+	assert.Equal(t, 23, stlVerticalPositionFromStyle(&StyleAttributes{WebVTTLine: "50"}, 23))
+
+	// Percentages
+	for _, maxRows := range []int{11, 23} {
+		for vp := 1; vp <= maxRows; vp++ {
+			sa := &StyleAttributes{STLPosition: &STLPosition{MaxRows: maxRows, VerticalPosition: vp}}
+			sa.propagateSTLAttributes()
+			assert.Equal(t, vp, stlVerticalPositionFromStyle(&StyleAttributes{WebVTTLine: sa.WebVTTLine}, maxRows))
+		}
+	}
+}
+
+func TestSTLTextField(t *testing.T) {
+	// Pad
+	assert.Equal(t, append([]byte("a"), bytes.Repeat([]byte{0x8f}, 111)...), stlTextField([]byte("a")))
+
+	// Cut
+	i := encodeTextSTL(strings.Repeat("a", 111) + "é")
+	assert.Len(t, i, 113)
+	o := stlTextField(i)
+	assert.Equal(t, append(bytes.Repeat([]byte("a"), 111), 0x8f), o)
+	i = encodeTextSTL(strings.Repeat("a", 110) + "éa")
+	o = stlTextField(i)
+	assert.Equal(t, append(bytes.Repeat([]byte("a"), 110), 0xc2, 'e'), o)
+}
+
+func TestNewTTIBlocks(t *testing.T) {
+	newLine := func(s string) Line { return Line{Items: []LineItem{{Text: s}}} }
+
+	// Long line
+	ts := newTTIBlocks(&Item{Lines: []Line{newLine("the quick brown fox jumps over the lazy dog again and again")}}, 3, 23, 40)
+	assert.Len(t, ts, 1)
+	assert.Equal(t, 3, ts[0].subtitleNumber)
+	assert.Equal(t, byte(stlCumulativeStatusSubtitleNotPartOfACumulativeSet), ts[0].cumulativeStatus)
+	assert.Equal(t, "the quick brown fox jumps over the lazy\x8adog again and again", string(encodeTextSTL(string(ts[0].text))))
+
+	// Too many rows
+	l := strings.Repeat("a", 38)
+	ts = newTTIBlocks(&Item{Lines: []Line{newLine(l), newLine(l), newLine(l), newLine(l), newLine(l)}}, 1, 23, 40)
+	assert.Len(t, ts, 3)
+	for idx, e := range []struct {
+		cumulativeStatus byte
+		rows             int
+		verticalPosition int
+	}{
+		{cumulativeStatus: stlCumulativeStatusFirstSubtitleOfACumulativeSet, rows: 2, verticalPosition: 19},
+		{cumulativeStatus: stlCumulativeStatusIntermediateSubtitleOfACumulativeSet, rows: 2, verticalPosition: 21},
+		{cumulativeStatus: stlCumulativeStatusLastSubtitleOfACumulativeSet, rows: 1, verticalPosition: 23},
+	} {
+		assert.Equal(t, idx+1, ts[idx].subtitleNumber)
+		assert.Equal(t, e.cumulativeStatus, ts[idx].cumulativeStatus)
+		assert.Equal(t, e.verticalPosition, ts[idx].verticalPosition)
+		assert.Len(t, strings.Split(string(ts[idx].text), string(rune(stlLineSeparator))), e.rows)
+	}
+
+	// No lines
+	ts = newTTIBlocks(&Item{}, 1, 23, 40)
+	assert.Len(t, ts, 1)
+	assert.Empty(t, ts[0].text)
+}
@@ -2,14 +2,18 @@ package astisub_test
 
 import (
 	"bytes"
+	"errors"
+	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/asticode/go-astikit"
 	"github.com/asticode/go-astisub"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSTL(t *testing.T) {
@@ -49,6 +53,12 @@ func TestSTL(t *testing.T) {
 	assert.Equal(t, string(c), w.String())
 }
 
+func TestSTLEmpty(t *testing.T) {
+	_, err := astisub.ReadFromSTL(bytes.NewReader(nil), astisub.STLOptions{})
+	assert.True(t, errors.Is(err, io.EOF))
+	assert.True(t, strings.HasPrefix(err.Error(), "astisub: "))
+}
+
 func TestOPNSTL(t *testing.T) {
 	// Init
 	creationDate, _ := time.Parse("060102", "200110")
@@ -96,3 +106,70 @@ func TestIgnoreTimecodeStartOfProgramme(t *testing.T) {
 	firstStart := 99 * time.Second
 	assert.Equal(t, firstStart, s.Items[0].StartAt, "first start at 0")
 }
+
+func TestSTLFramerateOverride(t *testing.T) {
+	r, err := os.Open("./testdata/example-in.stl")
+	assert.NoError(t, err)
+	defer r.Close()
+
+	s, err := astisub.ReadFromSTL(r, astisub.STLOptions{FramerateOverride: 30})
+	assert.NoError(t, err)
+	assert.Equal(t, 30, s.Metadata.Framerate)
+	assert.Equal(t, time.Minute+41*time.Second+time.Second/30, s.Items[0].EndAt)
+}
+
+func TestSTLCumulativeSet(t *testing.T) {
+	// Write an item whose rows don't fit in a single block
+	l := strings.Repeat("a", 38)
+	s := &astisub.Subtitles{Items: []*astisub.Item{
+		{EndAt: 2 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "before"}}}}, StartAt: time.Second},
+		{EndAt: 4 * time.Second, StartAt: 3 * time.Second},
+		{EndAt: 6 * time.Second, StartAt: 5 * time.Second},
+	}}
+	for i := 0; i < 5; i++ {
+		s.Items[1].Lines = append(s.Items[1].Lines, astisub.Line{Items: []astisub.LineItem{{Text: l}}})
+	}
+	s.Items[2].Lines = []astisub.Line{{Items: []astisub.LineItem{{Text: "after"}}}}
+	s.Metadata = &astisub.Metadata{Framerate: 25, STLCountryOfOrigin: "FRA", STLDisplayStandardCode: "0"}
+	w := &bytes.Buffer{}
+	err := s.WriteToSTL(w)
+	require.NoError(t, err)
+	require.Equal(t, 1024+5*128, w.Len())
+
+	// Read
+	s, err = astisub.ReadFromSTL(bytes.NewReader(w.Bytes()), astisub.STLOptions{})
+	require.NoError(t, err)
+	require.Len(t, s.Items, 3)
+	assert.Equal(t, "before", s.Items[0].String())
+	assert.Len(t, s.Items[1].Lines, 5)
+	assert.Equal(t, l, s.Items[1].Lines[4].String())
+	assert.Equal(t, 3*time.Second, s.Items[1].StartAt)
+	assert.Equal(t, 4*time.Second, s.Items[1].EndAt)
+	assert.Equal(t, 5, s.Items[1].InlineStyle.STLPosition.Rows)
+	assert.Equal(t, "after", s.Items[2].String())
+}
+
+func TestSTLToTTMLAlignment(t *testing.T) {
+	// Write a center-justified item
+	j := astisub.JustificationCentered
+	s := &astisub.Subtitles{
+		Items: []*astisub.Item{{
+			EndAt:       2 * time.Second,
+			InlineStyle: &astisub.StyleAttributes{STLJustification: &j},
+			Lines:       []astisub.Line{{Items: []astisub.LineItem{{Text: "centered"}}}},
+			StartAt:     time.Second,
+		}},
+		Metadata: &astisub.Metadata{Framerate: 25, STLCountryOfOrigin: "FRA", STLDisplayStandardCode: "0"},
+	}
+	w := &bytes.Buffer{}
+	require.NoError(t, s.WriteToSTL(w))
+
+	// Convert to TTML
+	s, err := astisub.ReadFromSTL(bytes.NewReader(w.Bytes()), astisub.STLOptions{})
+	require.NoError(t, err)
+	require.Len(t, s.Items, 1)
+	w.Reset()
+	require.NoError(t, s.WriteToTTML(w))
+	assert.Contains(t, w.String(), `tts:textAlign="center"`)
+	assert.Contains(t, w.String(), `tts:displayAlign="after"`)
+}
@@ -9,13 +9,18 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/asticode/go-astikit"
 	"golang.org/x/net/html"
+	"golang.org/x/text/encoding/charmap"
 )
 
 // Bytes
@@ -47,14 +52,37 @@ var (
 
 // Errors
 var (
-	ErrInvalidExtension   = errors.New("astisub: invalid extension")
-	ErrNoSubtitlesToWrite = errors.New("astisub: no subtitles to write")
+	ErrInvalidExtension      = errors.New("astisub: invalid extension")
+	ErrInvalidFormat         = errors.New("astisub: invalid format")
+	ErrInvalidItemIndex      = errors.New("astisub: invalid item index")
+	ErrInvalidItemIndexes    = errors.New("astisub: invalid item indexes")
+	ErrMaxBytesExceeded      = errors.New("astisub: max bytes exceeded")
+	ErrMaxItemsExceeded      = errors.New("astisub: max items exceeded")
+	ErrMaxLineLengthExceeded = errors.New("astisub: max line length exceeded")
+	ErrNoItemsFound          = errors.New("astisub: no items found, content may not match the format")
+	ErrNoSubtitlesToWrite    = errors.New("astisub: no subtitles to write")
 )
 
 // HTML Escape
 var (
-	htmlEscaper   = strings.NewReplacer("&", "&amp;", "<", "&lt;", "\u00A0", "&nbsp;")
-	htmlUnescaper = strings.NewReplacer("&amp;", "&", "&lt;", "<", "&nbsp;", "\u00A0")
+	htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", "\u00A0", "&nbsp;")
+	// Bidi marks are only escaped in WebVTT since SRT players don't decode their entities
+	htmlEscaperWebVTT = strings.NewReplacer("&", "&amp;", "<", "&lt;", "\u00A0", "&nbsp;", "\u200E", "&lrm;", "\u200F", "&rlm;")
+	// Entities are unescaped in a single pass so that an escaped "&" is never part of another entity
+	htmlRegexpEntity = regexp.MustCompile(`&(#[0-9]+|#[xX][0-9a-fA-F]+|[a-z]+);`)
+	htmlEntities     = map[string]string{
+		"amp":  "&",
+		"gt":   ">",
+		"lrm":  "\u200E",
+		"lt":   "<",
+		"nbsp": "\u00A0",
+		"rlm":  "\u200F",
+	}
+)
+
+// Regexps
+var (
+	regexpTags = regexp.MustCompile(`<[^>]*>|\{\\[^}]*\}`)
 )
 
 // Now allows testing functions using it
@@ -64,9 +92,18 @@ var Now = func() time.Time {
 
 // Options represents open or write options
 type Options struct {
-	Filename string
-	Teletext TeletextOptions
-	STL      STLOptions
+	Filename       string
+	KeepEmptyItems bool // Only used by .ssa/.ass
+	KeepRawText    bool // Only used by .srt, .ssa/.ass and .vtt, overrides SRT.KeepRawText
+	// Limits guarding against malicious files. 0 means unlimited.
+	// MaxLineLength is expressed in bytes and only enforced for text formats.
+	MaxBytes      int64
+	MaxItems      int
+	MaxLineLength int
+	RequireItems  bool // Open fails with ErrNoItemsFound if no items were parsed
+	SRT           SRTOptions
+	STL           STLOptions
+	Teletext      TeletextOptions
 }
 
 // Open opens a subtitle reader based on options
@@ -79,23 +116,99 @@ func Open(o Options) (s *Subtitles, err error) {
 	}
 	defer f.Close()
 
+	// Limit the content
+	ext := filepath.Ext(strings.ToLower(o.Filename))
+	lr := &limitReader{
+		maxBytes: o.MaxBytes,
+		r:        f,
+	}
+	if ext != ".stl" && ext != ".ts" {
+		lr.maxLineLength = o.MaxLineLength
+	}
+
 	// Parse the content
-	switch filepath.Ext(strings.ToLower(o.Filename)) {
+	switch ext {
 	case ".srt":
-		s, err = ReadFromSRT(f)
+		srtOpts := o.SRT
+		srtOpts.KeepRawText = o.KeepRawText
+		srtOpts.MaxItems = o.MaxItems
+		s, err = ReadFromSRTWithOptions(lr, srtOpts)
 	case ".ssa", ".ass":
-		s, err = ReadFromSSA(f)
+		ssaOpts := defaultSSAOptions()
+		ssaOpts.KeepEmptyItems = o.KeepEmptyItems
+		ssaOpts.KeepRawText = o.KeepRawText
+		ssaOpts.MaxItems = o.MaxItems
+		s, err = ReadFromSSAWithOptions(lr, ssaOpts)
 	case ".stl":
-		s, err = ReadFromSTL(f, o.STL)
+		stlOpts := o.STL
+		stlOpts.MaxItems = o.MaxItems
+		s, err = ReadFromSTL(lr, stlOpts)
 	case ".ts":
-		s, err = ReadFromTeletext(f, o.Teletext)
-	case ".ttml":
-		s, err = ReadFromTTML(f)
+		teletextOpts := o.Teletext
+		teletextOpts.MaxItems = o.MaxItems
+		s, err = ReadFromTeletext(lr, teletextOpts)
+	case ".itt", ".ttml":
+		s, err = ReadFromTTMLWithOptions(lr, TTMLOptions{MaxItems: o.MaxItems})
 	case ".vtt":
-		s, err = ReadFromWebVTT(f)
+		s, err = ReadFromWebVTTWithOptions(lr, WebVTTOptions{KeepRawText: o.KeepRawText, MaxItems: o.MaxItems})
 	default:
 		err = ErrInvalidExtension
 	}
+
+	// Some readers stop silently on read errors, make sure limits are reported
+	if lr.err != nil {
+		err = lr.err
+		s = nil
+		return
+	} else if err != nil {
+		return
+	}
+
+	// Check items
+	if o.RequireItems && len(s.Items) == 0 {
+		err = ErrNoItemsFound
+		s = nil
+	}
+	return
+}
+
+// limitReader returns an error as soon as the content exceeds the limits
+type limitReader struct {
+	err           error
+	lineLength    int
+	maxBytes      int64
+	maxLineLength int
+	n             int64
+	r             io.Reader
+}
+
+func (r *limitReader) Read(p []byte) (n int, err error) {
+	// Limit has already been exceeded
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	// Read
+	n, err = r.r.Read(p)
+
+	// Check bytes
+	r.n += int64(n)
+	if r.maxBytes > 0 && r.n > r.maxBytes {
+		r.err = ErrMaxBytesExceeded
+		return 0, r.err
+	}
+
+	// Check line length
+	if r.maxLineLength > 0 {
+		for _, b := range p[:n] {
+			if b == '\n' || b == '\r' {
+				r.lineLength = 0
+			} else if r.lineLength++; r.lineLength > r.maxLineLength {
+				r.err = ErrMaxLineLengthExceeded
+				return 0, r.err
+			}
+		}
+	}
 	return
 }
 
@@ -120,6 +233,27 @@ func NewSubtitles() *Subtitles {
 	}
 }
 
+// ConformOptions represents the steps Conform runs, in the order they're listed
+type ConformOptions struct {
+	Order              bool          // Stable order by start time
+	RemoveInvalidItems bool          // Items with a non-positive duration or without text are removed
+	FixOverlaps        bool          // Items overlapping the next item end when it starts
+	MinDuration        time.Duration // Shorter items are extended, without overlapping the next item. 0 disables the step.
+	MaxGapToClose      time.Duration // Gaps shorter than that are closed by extending the previous item. 0 disables the step.
+	RenumberIndexes    bool          // Indexes are set to 1..n
+}
+
+// DefaultConformOptions returns conform options that order, clean and renumber items without
+// modifying timings unless items overlap
+func DefaultConformOptions() ConformOptions {
+	return ConformOptions{
+		FixOverlaps:        true,
+		Order:              true,
+		RemoveInvalidItems: true,
+		RenumberIndexes:    true,
+	}
+}
+
 // Item represents a text to show between 2 time boundaries with formatting
 type Item struct {
 	Comments    []string
@@ -127,18 +261,111 @@ type Item struct {
 	EndAt       time.Duration
 	InlineStyle *StyleAttributes
 	Lines       []Line
+	Raw         string // Original unparsed text, only set when requested in .srt, .ssa/.ass and .vtt reading options
 	Region      *Region
 	StartAt     time.Duration
 	Style       *Style
 }
 
 // String implements the Stringer interface
+// Lines are joined with " - " which makes items differing only by their line breaks indistinguishable,
+// use StringSep if that matters
 func (i Item) String() string {
+	return i.StringSep(" - ")
+}
+
+// StringSep returns the item's lines joined with sep
+func (i Item) StringSep(sep string) string {
 	var os []string
 	for _, l := range i.Lines {
 		os = append(os, l.String())
 	}
-	return strings.Join(os, " - ")
+	return strings.Join(os, sep)
+}
+
+// Merge merges item j into item i
+func (i *Item) Merge(j *Item) {
+	if j.StartAt < i.StartAt {
+		i.StartAt = j.StartAt
+	}
+	if j.EndAt > i.EndAt {
+		i.EndAt = j.EndAt
+	}
+	i.Lines = append(i.Lines, j.Lines...)
+	i.Comments = append(i.Comments, j.Comments...)
+	if len(j.Raw) > 0 {
+		if len(i.Raw) > 0 {
+			i.Raw += "\n"
+		}
+		i.Raw += j.Raw
+	}
+}
+
+// ValidationRules represents the rules items are validated against. Zero values disable their check.
+type ValidationRules struct {
+	MaxCPL      int     // Characters per line
+	MaxCPS      float64 // Characters per second
+	MaxDuration time.Duration
+	MaxLines    int
+	MinDuration time.Duration
+	MinGap      time.Duration // Between consecutive items, only checked by Subtitles.Validate
+}
+
+// ValidationIssueType represents the type of a validation issue
+type ValidationIssueType string
+
+// Validation issue types
+const (
+	ValidationIssueTypeCPL      ValidationIssueType = "cpl"
+	ValidationIssueTypeCPS      ValidationIssueType = "cps"
+	ValidationIssueTypeDuration ValidationIssueType = "duration"
+	ValidationIssueTypeGap      ValidationIssueType = "gap"
+	ValidationIssueTypeLines    ValidationIssueType = "lines"
+	ValidationIssueTypeOverlap  ValidationIssueType = "overlap"
+)
+
+// ValidationIssue represents an issue found while validating subtitles
+type ValidationIssue struct {
+	ItemIndex int // Only set by Subtitles.Validate
+	LineIndex int // -1 if the issue doesn't concern a specific line
+	Message   string
+	Type      ValidationIssueType
+}
+
+// Validate validates the item on its own. Checks requiring its neighbours are done by Subtitles.Validate.
+func (i Item) Validate(rules ValidationRules) (is []ValidationIssue) {
+	// Duration
+	d := i.EndAt - i.StartAt
+	if d <= 0 {
+		is = append(is, ValidationIssue{LineIndex: -1, Message: fmt.Sprintf("end %s is not after start %s", i.EndAt, i.StartAt), Type: ValidationIssueTypeDuration})
+	} else if rules.MinDuration > 0 && d < rules.MinDuration {
+		is = append(is, ValidationIssue{LineIndex: -1, Message: fmt.Sprintf("duration %s is smaller than %s", d, rules.MinDuration), Type: ValidationIssueTypeDuration})
+	} else if rules.MaxDuration > 0 && d > rules.MaxDuration {
+		is = append(is, ValidationIssue{LineIndex: -1, Message: fmt.Sprintf("duration %s is bigger than %s", d, rules.MaxDuration), Type: ValidationIssueTypeDuration})
+	}
+
+	// Lines
+	if rules.MaxLines > 0 && len(i.Lines) > rules.MaxLines {
+		is = append(is, ValidationIssue{LineIndex: -1, Message: fmt.Sprintf("%d lines is more than %d", len(i.Lines), rules.MaxLines), Type: ValidationIssueTypeLines})
+	}
+
+	// Loop through lines
+	var n int
+	for idx, l := range i.Lines {
+		c := utf8.RuneCountInString(l.String())
+		n += c
+		if rules.MaxCPL > 0 && c > rules.MaxCPL {
+			is = append(is, ValidationIssue{LineIndex: idx, Message: fmt.Sprintf("%d characters is more than %d", c, rules.MaxCPL), Type: ValidationIssueTypeCPL})
+		}
+	}
+
+	// Characters per second
+	if rules.MaxCPS > 0 && d > 0 {
+		if cps := float64(n) / d.Seconds(); cps > rules.MaxCPS {
+			is = append(is, ValidationIssue{LineIndex: -1, Message: fmt.Sprintf("%.2f characters per second is more than %.2f", cps, rules.MaxCPS), Type: ValidationIssueTypeCPS})
+		}
+	}
+	return
 }
 
 // Color represents a color
@@ -162,6 +389,50 @@ func newColorFromSSAString(s string, base int) (c *Color, err error) {
 	return
 }
 
+// ParseHexColor parses a #rgb, #rrggbb or #rrggbbaa hex color.
+// As in SSA, Alpha is a transparency level whereas the hex alpha is an opacity level, therefore it is inverted.
+func ParseHexColor(i string) (c *Color, err error) {
+	// Expand #rgb
+	s := strings.TrimPrefix(i, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+
+	// Parse
+	var v uint64
+	switch len(s) {
+	case 6:
+		if v, err = strconv.ParseUint(s, 16, 32); err != nil {
+			err = fmt.Errorf("astisub: parsing hex color %s failed: %w", i, err)
+			return
+		}
+		v = v<<8 | 0xff
+	case 8:
+		if v, err = strconv.ParseUint(s, 16, 32); err != nil {
+			err = fmt.Errorf("astisub: parsing hex color %s failed: %w", i, err)
+			return
+		}
+	default:
+		err = fmt.Errorf("astisub: invalid hex color %s", i)
+		return
+	}
+	c = &Color{
+		Alpha: 0xff - uint8(v),
+		Blue:  uint8(v >> 8),
+		Green: uint8(v >> 16),
+		Red:   uint8(v >> 24),
+	}
+	return
+}
+
+// Hex expresses the color as a #rrggbb hex string, or as a #rrggbbaa hex string if alpha is requested
+func (c *Color) Hex(withAlpha bool) string {
+	if withAlpha {
+		return fmt.Sprintf("#%.8x", uint32(c.Red)<<24|uint32(c.Green)<<16|uint32(c.Blue)<<8|uint32(0xff-c.Alpha))
+	}
+	return "#" + c.TTMLString()
+}
+
 // SSAString expresses the color as an SSA string
 func (c *Color) SSAString() string {
 	return fmt.Sprintf("%.8x", uint32(c.Alpha)<<24|uint32(c.Blue)<<16|uint32(c.Green)<<8|uint32(c.Red))
@@ -194,8 +465,12 @@ type StyleAttributes struct {
 	SSABackColour        *Color
 	SSABold              *bool
 	SSABorderStyle       *int
+	SSAComment           bool // Item is a "Comment" event rather than a "Dialogue" one
 	SSAEffect            string
 	SSAEncoding          *int
+	SSAEventEffect       *SSAEventEffect // Standard effects of the event Effect field, items only
+	SSAFadeIn            time.Duration
+	SSAFadeOut           time.Duration
 	SSAFontName          string
 	SSAFontSize          *float64
 	SSAItalic            *bool
@@ -204,6 +479,7 @@ type StyleAttributes struct {
 	SSAMarginRight       *int // pixels
 	SSAMarginVertical    *int // pixels
 	SSAMarked            *bool
+	SSAMove              *SSAMove
 	SSAOutline           *float64 // pixels
 	SSAOutlineColour     *Color
 	SSAPrimaryColour     *Color
@@ -304,31 +580,38 @@ func (sa *StyleAttributes) propagateSRTAttributes() {
 		sa.TTMLColor = sa.SRTColor
 	}
 
+	// copy alignment to TTML ones
+	if sa.SRTPosition >= 1 && sa.SRTPosition <= 9 {
+		sa.TTMLTextAlign = astikit.StrPtr([]string{"left", "center", "right"}[(sa.SRTPosition-1)%3])
+		sa.TTMLDisplayAlign = astikit.StrPtr([]string{"after", "center", "before"}[(sa.SRTPosition-1)/3])
+	}
+
+	// rows map to the WebVTT vertical line whereas columns map to the WebVTT alignment
 	switch sa.SRTPosition {
 	case 7: // top-left
 		sa.WebVTTAlign = "left"
-		sa.WebVTTPosition = "10%"
+		sa.WebVTTLine = "10%"
 	case 8: // top-center
-		sa.WebVTTPosition = "10%"
+		sa.WebVTTLine = "10%"
 	case 9: // top-right
 		sa.WebVTTAlign = "right"
-		sa.WebVTTPosition = "10%"
+		sa.WebVTTLine = "10%"
 	case 4: // middle-left
 		sa.WebVTTAlign = "left"
-		sa.WebVTTPosition = "50%"
+		sa.WebVTTLine = "50%"
 	case 5: // middle-center
-		sa.WebVTTPosition = "50%"
+		sa.WebVTTLine = "50%"
 	case 6: // middle-right
 		sa.WebVTTAlign = "right"
-		sa.WebVTTPosition = "50%"
+		sa.WebVTTLine = "50%"
 	case 1: // bottom-left
 		sa.WebVTTAlign = "left"
-		sa.WebVTTPosition = "90%"
+		sa.WebVTTLine = "90%"
 	case 2: // bottom-center
-		sa.WebVTTPosition = "90%"
+		sa.WebVTTLine = "90%"
 	case 3: // bottom-right
 		sa.WebVTTAlign = "right"
-		sa.WebVTTPosition = "90%"
+		sa.WebVTTLine = "90%"
 	}
 
 	sa.WebVTTBold = sa.SRTBold
@@ -354,9 +637,12 @@ func (sa *StyleAttributes) propagateSTLAttributes() {
 		switch *sa.STLJustification {
 		case JustificationCentered:
 			// default to middle anyway?
+			sa.TTMLTextAlign = astikit.StrPtr("center")
 		case JustificationRight:
+			sa.TTMLTextAlign = astikit.StrPtr("right")
 			sa.WebVTTAlign = "right"
 		case JustificationLeft:
+			sa.TTMLTextAlign = astikit.StrPtr("left")
 			sa.WebVTTAlign = "left"
 		}
 	}
@@ -364,6 +650,12 @@ func (sa *StyleAttributes) propagateSTLAttributes() {
 	if sa.STLPosition != nil && sa.STLPosition.MaxRows > 0 {
 		// in-vision vertical position ranges from 0 to maxrows (maxrows <= 99)
 		sa.WebVTTLine = fmt.Sprintf("%d%%", sa.STLPosition.VerticalPosition*100/sa.STLPosition.MaxRows)
+		// rows in the top half of the screen are displayed from the top of the region
+		if sa.STLPosition.VerticalPosition*2 <= sa.STLPosition.MaxRows {
+			sa.TTMLDisplayAlign = astikit.StrPtr("before")
+		} else {
+			sa.TTMLDisplayAlign = astikit.StrPtr("after")
+		}
 		// teletext vertical position ranges from 1 to 23; as webvtt line percentage starts
 		// from the top at 0%, substract 1 to the stl position to get a better conversion.
 		// Especially apparent on Shaka player, where a single line at vp 22 would be half
@@ -381,19 +673,17 @@ func (sa *StyleAttributes) propagateTeletextAttributes() {
 }
 
 // reference for migration: https://w3c.github.io/ttml-webvtt-mapping/
-func (sa *StyleAttributes) propagateTTMLAttributes() {
+// rootExtent is the root container extent used to convert pixel lengths and may be empty
+func (sa *StyleAttributes) propagateTTMLAttributes(rootExtent string) {
 	if sa.TTMLTextAlign != nil {
 		sa.WebVTTAlign = *sa.TTMLTextAlign
 	}
 	if sa.TTMLExtent != nil {
 		//region settings
 		lineHeight := 5 //assuming height of line as 5.33vh
-		dimensions := strings.Split(*sa.TTMLExtent, " ")
-		if len(dimensions) > 1 {
+		if dimensions, ps, ok := ttmlPercentages(*sa.TTMLExtent, rootExtent); ok {
 			sa.WebVTTWidth = dimensions[0]
-			if height, err := strconv.Atoi(strings.ReplaceAll(dimensions[1], "%", "")); err == nil {
-				sa.WebVTTLines = height / lineHeight
-			}
+			sa.WebVTTLines = int(ps[1]) / lineHeight
 			//cue settings
 			//default TTML WritingMode is lrtb i.e. left to right, top to bottom
 			sa.WebVTTSize = dimensions[1]
@@ -403,13 +693,12 @@ func (sa *StyleAttributes) propagateTTMLAttributes() {
 		}
 	}
 	if sa.TTMLOrigin != nil {
-		//region settings
-		sa.WebVTTRegionAnchor = "0%,0%"
-		sa.WebVTTViewportAnchor = strings.ReplaceAll(strings.TrimSpace(*sa.TTMLOrigin), " ", ",")
-		sa.WebVTTScroll = "up"
-		//cue settings
-		coordinates := strings.Split(*sa.TTMLOrigin, " ")
-		if len(coordinates) > 1 {
+		if coordinates, _, ok := ttmlPercentages(*sa.TTMLOrigin, rootExtent); ok {
+			//region settings
+			sa.WebVTTRegionAnchor = "0%,0%"
+			sa.WebVTTViewportAnchor = coordinates[0] + "," + coordinates[1]
+			sa.WebVTTScroll = "up"
+			//cue settings
 			sa.WebVTTLine = coordinates[0]
 			sa.WebVTTPosition = coordinates[1]
 			if sa.TTMLWritingMode != nil && strings.HasPrefix(*sa.TTMLWritingMode, "tb") {
@@ -420,6 +709,62 @@ func (sa *StyleAttributes) propagateTTMLAttributes() {
 	}
 }
 
+// ttmlLength represents a TTML length
+type ttmlLength struct {
+	unit  string // "%", "px" or "" which is considered as a percentage
+	value float64
+}
+
+// parseTTMLLengths parses whitespace separated TTML lengths
+func parseTTMLLengths(i string) (ls []ttmlLength, ok bool) {
+	for _, f := range strings.Fields(i) {
+		var l ttmlLength
+		for _, u := range []string{"%", "px"} {
+			if strings.HasSuffix(f, u) {
+				l.unit = u
+				f = strings.TrimSuffix(f, u)
+				break
+			}
+		}
+		var err error
+		if l.value, err = strconv.ParseFloat(f, 64); err != nil {
+			return nil, false
+		}
+		ls = append(ls, l)
+	}
+	return ls, true
+}
+
+// ttmlPercentages converts a TTML "x y" length pair into percentages of the root container. Pixel lengths can
+// only be converted if the root extent is expressed in pixels.
+func ttmlPercentages(i, rootExtent string) (ss [2]string, ps [2]float64, ok bool) {
+	// Parse
+	var ls []ttmlLength
+	if ls, ok = parseTTMLLengths(i); !ok || len(ls) != 2 {
+		return ss, ps, false
+	}
+
+	// Loop through lengths
+	var rs []ttmlLength
+	for idx, l := range ls {
+		switch l.unit {
+		case "px":
+			// Parse root extent
+			if rs == nil {
+				var rok bool
+				if rs, rok = parseTTMLLengths(rootExtent); !rok || len(rs) != 2 || rs[0].unit != "px" || rs[1].unit != "px" || rs[0].value <= 0 || rs[1].value <= 0 {
+					return ss, ps, false
+				}
+			}
+			ps[idx] = l.value * 100 / rs[idx].value
+		default:
+			ps[idx] = l.value
+		}
+		ss[idx] = strconv.FormatFloat(math.Round(ps[idx]*100)/100, 'f', -1, 64) + "%"
+	}
+	return ss, ps, true
+}
+
 func (sa *StyleAttributes) propagateWebVTTAttributes() {
 	// copy relevant attrs to SRT ones
 	if sa.TTMLColor != nil {
@@ -430,12 +775,85 @@ func (sa *StyleAttributes) propagateWebVTTAttributes() {
 	sa.SRTUnderline = sa.WebVTTUnderline
 }
 
+// StyleSpec represents format-neutral style attributes
+type StyleSpec struct {
+	Bold          bool
+	Color         *Color
+	Italic        bool
+	Justification *Justification // Bottom row alignment for SSA
+	Underline     bool
+}
+
+// NewStyleAttributes creates style attributes whose format-specific fields are all set based on the spec
+// so that styling is kept whatever the output format
+func NewStyleAttributes(spec StyleSpec) (sa *StyleAttributes) {
+	// Init
+	sa = &StyleAttributes{
+		SRTBold:         spec.Bold,
+		SRTItalics:      spec.Italic,
+		SRTUnderline:    spec.Underline,
+		SSABold:         astikit.BoolPtr(spec.Bold),
+		SSAItalic:       astikit.BoolPtr(spec.Italic),
+		SSAUnderline:    astikit.BoolPtr(spec.Underline),
+		STLItalics:      astikit.BoolPtr(spec.Italic),
+		STLUnderline:    astikit.BoolPtr(spec.Underline),
+		WebVTTBold:      spec.Bold,
+		WebVTTItalics:   spec.Italic,
+		WebVTTUnderline: spec.Underline,
+	}
+
+	// TTML
+	if spec.Bold {
+		sa.TTMLFontWeight = astikit.StrPtr("bold")
+	}
+	if spec.Italic {
+		sa.TTMLFontStyle = astikit.StrPtr("italic")
+	}
+	if spec.Underline {
+		sa.TTMLTextDecoration = astikit.StrPtr("underline")
+	}
+
+	// Color
+	if spec.Color != nil {
+		sa.SRTColor = astikit.StrPtr(spec.Color.Hex(false))
+		sa.SSAPrimaryColour = spec.Color
+		sa.TeletextColor = spec.Color
+		sa.TTMLColor = astikit.StrPtr(spec.Color.Hex(false))
+	}
+
+	// Justification
+	if spec.Justification != nil {
+		sa.STLJustification = spec.Justification
+		switch *spec.Justification {
+		case JustificationLeft:
+			sa.SSAAlignment = astikit.IntPtr(1)
+			sa.TTMLTextAlign = astikit.StrPtr("left")
+		case JustificationCentered:
+			sa.SSAAlignment = astikit.IntPtr(2)
+			sa.TTMLTextAlign = astikit.StrPtr("center")
+		case JustificationRight:
+			sa.SSAAlignment = astikit.IntPtr(3)
+			sa.TTMLTextAlign = astikit.StrPtr("right")
+		}
+	}
+
+	// Propagate
+	sa.propagateSRTAttributes()
+	sa.propagateSSAAttributes()
+	sa.propagateSTLAttributes()
+	sa.propagateTeletextAttributes()
+	sa.propagateTTMLAttributes("")
+	sa.propagateWebVTTAttributes()
+	return
+}
+
 // Metadata represents metadata
 // TODO Merge attributes
 type Metadata struct {
 	Comments                                            []string
 	Framerate                                           int
 	Language                                            string
+	SRTHadBOM                                           bool
 	SSACollisions                                       string
 	SSAOriginalEditing                                  string
 	SSAOriginalScript                                   string
@@ -443,12 +861,14 @@ type Metadata struct {
 	SSAOriginalTranslation                              string
 	SSAPlayDepth                                        *int
 	SSAPlayResX, SSAPlayResY                            *int
+	SSAScaledBorderAndShadow                            string
 	SSAScriptType                                       string
 	SSAScriptUpdatedBy                                  string
 	SSASynchPoint                                       string
 	SSATimer                                            *float64
 	SSAUpdateDetails                                    string
 	SSAWrapStyle                                        string
+	SSAYCbCrMatrix                                      string
 	STLCountryOfOrigin                                  string
 	STLCreationDate                                     *time.Time
 	STLDisplayStandardCode                              string
@@ -468,6 +888,9 @@ type Metadata struct {
 	STLTranslatorName                                   string
 	Title                                               string
 	TTMLCopyright                                       string
+	TTMLDropMode                                        string
+	TTMLMarkerMode                                      string
+	TTMLRootExtent                                      string // Reference resolution, e.g. "1920px 1080px"
 	WebVTTTimestampMap                                  *WebVTTTimestampMap
 }
 
@@ -502,7 +925,9 @@ func (l Line) String() string {
 
 // LineItem represents a formatted line item
 type LineItem struct {
+	EndAt       time.Duration
 	InlineStyle *StyleAttributes
+	Language    string // BCP 47 language tag, e.g. from WebVTT <lang> tags
 	StartAt     time.Duration
 	Style       *Style
 	Text        string
@@ -522,129 +947,789 @@ func (s *Subtitles) Add(d time.Duration) {
 	}
 }
 
-// Duration returns the subtitles duration
-func (s Subtitles) Duration() time.Duration {
-	if len(s.Items) == 0 {
-		return time.Duration(0)
+// Anonymize returns a copy of the subtitles where texts are replaced with placeholders of the same length.
+// Timings, line/item structure, regions and styles are kept intact.
+func (s Subtitles) Anonymize() *Subtitles {
+	o := &Subtitles{
+		Metadata: s.Metadata,
+		Regions:  s.Regions,
+		Styles:   s.Styles,
 	}
-	return s.Items[len(s.Items)-1].EndAt
-}
-
-// ForceDuration updates the subtitles duration.
-// If requested duration is bigger, then we create a dummy item.
-// If requested duration is smaller, then we remove useless items and we cut the last item or add a dummy item.
-func (s *Subtitles) ForceDuration(d time.Duration, addDummyItem bool) {
-	// Requested duration is the same as the subtitles'one
-	if s.Duration() == d {
-		return
+	for _, i := range s.Items {
+		// Copy item
+		j := *i
+		j.Comments = make([]string, 0, len(i.Comments))
+		for _, c := range i.Comments {
+			j.Comments = append(j.Comments, anonymizeText(c))
+		}
+		j.Raw = anonymizeText(i.Raw)
+
+		// Copy lines
+		j.Lines = make([]Line, 0, len(i.Lines))
+		for _, l := range i.Lines {
+			m := Line{VoiceName: l.VoiceName}
+			for _, li := range l.Items {
+				li.Text = anonymizeText(li.Text)
+				m.Items = append(m.Items, li)
+			}
+			j.Lines = append(j.Lines, m)
+		}
+		o.Items = append(o.Items, &j)
 	}
+	return o
+}
 
-	// Requested duration is bigger than subtitles'one
-	if s.Duration() > d {
-		// Find last item before input duration and update end at
-		var lastIndex = -1
-		for index, i := range s.Items {
-			// Start at is bigger than input duration, we've found the last item
-			if i.StartAt >= d {
-				lastIndex = index
-				break
-			} else if i.EndAt > d {
-				s.Items[index].EndAt = d
-			}
+// anonymizeText replaces every non-space character with a placeholder so that length and word count are kept
+func anonymizeText(i string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return r
 		}
+		return 'x'
+	}, i)
+}
 
-		// Last index has been found
-		if lastIndex != -1 {
-			s.Items = s.Items[:lastIndex]
+// ItemContext provides context about the text being transformed
+type ItemContext struct {
+	Item          *Item
+	ItemIndex     int
+	LineIndex     int
+	LineItemIndex int
+}
+
+// TextTransformer represents an object capable of transforming subtitles texts (translation, spell-check, etc.)
+type TextTransformer interface {
+	Transform(text string, ctx ItemContext) (string, error)
+}
+
+// ApplyTransform feeds each line item's text through the transformer.
+// It aborts on the first error in which case subtitles are left untouched.
+func (s *Subtitles) ApplyTransform(t TextTransformer) (err error) {
+	// Transform
+	var ts []string
+	for idxItem, i := range s.Items {
+		for idxLine, l := range i.Lines {
+			for idxLineItem, li := range l.Items {
+				var text string
+				if text, err = t.Transform(li.Text, ItemContext{
+					Item:          i,
+					ItemIndex:     idxItem,
+					LineIndex:     idxLine,
+					LineItemIndex: idxLineItem,
+				}); err != nil {
+					err = fmt.Errorf("astisub: transforming item %d line %d line item %d failed: %w", idxItem+1, idxLine+1, idxLineItem+1, err)
+					return
+				}
+				ts = append(ts, text)
+			}
 		}
 	}
 
-	// Add dummy item with the minimum duration possible
-	if addDummyItem && s.Duration() < d {
-		s.Items = append(s.Items, &Item{EndAt: d, Lines: []Line{{Items: []LineItem{{Text: "..."}}}}, StartAt: d - time.Millisecond})
+	// Update texts
+	var idx int
+	for _, i := range s.Items {
+		for idxLine := range i.Lines {
+			for idxLineItem := range i.Lines[idxLine].Items {
+				i.Lines[idxLine].Items[idxLineItem].Text = ts[idx]
+				idx++
+			}
+		}
 	}
+	return
 }
 
-// Fragment fragments subtitles with a specific fragment duration
-func (s *Subtitles) Fragment(f time.Duration) {
-	// Nothing to fragment
-	if len(s.Items) == 0 {
+// CapMaxDuration shortens items lasting more than max so that their duration is exactly max.
+// Start times are left untouched, which may leave gaps between items.
+func (s *Subtitles) CapMaxDuration(max time.Duration) {
+	// Nothing to do
+	if max <= 0 {
 		return
 	}
 
-	// Here we want to simulate fragments of duration f until there are no subtitles left in that period of time
-	var fragmentStartAt, fragmentEndAt = time.Duration(0), f
-	for fragmentStartAt < s.Items[len(s.Items)-1].EndAt {
-		// We loop through subtitles and process the ones that either contain the fragment start at,
-		// or contain the fragment end at
-		//
-		// It's useless processing subtitles contained between fragment start at and end at
-		//             |____________________|             <- subtitle
-		//           |                        |
-		//   fragment start at        fragment end at
-		for i, sub := range s.Items {
-			// Init
-			var newSub = &Item{}
-			*newSub = *sub
-
-			// A switch is more readable here
-			switch {
-			// Subtitle contains fragment start at
-			// |____________________|                         <- subtitle
-			//           |                        |
-			//   fragment start at        fragment end at
-			case sub.StartAt < fragmentStartAt && sub.EndAt > fragmentStartAt:
-				sub.StartAt = fragmentStartAt
-				newSub.EndAt = fragmentStartAt
-			// Subtitle contains fragment end at
-			//                         |____________________| <- subtitle
-			//           |                        |
-			//   fragment start at        fragment end at
-			case sub.StartAt < fragmentEndAt && sub.EndAt > fragmentEndAt:
-				sub.StartAt = fragmentEndAt
-				newSub.EndAt = fragmentEndAt
-			default:
-				continue
-			}
-
-			// Insert new sub
-			s.Items = append(s.Items[:i], append([]*Item{newSub}, s.Items[i:]...)...)
+	// Loop through items
+	for _, i := range s.Items {
+		if i.EndAt-i.StartAt > max {
+			i.EndAt = i.StartAt + max
 		}
+	}
+}
 
-		// Update fragments boundaries
-		fragmentStartAt += f
-		fragmentEndAt += f
+// CollapseRepeats merges items with identical texts that overlap or are separated by less than window,
+// even if other items stand between them. The merged item spans from the first start to the last end.
+// Items are ordered by start time which means the original order may be modified.
+func (s *Subtitles) CollapseRepeats(window time.Duration) {
+	// Nothing to do if less than 1 element
+	if len(s.Items) <= 1 {
+		return
 	}
 
 	// Order
 	s.Order()
-}
 
-// IsEmpty returns whether the subtitles are empty
-func (s Subtitles) IsEmpty() bool {
-	return len(s.Items) == 0
+	// Loop through items
+	for i := 0; i < len(s.Items)-1; i++ {
+		for j := i + 1; j < len(s.Items); j++ {
+			// Items are too far apart
+			if s.Items[j].StartAt-s.Items[i].EndAt > window {
+				break
+			}
+
+			// Items are the same
+			if s.Items[i].StringSep("\n") == s.Items[j].StringSep("\n") {
+				// Only override end time if longer
+				if s.Items[i].EndAt < s.Items[j].EndAt {
+					s.Items[i].EndAt = s.Items[j].EndAt
+				}
+				s.Items = append(s.Items[:j], s.Items[j+1:]...)
+				j--
+			}
+		}
+	}
 }
 
-// Merge merges subtitles i into subtitles
-func (s *Subtitles) Merge(i *Subtitles) {
-	// Append items
-	s.Items = append(s.Items, i.Items...)
-	s.Order()
+// Conform runs the steps enabled in opts, which is useful to make subtitles ready for delivery after
+// they've been edited
+func (s *Subtitles) Conform(opts ConformOptions) {
+	// Order
+	if opts.Order {
+		s.Order()
+	}
 
-	// Add regions
-	for _, region := range i.Regions {
-		if _, ok := s.Regions[region.ID]; !ok {
-			s.Regions[region.ID] = region
+	// Remove invalid items
+	if opts.RemoveInvalidItems {
+		var is []*Item
+		for _, i := range s.Items {
+			if i.EndAt > i.StartAt && strings.TrimSpace(i.StringSep("")) != "" {
+				is = append(is, i)
+			}
 		}
+		s.Items = is
 	}
 
-	// Add styles
-	for _, style := range i.Styles {
-		if _, ok := s.Styles[style.ID]; !ok {
-			s.Styles[style.ID] = style
+	// Fix overlaps
+	if opts.FixOverlaps {
+		for idx := 0; idx < len(s.Items)-1; idx++ {
+			if next := s.Items[idx+1]; s.Items[idx].EndAt > next.StartAt && next.StartAt > s.Items[idx].StartAt {
+				s.Items[idx].EndAt = next.StartAt
+			}
 		}
 	}
-}
+
+	// Ensure min duration
+	if opts.MinDuration > 0 {
+		for idx, i := range s.Items {
+			if i.EndAt-i.StartAt >= opts.MinDuration {
+				continue
+			}
+			i.EndAt = i.StartAt + opts.MinDuration
+			if idx < len(s.Items)-1 && s.Items[idx+1].StartAt >= i.StartAt && i.EndAt > s.Items[idx+1].StartAt {
+				i.EndAt = s.Items[idx+1].StartAt
+			}
+		}
+	}
+
+	// Close gaps
+	if opts.MaxGapToClose > 0 {
+		for idx := 0; idx < len(s.Items)-1; idx++ {
+			if gap := s.Items[idx+1].StartAt - s.Items[idx].EndAt; gap > 0 && gap < opts.MaxGapToClose {
+				s.Items[idx].EndAt = s.Items[idx+1].StartAt
+			}
+		}
+	}
+
+	// Renumber indexes
+	if opts.RenumberIndexes {
+		for idx, i := range s.Items {
+			i.Index = idx + 1
+		}
+	}
+}
+
+// DedupeStyles merges styles having the same attributes and the same parent style into the one with the smallest
+// ID, and updates references accordingly
+func (s *Subtitles) DedupeStyles() {
+	// Get ordered IDs
+	var ids []string
+	for id := range s.Styles {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	// Get replacements
+	// Merging styles may make their children identical, therefore we loop until nothing is merged
+	replacements := make(map[*Style]*Style)
+	canonical := func(st *Style) *Style {
+		for st != nil {
+			r, ok := replacements[st]
+			if !ok {
+				break
+			}
+			st = r
+		}
+		return st
+	}
+	for {
+		var merged bool
+		var kept []*Style
+		for _, id := range ids {
+			// Style has already been replaced
+			st := s.Styles[id]
+			if _, ok := replacements[st]; ok {
+				continue
+			}
+
+			// Look for an identical style
+			var found *Style
+			for _, k := range kept {
+				if canonical(k.Style) == canonical(st.Style) && equalStyleAttributes(k.InlineStyle, st.InlineStyle) {
+					found = k
+					break
+				}
+			}
+
+			// Update
+			if found != nil {
+				replacements[st] = found
+				merged = true
+			} else {
+				kept = append(kept, st)
+			}
+		}
+		if !merged {
+			break
+		}
+	}
+
+	// Nothing to do
+	if len(replacements) == 0 {
+		return
+	}
+
+	// Update styles
+	for id, st := range s.Styles {
+		if _, ok := replacements[st]; ok {
+			delete(s.Styles, id)
+		} else {
+			st.Style = canonical(st.Style)
+		}
+	}
+
+	// Update regions
+	for _, r := range s.Regions {
+		r.Style = canonical(r.Style)
+	}
+
+	// Update items
+	for _, i := range s.Items {
+		i.Style = canonical(i.Style)
+		for idxLine := range i.Lines {
+			for idxLineItem := range i.Lines[idxLine].Items {
+				i.Lines[idxLine].Items[idxLineItem].Style = canonical(i.Lines[idxLine].Items[idxLineItem].Style)
+			}
+		}
+	}
+}
+
+// Duration returns the subtitles duration
+func (s Subtitles) Duration() time.Duration {
+	if len(s.Items) == 0 {
+		return time.Duration(0)
+	}
+	return s.Items[len(s.Items)-1].EndAt
+}
+
+// DurationHistogram counts items per duration bucket. Keys are the buckets lower boundary: an item lasting d
+// is counted in the [k, k+bucket) bucket where k is a multiple of bucket. Nil is returned if bucket is not positive.
+func (s Subtitles) DurationHistogram(bucket time.Duration) (h map[time.Duration]int) {
+	// Nothing to do
+	if bucket <= 0 {
+		return
+	}
+
+	// Loop through items
+	h = make(map[time.Duration]int)
+	for _, i := range s.Items {
+		// Get lower boundary
+		d := i.EndAt - i.StartAt
+		k := d / bucket * bucket
+		if d < 0 && k != d {
+			k -= bucket
+		}
+		h[k]++
+	}
+	return
+}
+
+// Equal checks whether subtitles are structurally equal: styles and regions are compared by ID wherever they're
+// referenced. Items index and raw text are ignored.
+func (s Subtitles) Equal(o *Subtitles) bool {
+	return s.equal(o, false)
+}
+
+// EqualIgnoreTiming is the same as Equal except that items and line items time boundaries are ignored
+func (s Subtitles) EqualIgnoreTiming(o *Subtitles) bool {
+	return s.equal(o, true)
+}
+
+func (s Subtitles) equal(o *Subtitles, ignoreTiming bool) bool {
+	// Nil
+	if o == nil {
+		return false
+	}
+
+	// Metadata
+	m1, m2 := s.Metadata, o.Metadata
+	if m1 == nil {
+		m1 = &Metadata{}
+	}
+	if m2 == nil {
+		m2 = &Metadata{}
+	}
+	if !reflect.DeepEqual(m1, m2) {
+		return false
+	}
+
+	// Regions
+	if len(s.Regions) != len(o.Regions) {
+		return false
+	}
+	for id, r1 := range s.Regions {
+		r2, ok := o.Regions[id]
+		if !ok || !equalRegions(r1, r2) || !equalStyleAttributes(r1.InlineStyle, r2.InlineStyle) || !equalStyles(r1.Style, r2.Style) {
+			return false
+		}
+	}
+
+	// Styles
+	if len(s.Styles) != len(o.Styles) {
+		return false
+	}
+	for id, s1 := range s.Styles {
+		s2, ok := o.Styles[id]
+		if !ok || !equalStyles(s1, s2) || !equalStyleAttributes(s1.InlineStyle, s2.InlineStyle) || !equalStyles(s1.Style, s2.Style) {
+			return false
+		}
+	}
+
+	// Items
+	if len(s.Items) != len(o.Items) {
+		return false
+	}
+	for idx, i1 := range s.Items {
+		if !i1.equal(o.Items[idx], ignoreTiming) {
+			return false
+		}
+	}
+	return true
+}
+
+func (i *Item) equal(j *Item, ignoreTiming bool) bool {
+	// Item
+	if (!ignoreTiming && (i.StartAt != j.StartAt || i.EndAt != j.EndAt)) ||
+		len(i.Comments) != len(j.Comments) || len(i.Lines) != len(j.Lines) ||
+		!equalRegions(i.Region, j.Region) || !equalStyles(i.Style, j.Style) ||
+		!equalStyleAttributes(i.InlineStyle, j.InlineStyle) {
+		return false
+	}
+	for idx, c := range i.Comments {
+		if c != j.Comments[idx] {
+			return false
+		}
+	}
+
+	// Lines
+	for idxLine, l1 := range i.Lines {
+		l2 := j.Lines[idxLine]
+		if l1.VoiceName != l2.VoiceName || len(l1.Items) != len(l2.Items) {
+			return false
+		}
+
+		// Line items
+		for idxLineItem, li1 := range l1.Items {
+			li2 := l2.Items[idxLineItem]
+			if (!ignoreTiming && (li1.StartAt != li2.StartAt || li1.EndAt != li2.EndAt)) ||
+				li1.Text != li2.Text || li1.Language != li2.Language || !equalStyles(li1.Style, li2.Style) ||
+				!equalStyleAttributes(li1.InlineStyle, li2.InlineStyle) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// equalRegions compares regions by ID
+func equalRegions(a, b *Region) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.ID == b.ID
+}
+
+// equalStyles compares styles by ID
+func equalStyles(a, b *Style) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.ID == b.ID
+}
+
+// equalStyleAttributes compares style attributes by value, nil being the same as empty
+func equalStyleAttributes(a, b *StyleAttributes) bool {
+	if a == nil {
+		a = &StyleAttributes{}
+	}
+	if b == nil {
+		b = &StyleAttributes{}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// EnforceGap makes sure consecutive items are separated by at least minGap by pulling the earlier item's end
+// time back. Items are never emptied: where the gap can't be enforced without the end time reaching the start time,
+// the earlier item is left untouched. Items are ordered by start time which means the original order may be modified.
+func (s *Subtitles) EnforceGap(minGap time.Duration) {
+	// Nothing to do
+	if minGap <= 0 || len(s.Items) <= 1 {
+		return
+	}
+
+	// Order
+	s.Order()
+
+	// Loop through items
+	for idx := 0; idx < len(s.Items)-1; idx++ {
+		i, next := s.Items[idx], s.Items[idx+1]
+		if next.StartAt-i.EndAt >= minGap {
+			continue
+		}
+		if endAt := next.StartAt - minGap; endAt > i.StartAt {
+			i.EndAt = endAt
+		}
+	}
+}
+
+// ExplodeLines turns each multi-line item into several single-line items.
+// If splitDuration is true, the item's time range is split equally between lines, otherwise it's duplicated.
+func (s *Subtitles) ExplodeLines(splitDuration bool) {
+	var items []*Item
+	for _, i := range s.Items {
+		// Nothing to explode
+		if len(i.Lines) <= 1 {
+			items = append(items, i)
+			continue
+		}
+
+		// Loop through lines
+		d := (i.EndAt - i.StartAt) / time.Duration(len(i.Lines))
+		for idx, l := range i.Lines {
+			j := &Item{
+				EndAt:       i.EndAt,
+				InlineStyle: i.InlineStyle,
+				Lines:       []Line{l},
+				Region:      i.Region,
+				StartAt:     i.StartAt,
+				Style:       i.Style,
+			}
+			if idx == 0 {
+				j.Comments = i.Comments
+			}
+			if splitDuration {
+				j.StartAt = i.StartAt + time.Duration(idx)*d
+				if idx < len(i.Lines)-1 {
+					j.EndAt = j.StartAt + d
+				}
+			}
+			items = append(items, j)
+		}
+	}
+	s.Items = items
+}
+
+// FixMojibake reverses the UTF-8 => Latin-1/Windows-1252 => UTF-8 double encoding of texts.
+// It is conservative: a text is only modified if it can be fully reversed into valid UTF-8.
+func (s *Subtitles) FixMojibake() {
+	for _, i := range s.Items {
+		for idxLine := range i.Lines {
+			for idxLineItem := range i.Lines[idxLine].Items {
+				if t, ok := fixMojibake(i.Lines[idxLine].Items[idxLineItem].Text); ok {
+					i.Lines[idxLine].Items[idxLineItem].Text = t
+				}
+			}
+		}
+	}
+}
+
+// fixMojibake returns the text decoded once more as UTF-8 if it looks double encoded
+func fixMojibake(i string) (string, bool) {
+	// Re-encode text as Windows-1252, which is a superset of printable Latin-1
+	b, err := charmap.Windows1252.NewEncoder().Bytes([]byte(i))
+	if err != nil {
+		return "", false
+	}
+
+	// Text must contain multibyte UTF-8 sequences once re-encoded
+	if !utf8.Valid(b) || utf8.RuneCount(b) == len(b) {
+		return "", false
+	}
+	return string(b), true
+}
+
+// ForceDuration updates the subtitles duration.
+// If requested duration is bigger, then we create a dummy item.
+// If requested duration is smaller, then we remove useless items and we cut the last item or add a dummy item.
+func (s *Subtitles) ForceDuration(d time.Duration, addDummyItem bool) {
+	// Requested duration is the same as the subtitles'one
+	if s.Duration() == d {
+		return
+	}
+
+	// Requested duration is bigger than subtitles'one
+	if s.Duration() > d {
+		// Find last item before input duration and update end at
+		var lastIndex = -1
+		for index, i := range s.Items {
+			// Start at is bigger than input duration, we've found the last item
+			if i.StartAt >= d {
+				lastIndex = index
+				break
+			} else if i.EndAt > d {
+				s.Items[index].EndAt = d
+			}
+		}
+
+		// Last index has been found
+		if lastIndex != -1 {
+			s.Items = s.Items[:lastIndex]
+		}
+	}
+
+	// Add dummy item with the minimum duration possible
+	if addDummyItem && s.Duration() < d {
+		s.Items = append(s.Items, &Item{EndAt: d, Lines: []Line{{Items: []LineItem{{Text: "..."}}}}, StartAt: d - time.Millisecond})
+	}
+}
+
+// Fragment fragments subtitles with a specific fragment duration
+func (s *Subtitles) Fragment(f time.Duration) {
+	// Nothing to fragment
+	if len(s.Items) == 0 {
+		return
+	}
+
+	// Here we want to simulate fragments of duration f until there are no subtitles left in that period of time
+	var fragmentStartAt, fragmentEndAt = time.Duration(0), f
+	for fragmentStartAt < s.Items[len(s.Items)-1].EndAt {
+		// We loop through subtitles and process the ones that either contain the fragment start at,
+		// or contain the fragment end at
+		//
+		// It's useless processing subtitles contained between fragment start at and end at
+		//             |____________________|             <- subtitle
+		//           |                        |
+		//   fragment start at        fragment end at
+		for i, sub := range s.Items {
+			// Init
+			var newSub = &Item{}
+			*newSub = *sub
+
+			// A switch is more readable here
+			switch {
+			// Subtitle contains fragment start at
+			// |____________________|                         <- subtitle
+			//           |                        |
+			//   fragment start at        fragment end at
+			case sub.StartAt < fragmentStartAt && sub.EndAt > fragmentStartAt:
+				sub.StartAt = fragmentStartAt
+				newSub.EndAt = fragmentStartAt
+			// Subtitle contains fragment end at
+			//                         |____________________| <- subtitle
+			//           |                        |
+			//   fragment start at        fragment end at
+			case sub.StartAt < fragmentEndAt && sub.EndAt > fragmentEndAt:
+				sub.StartAt = fragmentEndAt
+				newSub.EndAt = fragmentEndAt
+			default:
+				continue
+			}
+
+			// Insert new sub
+			s.Items = append(s.Items[:i], append([]*Item{newSub}, s.Items[i:]...)...)
+		}
+
+		// Update fragments boundaries
+		fragmentStartAt += f
+		fragmentEndAt += f
+	}
+
+	// Order
+	s.Order()
+}
+
+// IsEmpty returns whether the subtitles are empty
+func (s Subtitles) IsEmpty() bool {
+	return len(s.Items) == 0
+}
+
+// ItemsAt returns the items displayed at t, i.e. whose [StartAt, EndAt) range contains t.
+// Several items may be returned when they overlap.
+func (s Subtitles) ItemsAt(t time.Duration) (is []*Item) {
+	for _, i := range s.Items {
+		if i.StartAt <= t && t < i.EndAt {
+			is = append(is, i)
+		}
+	}
+	return
+}
+
+// ItemsInRegion returns the items assigned to the provided region ID. Items are not copied.
+func (s Subtitles) ItemsInRegion(regionID string) (is []*Item) {
+	for _, i := range s.Items {
+		if i.Region != nil && i.Region.ID == regionID {
+			is = append(is, i)
+		}
+	}
+	return
+}
+
+// NextItemAfter returns the first item starting strictly after t, or nil if there's none.
+// Items don't need to be ordered.
+func (s Subtitles) NextItemAfter(t time.Duration) (o *Item) {
+	for _, i := range s.Items {
+		if i.StartAt > t && (o == nil || i.StartAt < o.StartAt) {
+			o = i
+		}
+	}
+	return
+}
+
+// LineRef references a line of the subtitles
+type LineRef struct {
+	ItemIndex int
+	LineIndex int
+	Length    int
+}
+
+// LinesExceedingCPL returns the lines whose visible number of characters is bigger than max
+func (s Subtitles) LinesExceedingCPL(max int) (o []LineRef) {
+	for idxItem, i := range s.Items {
+		for idxLine, l := range i.Lines {
+			if n := utf8.RuneCountInString(l.String()); n > max {
+				o = append(o, LineRef{
+					ItemIndex: idxItem,
+					LineIndex: idxLine,
+					Length:    n,
+				})
+			}
+		}
+	}
+	return
+}
+
+// LooksMojibake returns whether some texts look double encoded, in which case FixMojibake can be used
+func (s Subtitles) LooksMojibake() bool {
+	for _, i := range s.Items {
+		for _, l := range i.Lines {
+			for _, li := range l.Items {
+				if _, ok := fixMojibake(li.Text); ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Merge merges subtitles i into subtitles
+func (s *Subtitles) Merge(i *Subtitles) {
+	// Append items
+	s.Items = append(s.Items, i.Items...)
+	s.Order()
+
+	// Add regions
+	for _, region := range i.Regions {
+		if _, ok := s.Regions[region.ID]; !ok {
+			s.Regions[region.ID] = region
+		}
+	}
+
+	// Add styles
+	for _, style := range i.Styles {
+		if _, ok := s.Styles[style.ID]; !ok {
+			s.Styles[style.ID] = style
+		}
+	}
+}
+
+// MergeItems merges adjacent items i and j into item i and removes item j
+func (s *Subtitles) MergeItems(i, j int) error {
+	// Validate indexes
+	if i < 0 || j != i+1 || j >= len(s.Items) {
+		return ErrInvalidItemIndexes
+	}
+
+	// Merge
+	s.Items[i].Merge(s.Items[j])
+	s.Items = append(s.Items[:j], s.Items[j+1:]...)
+	return nil
+}
+
+// NormalizeCJKPunctuation converts common punctuation (,.!?:;()) to its full-width form or the other way around.
+// When converting to full-width, separators having a digit on either side, e.g. in "3.5", "1,000" or "10:30",
+// are left untouched. Full stops are converted to and from ideographic full stops.
+func (s *Subtitles) NormalizeCJKPunctuation(toFullWidth bool) {
+	for _, i := range s.Items {
+		for idxLine := range i.Lines {
+			for idxLineItem := range i.Lines[idxLine].Items {
+				li := &i.Lines[idxLine].Items[idxLineItem]
+				li.Text = normalizeCJKPunctuation(li.Text, toFullWidth)
+			}
+		}
+	}
+}
+
+// CJK punctuation
+var (
+	cjkFullWidthPunctuation = map[rune]rune{
+		'!': '！',
+		'(': '（',
+		')': '）',
+		',': '，',
+		'.': '。',
+		':': '：',
+		';': '；',
+		'?': '？',
+	}
+	cjkHalfWidthPunctuation = map[rune]rune{
+		'、': ',',
+		'。': '.',
+		'！': '!',
+		'（': '(',
+		'）': ')',
+		'，': ',',
+		'．': '.',
+		'：': ':',
+		'；': ';',
+		'？': '?',
+	}
+)
+
+func normalizeCJKPunctuation(i string, toFullWidth bool) string {
+	m := cjkHalfWidthPunctuation
+	if toFullWidth {
+		m = cjkFullWidthPunctuation
+	}
+	rs := []rune(i)
+	for idx, r := range rs {
+		v, ok := m[r]
+		if !ok {
+			continue
+		}
+		if toFullWidth && strings.ContainsRune(",.:", r) && ((idx > 0 && unicode.IsDigit(rs[idx-1])) || (idx < len(rs)-1 && unicode.IsDigit(rs[idx+1]))) {
+			continue
+		}
+		rs[idx] = v
+	}
+	return string(rs)
+}
 
 // Optimize optimizes subtitles
 func (s *Subtitles) Optimize() {
@@ -716,6 +1801,143 @@ func (s *Subtitles) Order() {
 	})
 }
 
+// SearchResult represents a match found by Search
+type SearchResult struct {
+	ItemIndex int
+	LineIndex int
+	Match     string
+	StartAt   time.Duration // Item's start time
+}
+
+// Search returns every match of re in the lines text, in order
+func (s Subtitles) Search(re *regexp.Regexp) (rs []SearchResult) {
+	for idxItem, i := range s.Items {
+		for idxLine, l := range i.Lines {
+			for _, m := range re.FindAllString(l.String(), -1) {
+				rs = append(rs, SearchResult{
+					ItemIndex: idxItem,
+					LineIndex: idxLine,
+					Match:     m,
+					StartAt:   i.StartAt,
+				})
+			}
+		}
+	}
+	return
+}
+
+// SplitByRegion returns one subtitles per region ID, items without region being indexed by an empty ID.
+// Items are deep-copied so that partitions can be modified independently. Partitions only keep the regions
+// and styles their items use.
+func (s Subtitles) SplitByRegion() map[string]*Subtitles {
+	o := make(map[string]*Subtitles)
+	for _, i := range s.Items {
+		// Get region ID
+		var id string
+		if i.Region != nil {
+			id = i.Region.ID
+		}
+
+		// Get partition
+		p, ok := o[id]
+		if !ok {
+			p = &Subtitles{
+				Metadata: s.Metadata,
+				Regions:  make(map[string]*Region, len(s.Regions)),
+				Styles:   make(map[string]*Style, len(s.Styles)),
+			}
+			for k, v := range s.Regions {
+				p.Regions[k] = v
+			}
+			for k, v := range s.Styles {
+				p.Styles[k] = v
+			}
+			o[id] = p
+		}
+
+		// Append item
+		p.Items = append(p.Items, copyItem(i))
+	}
+
+	// Remove unused regions and styles
+	for _, p := range o {
+		p.removeUnusedRegionsAndStyles()
+	}
+	return o
+}
+
+// copyItem deep-copies an item, regions and styles are shared
+func copyItem(i *Item) *Item {
+	j := *i
+	if i.Comments != nil {
+		j.Comments = append([]string(nil), i.Comments...)
+	}
+	if i.InlineStyle != nil {
+		sa := *i.InlineStyle
+		j.InlineStyle = &sa
+	}
+	j.Lines = make([]Line, 0, len(i.Lines))
+	for _, l := range i.Lines {
+		m := Line{VoiceName: l.VoiceName}
+		for _, li := range l.Items {
+			if li.InlineStyle != nil {
+				sa := *li.InlineStyle
+				li.InlineStyle = &sa
+			}
+			m.Items = append(m.Items, li)
+		}
+		j.Lines = append(j.Lines, m)
+	}
+	return &j
+}
+
+// StableLineOrder orders items by start time and then, unlike Order, by end time. Items sharing the same time
+// boundaries keep their source order, and so do lines within each item, which makes the order deterministic
+// whatever the source of the items.
+func (s *Subtitles) StableLineOrder() {
+	sort.SliceStable(s.Items, func(i, j int) bool {
+		if s.Items[i].StartAt != s.Items[j].StartAt {
+			return s.Items[i].StartAt < s.Items[j].StartAt
+		}
+		return s.Items[i].EndAt < s.Items[j].EndAt
+	})
+}
+
+// RemoveAfter removes items starting at or after t and cuts items overlapping t so that they end at t.
+// Unlike Trim, timings are not shifted. Items are ordered.
+func (s *Subtitles) RemoveAfter(t time.Duration) {
+	s.Order()
+	var items []*Item
+	for _, i := range s.Items {
+		// Items are ordered, therefore next items are out of boundaries as well
+		if i.StartAt >= t {
+			break
+		}
+		if i.EndAt > t {
+			i.EndAt = t
+		}
+		items = append(items, i)
+	}
+	s.Items = items
+}
+
+// RemoveBefore removes items ending at or before t and cuts items overlapping t so that they start at t.
+// Unlike Trim, timings are not shifted. Items are ordered.
+func (s *Subtitles) RemoveBefore(t time.Duration) {
+	s.Order()
+	var items []*Item
+	for _, i := range s.Items {
+		if i.EndAt <= t {
+			continue
+		}
+		if i.StartAt < t {
+			i.StartAt = t
+		}
+		items = append(items, i)
+	}
+	s.Items = items
+}
+
 // RemoveStyling removes the styling from the subtitles
 func (s *Subtitles) RemoveStyling() {
 	s.Regions = map[string]*Region{}
@@ -733,6 +1955,134 @@ func (s *Subtitles) RemoveStyling() {
 	}
 }
 
+// StripTags removes styling the same way RemoveStyling does and additionally strips HTML tags and
+// SSA override blocks residue from line items text, leaving plain text only
+func (s *Subtitles) StripTags() {
+	s.RemoveStyling()
+	for _, i := range s.Items {
+		for idxLine, l := range i.Lines {
+			for idxLineItem, li := range l.Items {
+				i.Lines[idxLine].Items[idxLineItem].Text = regexpTags.ReplaceAllString(li.Text, "")
+			}
+		}
+	}
+}
+
+// ReverseTimeline mirrors items timings about total, which can't be smaller than the subtitles duration, and
+// orders them
+func (s *Subtitles) ReverseTimeline(total time.Duration) error {
+	// Validate total
+	// Items may not be ordered, therefore Duration can't be used
+	var d time.Duration
+	for _, i := range s.Items {
+		if i.EndAt > d {
+			d = i.EndAt
+		}
+	}
+	if total < d {
+		return fmt.Errorf("astisub: total %s is smaller than duration %s", total, d)
+	}
+
+	// Loop through items
+	for _, i := range s.Items {
+		i.StartAt, i.EndAt = total-i.EndAt, total-i.StartAt
+	}
+
+	// Order
+	s.Order()
+	return nil
+}
+
+// SnapToCuts moves items time boundaries within window of a cut (e.g. a scene change) to exactly that cut.
+// Boundaries are not moved if it would make the item's end before or equal to its start.
+func (s *Subtitles) SnapToCuts(cuts []time.Duration, window time.Duration) {
+	// Nothing to do
+	if len(cuts) == 0 {
+		return
+	}
+
+	// Sort cuts
+	cs := make([]time.Duration, len(cuts))
+	copy(cs, cuts)
+	sort.Slice(cs, func(i, j int) bool { return cs[i] < cs[j] })
+
+	// Loop through items
+	for _, i := range s.Items {
+		startAt, endAt := i.StartAt, i.EndAt
+		if c, ok := nearestCut(cs, i.StartAt, window); ok {
+			startAt = c
+		}
+		if c, ok := nearestCut(cs, i.EndAt, window); ok {
+			endAt = c
+		}
+
+		// Make sure the item is not inverted
+		if startAt < endAt {
+			i.StartAt, i.EndAt = startAt, endAt
+		} else if startAt < i.EndAt {
+			i.StartAt = startAt
+		} else if i.StartAt < endAt {
+			i.EndAt = endAt
+		}
+	}
+}
+
+// nearestCut returns the sorted cut nearest to d if it's within window
+func nearestCut(cuts []time.Duration, d, window time.Duration) (time.Duration, bool) {
+	// Find first cut greater than or equal to d
+	idx := sort.Search(len(cuts), func(i int) bool { return cuts[i] >= d })
+
+	// Get nearest cut
+	var ok bool
+	var c time.Duration
+	if idx < len(cuts) && cuts[idx]-d <= window {
+		c, ok = cuts[idx], true
+	}
+	if idx > 0 && d-cuts[idx-1] <= window && (!ok || d-cuts[idx-1] < c-d) {
+		c, ok = cuts[idx-1], true
+	}
+	return c, ok
+}
+
+// SyncToPoint shifts all items by a constant offset so that item atItem starts at desired
+func (s *Subtitles) SyncToPoint(atItem int, desired time.Duration) error {
+	// Validate index
+	if atItem < 0 || atItem >= len(s.Items) {
+		return ErrInvalidItemIndex
+	}
+
+	// Add offset
+	s.Add(desired - s.Items[atItem].StartAt)
+	return nil
+}
+
+// Trim only keeps the part of the subtitles between from and to, and shifts it so that from becomes 0.
+// Items overlapping the boundaries are cut. If to is 0 or less, subtitles are kept until their end.
+func (s *Subtitles) Trim(from, to time.Duration) {
+	// Loop through items
+	var items []*Item
+	for _, i := range s.Items {
+		// Item is out of boundaries
+		if i.EndAt <= from || (to > 0 && i.StartAt >= to) {
+			continue
+		}
+
+		// Cut item
+		if i.StartAt < from {
+			i.StartAt = from
+		}
+		if to > 0 && i.EndAt > to {
+			i.EndAt = to
+		}
+
+		// Shift item
+		i.StartAt -= from
+		i.EndAt -= from
+		items = append(items, i)
+	}
+	s.Items = items
+}
+
 // Unfragment unfragments subtitles
 func (s *Subtitles) Unfragment() {
 	// Nothing to do if less than 1 element
@@ -747,7 +2097,7 @@ func (s *Subtitles) Unfragment() {
 	for i := 0; i < len(s.Items)-1; i++ {
 		for j := i + 1; j < len(s.Items); j++ {
 			// Items are the same
-			if s.Items[i].String() == s.Items[j].String() && s.Items[i].EndAt >= s.Items[j].StartAt {
+			if s.Items[i].StringSep("\n") == s.Items[j].StringSep("\n") && s.Items[i].EndAt >= s.Items[j].StartAt {
 				// Only override end time if longer
 				if s.Items[i].EndAt < s.Items[j].EndAt {
 					s.Items[i].EndAt = s.Items[j].EndAt
@@ -774,6 +2124,48 @@ func (s *Subtitles) ApplyLinearCorrection(actual1, desired1, actual2, desired2 t
 	}
 }
 
+// Validate validates every item as well as overlaps and gaps between consecutive items, which are expected to be ordered
+func (s Subtitles) Validate(rules ValidationRules) (is []ValidationIssue) {
+	for idx, i := range s.Items {
+		// Validate item
+		for _, v := range i.Validate(rules) {
+			v.ItemIndex = idx
+			is = append(is, v)
+		}
+
+		// Validate against previous item
+		if idx == 0 {
+			continue
+		}
+		p := s.Items[idx-1]
+		if gap := i.StartAt - p.EndAt; gap < 0 {
+			is = append(is, ValidationIssue{ItemIndex: idx, LineIndex: -1, Message: fmt.Sprintf("start %s is before previous item end %s", i.StartAt, p.EndAt), Type: ValidationIssueTypeOverlap})
+		} else if rules.MinGap > 0 && gap < rules.MinGap {
+			is = append(is, ValidationIssue{ItemIndex: idx, LineIndex: -1, Message: fmt.Sprintf("gap %s with previous item is smaller than %s", gap, rules.MinGap), Type: ValidationIssueTypeGap})
+		}
+	}
+	return
+}
+
+// WordCountFunc returns the number of words of a line
+type WordCountFunc func(line string) int
+
+// WordCount counts whitespace delimited words across all lines
+func (s Subtitles) WordCount() int {
+	return s.WordCountWithFunc(func(line string) int { return len(strings.Fields(line)) })
+}
+
+// WordCountWithFunc counts words across all lines using the provided function which is useful for languages
+// where whitespaces don't delimit words
+func (s Subtitles) WordCountWithFunc(fn WordCountFunc) (n int) {
+	for _, i := range s.Items {
+		for _, l := range i.Lines {
+			n += fn(l.String())
+		}
+	}
+	return
+}
+
 // Write writes subtitles to a file
 func (s Subtitles) Write(dst string) (err error) {
 	// Create the file
@@ -785,23 +2177,210 @@ func (s Subtitles) Write(dst string) (err error) {
 	defer f.Close()
 
 	// Write the content
-	switch filepath.Ext(strings.ToLower(dst)) {
-	case ".srt":
-		err = s.WriteToSRT(f)
-	case ".ssa", ".ass":
-		err = s.WriteToSSA(f)
-	case ".stl":
-		err = s.WriteToSTL(f)
-	case ".ttml":
-		err = s.WriteToTTML(f)
-	case ".vtt":
-		err = s.WriteToWebVTT(f)
-	default:
+	if err = s.writeToFormat(f, strings.TrimPrefix(filepath.Ext(strings.ToLower(dst)), ".")); err == ErrInvalidFormat {
 		err = ErrInvalidExtension
 	}
 	return
 }
 
+// ToString writes subtitles in the provided format and returns them as a string. Format can be "fcpxml", "srt",
+// "ssa", "ass", "stl", "itt", "ttml" or "vtt".
+func (s Subtitles) ToString(format string) (o string, err error) {
+	buf := &bytes.Buffer{}
+	if err = s.writeToFormat(buf, strings.ToLower(format)); err != nil {
+		return
+	}
+	o = buf.String()
+	return
+}
+
+// ToSRTString writes subtitles in .srt format and returns them as a string
+func (s Subtitles) ToSRTString() (string, error) {
+	return s.ToString("srt")
+}
+
+// ToWebVTTString writes subtitles in .vtt format and returns them as a string
+func (s Subtitles) ToWebVTTString() (string, error) {
+	return s.ToString("vtt")
+}
+
+func (s Subtitles) writeToFormat(o io.Writer, format string) (err error) {
+	switch format {
+	case "fcpxml":
+		err = s.WriteToFCPXML(o, FCPXMLOptions{})
+	case "srt":
+		err = s.WriteToSRT(o)
+	case "ssa":
+		err = s.WriteToSSA(o)
+	case "ass":
+		err = s.WriteToASS(o)
+	case "stl":
+		err = s.WriteToSTL(o)
+	case "itt":
+		err = s.WriteToITT(o)
+	case "ttml":
+		err = s.WriteToTTML(o)
+	case "vtt":
+		err = s.WriteToWebVTT(o)
+	default:
+		err = ErrInvalidFormat
+	}
+	return
+}
+
+// ParseDuration parses a single duration written in the provided format which can be "srt", "ssa", "ass", "stl",
+// "spruce", "ttml" or "vtt". Framerate is in frame/s and is only used by frames based formats and expressions.
+// ErrInvalidFormat is returned if the format is invalid.
+func ParseDuration(format, i string, framerate int) (time.Duration, error) {
+	switch format {
+	case "srt":
+		return parseDurationSRT(i)
+	case "ssa", "ass":
+		return parseDurationSSA(i)
+	case "stl":
+		return parseDurationSTL(i, framerate)
+	case "spruce":
+		return parseDurationSpruce(i, framerate)
+	case "ttml":
+		var d TTMLInDuration
+		if err := d.UnmarshalText([]byte(i)); err != nil {
+			return 0, err
+		}
+		d.framerate = framerate
+		return d.duration(), nil
+	case "vtt":
+		return parseDurationWebVTT(i)
+	}
+	return 0, ErrInvalidFormat
+}
+
+// FormatDuration formats a single duration in the provided format, see ParseDuration for available formats
+// and framerate. ErrInvalidFormat is returned if the format is invalid.
+func FormatDuration(format string, d time.Duration, framerate int) (string, error) {
+	switch format {
+	case "srt":
+		return formatDurationSRT(d, ","), nil
+	case "ssa", "ass":
+		return formatDurationSSA(d), nil
+	case "stl":
+		if framerate <= 0 {
+			return "", fmt.Errorf("astisub: invalid framerate %d", framerate)
+		}
+		return formatDurationSTL(d, framerate), nil
+	case "spruce":
+		if framerate <= 0 {
+			return "", fmt.Errorf("astisub: invalid framerate %d", framerate)
+		}
+		return formatDurationSpruce(d, framerate), nil
+	case "ttml":
+		b, err := TTMLOutDuration(d).MarshalText()
+		return string(b), err
+	case "vtt":
+		return formatDurationWebVTT(d), nil
+	}
+	return "", ErrInvalidFormat
+}
+
+// DurationFormat represents the way durations are written and parsed by the various formats
+// e.g. "00:00:01,500" is {Digits: 3, Sep: ","} and "00:00:01:12" is {FrameRate: 25, Sep: ":", UseFrames: true}
+type DurationFormat struct {
+	Digits      int    // Number of fractional digits, ignored when using frames
+	DropFrame   bool   // NTSC drop frame timecode when using frames, FrameRate being the nominal one (e.g. 30 for 29.97)
+	FrameRate   int    // In frame/s, mandatory when using frames
+	RoundFrames bool   // Frames are rounded to the nearest one instead of being floored
+	Sep         string // Separator between the seconds and their fraction
+	UseFrames   bool   // The fraction of second is a number of frames
+}
+
+// Format formats a duration
+func (f DurationFormat) Format(d time.Duration) string {
+	// Not using frames
+	if !f.UseFrames || f.FrameRate <= 0 {
+		return formatDuration(d, f.Sep, f.Digits)
+	}
+
+	// Get frames
+	var frames int64
+	if f.DropFrame {
+		n := float64(d) * float64(f.FrameRate) * 1000 / 1001 / float64(time.Second)
+		if f.RoundFrames {
+			n = math.Round(n)
+		}
+		frames = int64(dropFrameTimecodeFrames(int(n), f.FrameRate))
+	} else if f.RoundFrames {
+		frames = int64(math.Round(float64(d) * float64(f.FrameRate) / float64(time.Second)))
+	} else {
+		frames = int64(d) * int64(f.FrameRate) / int64(time.Second)
+	}
+	var s = formatDuration(time.Duration(frames/int64(f.FrameRate))*time.Second, f.Sep, 3)
+	return strings.TrimSuffix(s, "000") + astikit.StrPad(strconv.FormatInt(frames%int64(f.FrameRate), 10), '0', 2, astikit.PadLeft)
+}
+
+// Parse parses a duration
+func (f DurationFormat) Parse(i string) (d time.Duration, err error) {
+	// Not using frames
+	if !f.UseFrames {
+		return parseDuration(i, f.Sep, f.Digits)
+	}
+
+	// Invalid framerate
+	if f.FrameRate <= 0 {
+		err = fmt.Errorf("astisub: invalid framerate %d", f.FrameRate)
+		return
+	}
+
+	// Remove separators
+	s := strings.ReplaceAll(strings.TrimSpace(i), ":", "")
+	if f.Sep != "" {
+		s = strings.ReplaceAll(s, f.Sep, "")
+	}
+	if len(s) != 8 {
+		err = fmt.Errorf("astisub: invalid duration %s", i)
+		return
+	}
+
+	// Parse hours, minutes, seconds and frames
+	var vs [4]int
+	for idx := range vs {
+		v := s[idx*2 : idx*2+2]
+		if vs[idx], err = strconv.Atoi(v); err != nil {
+			err = fmt.Errorf("astisub: atoi of %s failed: %w", v, err)
+			return
+		}
+	}
+
+	// Set duration
+	if f.DropFrame {
+		d = dropFrameDuration(vs[0], vs[1], vs[2], vs[3], f.FrameRate)
+		return
+	}
+	d = time.Duration(vs[0])*time.Hour + time.Duration(vs[1])*time.Minute + time.Duration(vs[2])*time.Second + time.Duration(1e9*vs[3]/f.FrameRate)*time.Nanosecond
+	return
+}
+
+// dropFrameDuration returns the duration of an NTSC drop frame timecode. Frame numbers 0 and 1 (0 to 3 at 60 frame/s)
+// are skipped every minute except every tenth one, and frames last 1001/1000 of their nominal duration.
+func dropFrameDuration(hours, minutes, seconds, frames, frameRate int) time.Duration {
+	drop := frameRate / 15
+	m := 60*hours + minutes
+	n := (3600*hours+60*minutes+seconds)*frameRate + frames - drop*(m-m/10)
+	return time.Duration(int64(n) * 1001 * int64(time.Second) / int64(frameRate*1000))
+}
+
+// dropFrameTimecodeFrames converts an actual number of frames to the number of frames displayed by an NTSC drop
+// frame timecode, i.e. with skipped frame numbers added back
+func dropFrameTimecodeFrames(n, frameRate int) int {
+	drop := frameRate / 15
+	perMinute := 60*frameRate - drop
+	perTenMinutes := 600*frameRate - 9*drop
+	d, m := n/perTenMinutes, n%perTenMinutes
+	n += 9 * drop * d
+	if m > drop {
+		n += drop * ((m - drop) / perMinute)
+	}
+	return n
+}
+
 // parseDuration parses a duration in "00:00:00.000", "00:00:00,000" or "0:00:00:00" format
 func parseDuration(i, millisecondSep string, numberOfMillisecondDigits int) (o time.Duration, err error) {
 	// Split milliseconds
@@ -923,12 +2502,62 @@ func htmlTokenAttribute(t *html.Token, key string) *string {
 	return nil
 }
 
+// parsePercent parses a percentage such as "10%" or "10.5%"
+func parsePercent(i string) (float64, bool) {
+	i = strings.TrimSpace(i)
+	if !strings.HasSuffix(i, "%") {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(strings.TrimSuffix(i, "%"), 64)
+	if err != nil {
+		return 0, false
+	}
+	return f, true
+}
+
+// parsePercentPair parses a pair of percentages such as "10% 20%"
+func parsePercentPair(i string) (float64, float64, bool) {
+	fields := strings.Fields(i)
+	if len(fields) != 2 {
+		return 0, 0, false
+	}
+	a, ok1 := parsePercent(fields[0])
+	b, ok2 := parsePercent(fields[1])
+	return a, b, ok1 && ok2
+}
+
 func escapeHTML(i string) string {
 	return htmlEscaper.Replace(i)
 }
 
+func escapeHTMLWebVTT(i string) string {
+	return htmlEscaperWebVTT.Replace(i)
+}
+
 func unescapeHTML(i string) string {
-	return htmlUnescaper.Replace(i)
+	return htmlRegexpEntity.ReplaceAllStringFunc(i, func(e string) string {
+		// Named entity
+		n := e[1 : len(e)-1]
+		if !strings.HasPrefix(n, "#") {
+			if v, ok := htmlEntities[n]; ok {
+				return v
+			}
+			return e
+		}
+
+		// Numeric entity
+		var v uint64
+		var err error
+		if strings.HasPrefix(n, "#x") || strings.HasPrefix(n, "#X") {
+			v, err = strconv.ParseUint(n[2:], 16, 32)
+		} else {
+			v, err = strconv.ParseUint(n[1:], 10, 32)
+		}
+		if err != nil || v == 0 || !utf8.ValidRune(rune(v)) {
+			return e
+		}
+		return string(rune(v))
+	})
 }
 
 func newScanner(i io.Reader) *bufio.Scanner {
@@ -942,6 +2571,10 @@ func newScanner(i io.Reader) *bufio.Scanner {
 				// We have a line terminated by single newline.
 				return i + 1, data[0:i], nil
 			}
+			// We need more data to know whether \r is followed by \n
+			if len(data) == i+1 && !atEOF {
+				return 0, nil, nil
+			}
 			advance = i + 1
 			if len(data) > i+1 && data[i+1] == '\n' {
 				advance += 1
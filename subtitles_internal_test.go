@@ -16,6 +16,21 @@ func TestColor(t *testing.T) {
 	assert.Equal(t, Color{Alpha: 0x12, Blue: 0x34, Green: 0x56, Red: 0x78}, *c)
 	assert.Equal(t, "785634", c.TTMLString())
 	assert.Equal(t, "12345678", c.SSAString())
+	assert.Equal(t, "#785634", c.Hex(false))
+	assert.Equal(t, "#785634ed", c.Hex(true))
+	c, err = ParseHexColor("#785634ed")
+	assert.NoError(t, err)
+	assert.Equal(t, Color{Alpha: 0x12, Blue: 0x34, Green: 0x56, Red: 0x78}, *c)
+	c, err = ParseHexColor("#785634")
+	assert.NoError(t, err)
+	assert.Equal(t, Color{Blue: 0x34, Green: 0x56, Red: 0x78}, *c)
+	c, err = ParseHexColor("#f0a")
+	assert.NoError(t, err)
+	assert.Equal(t, Color{Blue: 0xaa, Red: 0xff}, *c)
+	_, err = ParseHexColor("#7856")
+	assert.Error(t, err)
+	_, err = ParseHexColor("#zzzzzz")
+	assert.Error(t, err)
 }
 
 func TestParseDuration(t *testing.T) {
@@ -38,6 +53,14 @@ func TestParseDuration(t *testing.T) {
 	d, err = parseDuration("1:23:45.67", ".", 2)
 	assert.NoError(t, err)
 	assert.Equal(t, time.Hour+23*time.Minute+45*time.Second+67*time.Millisecond, d)
+
+	// Loosely formatted SSA timestamps
+	d, err = parseDurationSSA("0:1:5.3")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute+5*time.Second+300*time.Millisecond, d)
+	d, err = parseDurationSSA("0:00:00.05")
+	assert.NoError(t, err)
+	assert.Equal(t, 50*time.Millisecond, d)
 }
 
 func TestFormatDuration(t *testing.T) {
@@ -66,3 +89,50 @@ func TestFormatDuration(t *testing.T) {
 	s = formatDuration(12*time.Hour+34*time.Minute+56*time.Second+999*time.Millisecond, ",", 2)
 	assert.Equal(t, "12:34:56,99", s)
 }
+
+func TestHTMLEscaping(t *testing.T) {
+	for _, v := range []struct {
+		escaped   string
+		unescaped string
+	}{
+		{escaped: "a &amp; b &lt; c", unescaped: "a & b < c"},
+		{escaped: "a&nbsp;b", unescaped: "a\u00a0b"},
+		{escaped: "&lrm;abc", unescaped: "\u200eabc"},
+		{escaped: "&rlm;שלום", unescaped: "\u200fשלום"},
+		{escaped: "&amp;lrm;", unescaped: "&lrm;"},
+	} {
+		assert.Equal(t, v.unescaped, unescapeHTML(v.escaped))
+		assert.Equal(t, v.escaped, escapeHTMLWebVTT(v.unescaped))
+		assert.Equal(t, v.unescaped, unescapeHTML(escapeHTMLWebVTT(v.unescaped)))
+	}
+
+	// Bidi marks are kept as is outside WebVTT
+	assert.Equal(t, "\u200e&amp;\u200f", escapeHTML("\u200e&\u200f"))
+
+	// Numeric entities
+	assert.Equal(t, "中文 é", unescapeHTML("&#x4E2D;&#25991; &#233;"))
+	assert.Equal(t, "\u200f", unescapeHTML("&#x200f;"))
+	assert.Equal(t, "a &amp;#38; b", escapeHTML(unescapeHTML("a &amp;#38; b")))
+
+	// Unknown or invalid entities
+	assert.Equal(t, "&foo; &#xFFFFFFFF; &#0;", unescapeHTML("&foo; &#xFFFFFFFF; &#0;"))
+	assert.Equal(t, "a > b", unescapeHTML("a &gt; b"))
+}
+
+func TestPropagateSRTAttributesAlignment(t *testing.T) {
+	for _, v := range []struct {
+		displayAlign string
+		position     byte
+		textAlign    string
+	}{
+		{displayAlign: "after", position: 1, textAlign: "left"},
+		{displayAlign: "after", position: 2, textAlign: "center"},
+		{displayAlign: "center", position: 6, textAlign: "right"},
+		{displayAlign: "before", position: 8, textAlign: "center"},
+	} {
+		sa := &StyleAttributes{SRTPosition: v.position}
+		sa.propagateSRTAttributes()
+		assert.Equal(t, v.displayAlign, *sa.TTMLDisplayAlign)
+		assert.Equal(t, v.textAlign, *sa.TTMLTextAlign)
+	}
+}
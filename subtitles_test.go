@@ -2,10 +2,17 @@ package astisub_test
 
 import (
 	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/asticode/go-astikit"
 	"github.com/asticode/go-astisub"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -195,6 +202,22 @@ func TestSubtitles_Unfragment(t *testing.T) {
 	}
 }
 
+func TestSubtitles_UnfragmentLineBreaks(t *testing.T) {
+	s := &astisub.Subtitles{Items: []*astisub.Item{{
+		Lines:   []astisub.Line{{Items: []astisub.LineItem{{Text: "a - b"}}}},
+		StartAt: 1 * time.Second,
+		EndAt:   2 * time.Second,
+	}, {
+		Lines:   []astisub.Line{{Items: []astisub.LineItem{{Text: "a"}}}, {Items: []astisub.LineItem{{Text: "b"}}}},
+		StartAt: 2 * time.Second,
+		EndAt:   3 * time.Second,
+	}}}
+	assert.Equal(t, s.Items[0].String(), s.Items[1].String())
+	assert.Equal(t, "a\nb", s.Items[1].StringSep("\n"))
+	s.Unfragment()
+	assert.Len(t, s.Items, 2)
+}
+
 func TestSubtitles_Merge(t *testing.T) {
 	var s1 = &astisub.Subtitles{Items: []*astisub.Item{{EndAt: 3 * time.Second, StartAt: time.Second}, {EndAt: 8 * time.Second, StartAt: 5 * time.Second}, {EndAt: 12 * time.Second, StartAt: 10 * time.Second}}, Regions: map[string]*astisub.Region{"region_0": {ID: "region_0"}, "region_1": {ID: "region_1"}}, Styles: map[string]*astisub.Style{"style_0": {ID: "style_0"}, "style_1": {ID: "style_1"}}}
 	var s2 = &astisub.Subtitles{Items: []*astisub.Item{{EndAt: 4 * time.Second, StartAt: 2 * time.Second}, {EndAt: 7 * time.Second, StartAt: 6 * time.Second}, {EndAt: 11 * time.Second, StartAt: 9 * time.Second}, {EndAt: 14 * time.Second, StartAt: 13 * time.Second}}, Regions: map[string]*astisub.Region{"region_1": {ID: "region_1"}, "region_2": {ID: "region_2"}}, Styles: map[string]*astisub.Style{"style_1": {ID: "style_1"}, "style_2": {ID: "style_2"}}}
@@ -211,6 +234,17 @@ func TestSubtitles_Merge(t *testing.T) {
 	assert.Equal(t, len(s1.Styles), 3)
 }
 
+func TestSubtitles_MergeItems(t *testing.T) {
+	var s = mockSubtitles()
+	assert.Equal(t, astisub.ErrInvalidItemIndexes, s.MergeItems(1, 0))
+	assert.Equal(t, astisub.ErrInvalidItemIndexes, s.MergeItems(1, 2))
+	assert.NoError(t, s.MergeItems(0, 1))
+	assert.Len(t, s.Items, 1)
+	assert.Equal(t, time.Second, s.Items[0].StartAt)
+	assert.Equal(t, 7*time.Second, s.Items[0].EndAt)
+	assert.Equal(t, []astisub.Line{{Items: []astisub.LineItem{{Text: "subtitle-1"}}}, {Items: []astisub.LineItem{{Text: "subtitle-2"}}}}, s.Items[0].Lines)
+}
+
 func TestSubtitles_Optimize(t *testing.T) {
 	var s = &astisub.Subtitles{
 		Items: []*astisub.Item{
@@ -248,6 +282,169 @@ func TestSubtitles_Order(t *testing.T) {
 	assert.Equal(t, 5*time.Second, s.Items[3].EndAt)
 }
 
+func TestNewStyleAttributes(t *testing.T) {
+	sa := astisub.NewStyleAttributes(astisub.StyleSpec{
+		Bold:          true,
+		Color:         astisub.ColorRed,
+		Italic:        true,
+		Justification: &astisub.JustificationRight,
+	})
+	assert.True(t, sa.SRTBold)
+	assert.True(t, sa.SRTItalics)
+	assert.False(t, sa.SRTUnderline)
+	assert.Equal(t, "#ff0000", *sa.SRTColor)
+	assert.True(t, *sa.SSABold)
+	assert.True(t, *sa.SSAItalic)
+	assert.Equal(t, 3, *sa.SSAAlignment)
+	assert.Equal(t, astisub.ColorRed, sa.SSAPrimaryColour)
+	assert.Equal(t, astisub.JustificationRight, *sa.STLJustification)
+	assert.Equal(t, "bold", *sa.TTMLFontWeight)
+	assert.Equal(t, "italic", *sa.TTMLFontStyle)
+	assert.Nil(t, sa.TTMLTextDecoration)
+	assert.Equal(t, "#ff0000", *sa.TTMLColor)
+	assert.Equal(t, "right", *sa.TTMLTextAlign)
+	assert.Equal(t, "right", sa.WebVTTAlign)
+	assert.Equal(t, []astisub.WebVTTTag{{Name: "b"}, {Name: "i"}}, sa.WebVTTTags)
+
+	// Empty spec
+	sa = astisub.NewStyleAttributes(astisub.StyleSpec{})
+	assert.False(t, *sa.SSABold)
+	assert.Nil(t, sa.TTMLColor)
+	assert.Equal(t, "", sa.WebVTTAlign)
+}
+
+func TestSubtitles_DedupeStyles(t *testing.T) {
+	sa := &astisub.Style{ID: "a", InlineStyle: &astisub.StyleAttributes{SSABold: astikit.BoolPtr(true)}}
+	sb := &astisub.Style{ID: "b", InlineStyle: &astisub.StyleAttributes{SSABold: astikit.BoolPtr(true)}}
+	sc := &astisub.Style{ID: "c", InlineStyle: &astisub.StyleAttributes{}, Style: sb}
+	sd := &astisub.Style{ID: "d", Style: sa}
+	se := &astisub.Style{ID: "e", InlineStyle: &astisub.StyleAttributes{SSAItalic: astikit.BoolPtr(true)}}
+	r := &astisub.Region{ID: "r", Style: sd}
+	s := &astisub.Subtitles{
+		Items: []*astisub.Item{
+			{Lines: []astisub.Line{{Items: []astisub.LineItem{{Style: sd}, {Style: se}}}}, Region: r, Style: sb},
+			{Style: se},
+		},
+		Regions: map[string]*astisub.Region{"r": r},
+		Styles:  map[string]*astisub.Style{"a": sa, "b": sb, "c": sc, "d": sd, "e": se},
+	}
+	s.DedupeStyles()
+	assert.Equal(t, map[string]*astisub.Style{"a": sa, "c": sc, "e": se}, s.Styles)
+	assert.Same(t, sa, sc.Style)
+	assert.Same(t, sc, r.Style)
+	assert.Same(t, sa, s.Items[0].Style)
+	assert.Same(t, sc, s.Items[0].Lines[0].Items[0].Style)
+	assert.Same(t, se, s.Items[0].Lines[0].Items[1].Style)
+	assert.Same(t, se, s.Items[1].Style)
+}
+
+func TestSubtitles_DurationHistogram(t *testing.T) {
+	s := astisub.Subtitles{Items: []*astisub.Item{
+		{StartAt: 0, EndAt: 500 * time.Millisecond},
+		{StartAt: time.Second, EndAt: 2 * time.Second},
+		{StartAt: 2 * time.Second, EndAt: 3999 * time.Millisecond},
+		{StartAt: 4 * time.Second, EndAt: 7 * time.Second},
+		{StartAt: 8 * time.Second, EndAt: 7500 * time.Millisecond},
+	}}
+	assert.Nil(t, s.DurationHistogram(0))
+	assert.Equal(t, map[time.Duration]int{
+		-time.Second:    1,
+		0:               1,
+		time.Second:     2,
+		3 * time.Second: 1,
+	}, s.DurationHistogram(time.Second))
+}
+
+func TestSubtitles_Search(t *testing.T) {
+	s := mockSubtitles()
+	s.Items[1].Lines = append(s.Items[1].Lines, astisub.Line{Items: []astisub.LineItem{{Text: "subtitle-3"}, {Text: "subtitle-4"}}})
+	assert.Equal(t, []astisub.SearchResult{
+		{ItemIndex: 1, LineIndex: 0, Match: "subtitle-2", StartAt: 3 * time.Second},
+		{ItemIndex: 1, LineIndex: 1, Match: "subtitle-3", StartAt: 3 * time.Second},
+		{ItemIndex: 1, LineIndex: 1, Match: "subtitle-4", StartAt: 3 * time.Second},
+	}, s.Search(regexp.MustCompile(`subtitle-[2-9]`)))
+	assert.Empty(t, s.Search(regexp.MustCompile(`foo`)))
+}
+
+func TestSubtitles_StripTags(t *testing.T) {
+	s := &astisub.Subtitles{
+		Items: []*astisub.Item{
+			{
+				Lines: []astisub.Line{{
+					Items: []astisub.LineItem{
+						{
+							InlineStyle: &astisub.StyleAttributes{SSAEffect: `{\pos(400,570)}`},
+							Text:        `{\an8}<i>italic</i> text`,
+						},
+						{Text: "<b>bold</b>{\\i1}"},
+						{Text: "{not a tag}"},
+					},
+				}},
+				InlineStyle: &astisub.StyleAttributes{},
+				Style:       &astisub.Style{},
+			},
+		},
+		Styles: map[string]*astisub.Style{"style": {}},
+	}
+	s.StripTags()
+	assert.Equal(t, &astisub.Subtitles{
+		Items: []*astisub.Item{
+			{
+				Lines: []astisub.Line{{
+					Items: []astisub.LineItem{{Text: "italic text"}, {Text: "bold"}, {Text: "{not a tag}"}},
+				}},
+			},
+		},
+		Regions: map[string]*astisub.Region{},
+		Styles:  map[string]*astisub.Style{},
+	}, s)
+}
+
+func TestSubtitles_StableLineOrder(t *testing.T) {
+	s := &astisub.Subtitles{Items: []*astisub.Item{
+		{StartAt: 2 * time.Second, EndAt: 3 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "1"}}}}},
+		{StartAt: time.Second, EndAt: 3 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "2"}}}}},
+		{StartAt: time.Second, EndAt: 2 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "3"}}}, {Items: []astisub.LineItem{{Text: "4"}}}}},
+		{StartAt: time.Second, EndAt: 2 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "5"}}}}},
+	}}
+	s.StableLineOrder()
+	var texts []string
+	for _, i := range s.Items {
+		texts = append(texts, i.StringSep("|"))
+	}
+	assert.Equal(t, []string{"3|4", "5", "2", "1"}, texts)
+}
+
+func TestSubtitles_RemoveBeforeAndAfter(t *testing.T) {
+	// Before
+	s := &astisub.Subtitles{Items: []*astisub.Item{
+		{StartAt: 5 * time.Second, EndAt: 7 * time.Second},
+		{StartAt: 0, EndAt: time.Second},
+		{StartAt: 2 * time.Second, EndAt: 4 * time.Second},
+		{StartAt: time.Second, EndAt: 2 * time.Second},
+	}}
+	s.RemoveBefore(3 * time.Second)
+	require.Len(t, s.Items, 2)
+	assert.Equal(t, 3*time.Second, s.Items[0].StartAt)
+	assert.Equal(t, 4*time.Second, s.Items[0].EndAt)
+	assert.Equal(t, 5*time.Second, s.Items[1].StartAt)
+	assert.Equal(t, 7*time.Second, s.Items[1].EndAt)
+
+	// After
+	s = &astisub.Subtitles{Items: []*astisub.Item{
+		{StartAt: 5 * time.Second, EndAt: 7 * time.Second},
+		{StartAt: 0, EndAt: time.Second},
+		{StartAt: 2 * time.Second, EndAt: 4 * time.Second},
+		{StartAt: time.Second, EndAt: 2 * time.Second},
+	}}
+	s.RemoveAfter(3 * time.Second)
+	require.Len(t, s.Items, 3)
+	assert.Equal(t, time.Duration(0), s.Items[0].StartAt)
+	assert.Equal(t, time.Second, s.Items[1].StartAt)
+	assert.Equal(t, 2*time.Second, s.Items[2].StartAt)
+	assert.Equal(t, 3*time.Second, s.Items[2].EndAt)
+}
+
 func TestSubtitles_RemoveStyling(t *testing.T) {
 	s := &astisub.Subtitles{
 		Items: []*astisub.Item{
@@ -280,6 +477,86 @@ func TestSubtitles_RemoveStyling(t *testing.T) {
 	}, s)
 }
 
+func TestSubtitles_Trim(t *testing.T) {
+	var s = mockSubtitles()
+	s.Trim(2*time.Second, 5*time.Second)
+	require.Len(t, s.Items, 2)
+	assert.Equal(t, time.Duration(0), s.Items[0].StartAt)
+	assert.Equal(t, time.Second, s.Items[0].EndAt)
+	assert.Equal(t, time.Second, s.Items[1].StartAt)
+	assert.Equal(t, 3*time.Second, s.Items[1].EndAt)
+	s = mockSubtitles()
+	s.Trim(3*time.Second, 0)
+	require.Len(t, s.Items, 1)
+	assert.Equal(t, "subtitle-2", s.Items[0].String())
+	assert.Equal(t, 4*time.Second, s.Items[0].EndAt)
+}
+
+func TestSubtitles_Anonymize(t *testing.T) {
+	s := mockSubtitles()
+	s.Items[0].Lines[0].Items[0].Text = "Hello world"
+	a := s.Anonymize()
+	require.Len(t, a.Items, 2)
+	assert.Equal(t, "xxxxx xxxxx", a.Items[0].String())
+	assert.Equal(t, "xxxxxxxxxx", a.Items[1].String())
+	assert.Equal(t, time.Second, a.Items[0].StartAt)
+	assert.Equal(t, 3*time.Second, a.Items[0].EndAt)
+	assert.Equal(t, "Hello world", s.Items[0].String())
+}
+
+func TestSubtitles_SnapToCuts(t *testing.T) {
+	s := mockSubtitles()
+	s.SnapToCuts([]time.Duration{7100 * time.Millisecond, 2900 * time.Millisecond, 900 * time.Millisecond}, 200*time.Millisecond)
+	require.Len(t, s.Items, 2)
+	assert.Equal(t, 900*time.Millisecond, s.Items[0].StartAt)
+	assert.Equal(t, 2900*time.Millisecond, s.Items[0].EndAt)
+	assert.Equal(t, 2900*time.Millisecond, s.Items[1].StartAt)
+	assert.Equal(t, 7100*time.Millisecond, s.Items[1].EndAt)
+
+	// Items are not inverted
+	s = &astisub.Subtitles{Items: []*astisub.Item{{StartAt: time.Second, EndAt: 1100 * time.Millisecond}}}
+	s.SnapToCuts([]time.Duration{1050 * time.Millisecond}, 100*time.Millisecond)
+	assert.Equal(t, 1050*time.Millisecond, s.Items[0].StartAt)
+	assert.Equal(t, 1100*time.Millisecond, s.Items[0].EndAt)
+}
+
+func TestSubtitles_ExplodeLines(t *testing.T) {
+	s := mockSubtitles()
+	s.Items[1].Lines = append(s.Items[1].Lines, astisub.Line{Items: []astisub.LineItem{{Text: "subtitle-3"}}, VoiceName: "Bob"})
+	s.ExplodeLines(true)
+	require.Len(t, s.Items, 3)
+	assert.Equal(t, "subtitle-1", s.Items[0].String())
+	assert.Equal(t, "subtitle-2", s.Items[1].String())
+	assert.Equal(t, 3*time.Second, s.Items[1].StartAt)
+	assert.Equal(t, 5*time.Second, s.Items[1].EndAt)
+	assert.Equal(t, "subtitle-3", s.Items[2].String())
+	assert.Equal(t, "Bob", s.Items[2].Lines[0].VoiceName)
+	assert.Equal(t, 5*time.Second, s.Items[2].StartAt)
+	assert.Equal(t, 7*time.Second, s.Items[2].EndAt)
+
+	s = mockSubtitles()
+	s.Items[1].Lines = append(s.Items[1].Lines, astisub.Line{Items: []astisub.LineItem{{Text: "subtitle-3"}}})
+	s.ExplodeLines(false)
+	require.Len(t, s.Items, 3)
+	assert.Equal(t, 3*time.Second, s.Items[2].StartAt)
+	assert.Equal(t, 7*time.Second, s.Items[2].EndAt)
+}
+
+func TestSubtitles_LinesExceedingCPL(t *testing.T) {
+	s := mockSubtitles()
+	s.Items[1].Lines = append(s.Items[1].Lines, astisub.Line{Items: []astisub.LineItem{{Text: "日本語の字幕"}, {Text: "です"}}})
+	assert.Empty(t, s.LinesExceedingCPL(10))
+	assert.Equal(t, []astisub.LineRef{
+		{ItemIndex: 0, LineIndex: 0, Length: 10},
+		{ItemIndex: 1, LineIndex: 0, Length: 10},
+	}, s.LinesExceedingCPL(9))
+	assert.Equal(t, []astisub.LineRef{
+		{ItemIndex: 0, LineIndex: 0, Length: 10},
+		{ItemIndex: 1, LineIndex: 0, Length: 10},
+		{ItemIndex: 1, LineIndex: 1, Length: 9},
+	}, s.LinesExceedingCPL(8))
+}
+
 func TestSubtitles_ApplyLinearCorrection(t *testing.T) {
 	s := &astisub.Subtitles{Items: []*astisub.Item{
 		{
@@ -363,3 +640,486 @@ func TestNewScanner(t *testing.T) {
 		assert.Equal(t, "else for that matter.", s.Items[2].Lines[1].String())
 	}
 }
+
+type mockTextTransformer struct {
+	err error
+}
+
+func (t mockTextTransformer) Transform(text string, ctx astisub.ItemContext) (string, error) {
+	if t.err != nil && ctx.ItemIndex == 1 {
+		return "", t.err
+	}
+	return strings.ToUpper(text), nil
+}
+
+func TestSubtitles_ApplyTransform(t *testing.T) {
+	s := mockSubtitles()
+	err := s.ApplyTransform(mockTextTransformer{err: errors.New("test")})
+	assert.EqualError(t, err, "astisub: transforming item 2 line 1 line item 1 failed: test")
+	assert.Equal(t, "subtitle-1", s.Items[0].String())
+	err = s.ApplyTransform(mockTextTransformer{})
+	require.NoError(t, err)
+	assert.Equal(t, "SUBTITLE-1", s.Items[0].String())
+	assert.Equal(t, "SUBTITLE-2", s.Items[1].String())
+}
+
+func TestOpenLimits(t *testing.T) {
+	_, err := astisub.Open(astisub.Options{Filename: "./testdata/example-in.srt", MaxBytes: 100})
+	assert.Equal(t, astisub.ErrMaxBytesExceeded, err)
+	_, err = astisub.Open(astisub.Options{Filename: "./testdata/example-in.srt", MaxItems: 5})
+	assert.Equal(t, astisub.ErrMaxItemsExceeded, err)
+	_, err = astisub.Open(astisub.Options{Filename: "./testdata/example-in.srt", MaxLineLength: 10})
+	assert.Equal(t, astisub.ErrMaxLineLengthExceeded, err)
+	s, err := astisub.Open(astisub.Options{Filename: "./testdata/example-in.srt", MaxBytes: 1 << 20, MaxItems: 6, MaxLineLength: 100})
+	require.NoError(t, err)
+	assertSubtitleItems(t, s)
+}
+
+func TestOpenKeepRawText(t *testing.T) {
+	for _, ext := range []string{"srt", "ssa", "vtt"} {
+		s, err := astisub.Open(astisub.Options{Filename: "./testdata/example-in." + ext, KeepRawText: true})
+		require.NoError(t, err, ext)
+		assert.NotEmpty(t, s.Items[0].Raw, ext)
+	}
+
+	// Options.KeepRawText is the only one used when opening
+	s, err := astisub.Open(astisub.Options{Filename: "./testdata/example-in.srt", SRT: astisub.SRTOptions{KeepRawText: true}})
+	require.NoError(t, err)
+	assert.Empty(t, s.Items[0].Raw)
+}
+
+func TestOpenMaxItems(t *testing.T) {
+	for _, ext := range []string{"srt", "ssa", "stl", "ttml", "vtt"} {
+		_, err := astisub.Open(astisub.Options{Filename: "./testdata/example-in." + ext, MaxItems: 5})
+		assert.Equal(t, astisub.ErrMaxItemsExceeded, err, ext)
+		_, err = astisub.Open(astisub.Options{Filename: "./testdata/example-in." + ext, MaxItems: 6})
+		assert.NoError(t, err, ext)
+	}
+	_, err := astisub.Open(astisub.Options{Filename: "./testdata/example-in-spruce.stl", MaxItems: 5})
+	assert.Equal(t, astisub.ErrMaxItemsExceeded, err)
+	_, err = astisub.Open(astisub.Options{Filename: "./testdata/example-in-spruce.stl", MaxItems: 6})
+	assert.NoError(t, err)
+
+	// Reading stops as soon as the limit is exceeded
+	pr, pw := io.Pipe()
+	pw.CloseWithError(errors.New("test"))
+	r := io.MultiReader(strings.NewReader(`1
+00:00:01,000 --> 00:00:02,000
+a
+
+2
+00:00:03,000 --> 00:00:04,000
+b
+
+3
+00:00:05,000 --> 00:00:06,000
+c
+`), pr)
+	_, err = astisub.ReadFromSRTWithOptions(r, astisub.SRTOptions{MaxItems: 2})
+	assert.Equal(t, astisub.ErrMaxItemsExceeded, err)
+}
+
+func TestOpenRequireItems(t *testing.T) {
+	dir, err := ioutil.TempDir("", "astisub")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "empty.vtt")
+	require.NoError(t, ioutil.WriteFile(p, []byte("WEBVTT\n"), 0644))
+
+	s, err := astisub.Open(astisub.Options{Filename: p})
+	require.NoError(t, err)
+	assert.Len(t, s.Items, 0)
+	_, err = astisub.Open(astisub.Options{Filename: p, RequireItems: true})
+	assert.Equal(t, astisub.ErrNoItemsFound, err)
+	_, err = astisub.Open(astisub.Options{Filename: "./testdata/example-in.srt", RequireItems: true})
+	require.NoError(t, err)
+}
+
+func TestSubtitles_CollapseRepeats(t *testing.T) {
+	s := &astisub.Subtitles{Items: []*astisub.Item{
+		{StartAt: 0, EndAt: 2 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "chorus"}}}}},
+		{StartAt: 2 * time.Second, EndAt: 3 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "verse"}}}}},
+		{StartAt: 3 * time.Second, EndAt: 5 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "chorus"}}}}},
+		{StartAt: 10 * time.Second, EndAt: 12 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "chorus"}}}}},
+	}}
+
+	// Unfragment only merges overlapping items
+	s.Unfragment()
+	assert.Len(t, s.Items, 4)
+
+	// Collapse repeats
+	s.CollapseRepeats(time.Second)
+	require.Len(t, s.Items, 3)
+	assert.Equal(t, "chorus", s.Items[0].String())
+	assert.Equal(t, time.Duration(0), s.Items[0].StartAt)
+	assert.Equal(t, 5*time.Second, s.Items[0].EndAt)
+	assert.Equal(t, "verse", s.Items[1].String())
+	assert.Equal(t, "chorus", s.Items[2].String())
+
+	// Bigger window
+	s.CollapseRepeats(5 * time.Second)
+	require.Len(t, s.Items, 2)
+	assert.Equal(t, 12*time.Second, s.Items[0].EndAt)
+}
+
+func TestSubtitles_Conform(t *testing.T) {
+	s := &astisub.Subtitles{Items: []*astisub.Item{
+		{Index: 7, StartAt: 4 * time.Second, EndAt: 4500 * time.Millisecond, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "3"}}}}},
+		{Index: 3, StartAt: 0, EndAt: 3 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "1"}}}}},
+		{Index: 5, StartAt: 2 * time.Second, EndAt: 3800 * time.Millisecond, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "2"}}}}},
+		{Index: 6, StartAt: 3 * time.Second, EndAt: 3 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "invalid"}}}}},
+		{Index: 8, StartAt: 5 * time.Second, EndAt: 6 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: " "}}}}},
+	}}
+
+	// Nothing enabled
+	s.Conform(astisub.ConformOptions{})
+	require.Len(t, s.Items, 5)
+	assert.Equal(t, []int{7, 3, 5, 6, 8}, []int{s.Items[0].Index, s.Items[1].Index, s.Items[2].Index, s.Items[3].Index, s.Items[4].Index})
+	assert.Equal(t, 3*time.Second, s.Items[1].EndAt)
+
+	// Defaults
+	s.Conform(astisub.DefaultConformOptions())
+	require.Len(t, s.Items, 3)
+	assert.Equal(t, []string{"1", "2", "3"}, []string{s.Items[0].String(), s.Items[1].String(), s.Items[2].String()})
+	assert.Equal(t, []int{1, 2, 3}, []int{s.Items[0].Index, s.Items[1].Index, s.Items[2].Index})
+	assert.Equal(t, 2*time.Second, s.Items[0].EndAt)
+	assert.Equal(t, 3800*time.Millisecond, s.Items[1].EndAt)
+	assert.Equal(t, 4500*time.Millisecond, s.Items[2].EndAt)
+
+	// Min duration and gaps
+	o := astisub.DefaultConformOptions()
+	o.MinDuration = time.Second
+	o.MaxGapToClose = 500 * time.Millisecond
+	s.Conform(o)
+	require.Len(t, s.Items, 3)
+	assert.Equal(t, 4*time.Second, s.Items[1].EndAt)
+	assert.Equal(t, 5*time.Second, s.Items[2].EndAt)
+}
+
+func TestSubtitles_SyncToPoint(t *testing.T) {
+	s := mockSubtitles()
+	assert.Equal(t, astisub.ErrInvalidItemIndex, s.SyncToPoint(2, time.Second))
+	require.NoError(t, s.SyncToPoint(1, 5*time.Second))
+	assert.Equal(t, 3*time.Second, s.Items[0].StartAt)
+	assert.Equal(t, 5*time.Second, s.Items[0].EndAt)
+	assert.Equal(t, 5*time.Second, s.Items[1].StartAt)
+	assert.Equal(t, 9*time.Second, s.Items[1].EndAt)
+}
+
+func TestDurationFormat(t *testing.T) {
+	// Milliseconds
+	f := astisub.DurationFormat{Digits: 3, Sep: ","}
+	assert.Equal(t, "01:02:03,456", f.Format(time.Hour+2*time.Minute+3*time.Second+456*time.Millisecond))
+	d, err := f.Parse("01:02:03,456")
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour+2*time.Minute+3*time.Second+456*time.Millisecond, d)
+
+	// Frames
+	f = astisub.DurationFormat{FrameRate: 25, Sep: ":", UseFrames: true}
+	assert.Equal(t, "01:02:03:12", f.Format(time.Hour+2*time.Minute+3*time.Second+480*time.Millisecond))
+	d, err = f.Parse("01:02:03:12")
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour+2*time.Minute+3*time.Second+480*time.Millisecond, d)
+	_, err = f.Parse("01:02:03")
+	assert.Error(t, err)
+	_, err = astisub.DurationFormat{UseFrames: true}.Parse("01:02:03:12")
+	assert.Error(t, err)
+
+	// Frames are floored by default
+	assert.Equal(t, "00:00:01:12", f.Format(time.Second+519*time.Millisecond))
+	f.RoundFrames = true
+	assert.Equal(t, "00:00:01:13", f.Format(time.Second+519*time.Millisecond))
+
+	// Drop frames
+	f = astisub.DurationFormat{DropFrame: true, FrameRate: 30, RoundFrames: true, Sep: ":", UseFrames: true}
+	for _, v := range []struct {
+		d time.Duration
+		s string
+	}{
+		{d: 60026633333, s: "00:00:59:29"},
+		{d: 60060000000, s: "00:01:00:02"},
+		{d: 599999400000, s: "00:10:00:00"},
+		{d: 3599996400000, s: "01:00:00:00"},
+	} {
+		d, err = f.Parse(v.s)
+		require.NoError(t, err)
+		assert.Equal(t, v.d, d, v.s)
+		assert.Equal(t, v.s, f.Format(v.d))
+	}
+}
+
+func TestSubtitles_ItemsAt(t *testing.T) {
+	s := mockSubtitles()
+	s.Items = append(s.Items, &astisub.Item{EndAt: 5 * time.Second, StartAt: 4 * time.Second})
+	assert.Empty(t, s.ItemsAt(0))
+	assert.Equal(t, []*astisub.Item{s.Items[0]}, s.ItemsAt(time.Second))
+	assert.Equal(t, []*astisub.Item{s.Items[1]}, s.ItemsAt(3*time.Second))
+	assert.Equal(t, []*astisub.Item{s.Items[1], s.Items[2]}, s.ItemsAt(4*time.Second))
+	assert.Empty(t, s.ItemsAt(7*time.Second))
+}
+
+func TestSubtitles_NextItemAfter(t *testing.T) {
+	s := mockSubtitles()
+	assert.Equal(t, s.Items[0], s.NextItemAfter(0))
+	assert.Equal(t, s.Items[1], s.NextItemAfter(time.Second))
+	assert.Nil(t, s.NextItemAfter(3*time.Second))
+}
+
+func TestSubtitles_CapMaxDuration(t *testing.T) {
+	s := mockSubtitles()
+	s.CapMaxDuration(0)
+	assert.Equal(t, 7*time.Second, s.Items[1].EndAt)
+	s.CapMaxDuration(3 * time.Second)
+	assert.Equal(t, 3*time.Second, s.Items[0].EndAt)
+	assert.Equal(t, 6*time.Second, s.Items[1].EndAt)
+}
+
+func TestSubtitles_FixMojibake(t *testing.T) {
+	s := &astisub.Subtitles{Items: []*astisub.Item{
+		{Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "CafÃ© dÃ©jÃ\u00a0 vu"}, {Text: "Itâ€™s"}}}}},
+		{Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "Café"}, {Text: "ASCII"}, {Text: "日本語"}}}}},
+	}}
+	assert.True(t, s.LooksMojibake())
+	s.FixMojibake()
+	assert.Equal(t, "Café déjà vu", s.Items[0].Lines[0].Items[0].Text)
+	assert.Equal(t, "It’s", s.Items[0].Lines[0].Items[1].Text)
+	assert.Equal(t, "Café", s.Items[1].Lines[0].Items[0].Text)
+	assert.Equal(t, "ASCII", s.Items[1].Lines[0].Items[1].Text)
+	assert.Equal(t, "日本語", s.Items[1].Lines[0].Items[2].Text)
+	assert.False(t, s.LooksMojibake())
+}
+
+func TestSubtitles_SplitByRegion(t *testing.T) {
+	s := mockSubtitles()
+	st := &astisub.Style{ID: "style"}
+	top, bottom := &astisub.Region{ID: "top", Style: st}, &astisub.Region{ID: "bottom"}
+	s.Regions = map[string]*astisub.Region{top.ID: top, bottom.ID: bottom}
+	s.Styles = map[string]*astisub.Style{st.ID: st}
+	s.Items[0].Region = top
+	s.Items = append(s.Items, &astisub.Item{StartAt: 8 * time.Second, EndAt: 9 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "subtitle-3"}}}}})
+
+	// Items in region
+	assert.Equal(t, []*astisub.Item{s.Items[0]}, s.ItemsInRegion("top"))
+	assert.Empty(t, s.ItemsInRegion("bottom"))
+
+	// Split
+	ps := s.SplitByRegion()
+	require.Len(t, ps, 2)
+	require.Len(t, ps["top"].Items, 1)
+	assert.Equal(t, "subtitle-1", ps["top"].Items[0].String())
+	assert.Equal(t, map[string]*astisub.Region{"top": top}, ps["top"].Regions)
+	assert.Equal(t, map[string]*astisub.Style{"style": st}, ps["top"].Styles)
+	require.Len(t, ps[""].Items, 2)
+	assert.Equal(t, "subtitle-2", ps[""].Items[0].String())
+	assert.Empty(t, ps[""].Regions)
+	assert.Empty(t, ps[""].Styles)
+
+	// Partitions are independent
+	ps["top"].Items[0].Lines[0].Items[0].Text = "modified"
+	assert.Equal(t, "subtitle-1", s.Items[0].String())
+	assert.Len(t, s.Regions, 2)
+}
+
+func TestSubtitles_NormalizeCJKPunctuation(t *testing.T) {
+	s := &astisub.Subtitles{Items: []*astisub.Item{{Lines: []astisub.Line{{Items: []astisub.LineItem{
+		{Text: "你好，世界。Ｈｉ！"},
+		{Text: "a, b (3.5)? 10:30 $+<=|"},
+		{Text: "３．５、１０：３０"},
+	}}}}}}
+	s.NormalizeCJKPunctuation(false)
+	assert.Equal(t, "你好,世界.Ｈｉ!", s.Items[0].Lines[0].Items[0].Text)
+	assert.Equal(t, "a, b (3.5)? 10:30 $+<=|", s.Items[0].Lines[0].Items[1].Text)
+	assert.Equal(t, "３.５,１０:３０", s.Items[0].Lines[0].Items[2].Text)
+	s.NormalizeCJKPunctuation(true)
+	assert.Equal(t, "你好，世界。Ｈｉ！", s.Items[0].Lines[0].Items[0].Text)
+	assert.Equal(t, "a， b （3.5）？ 10:30 $+<=|", s.Items[0].Lines[0].Items[1].Text)
+	assert.Equal(t, "３.５,１０:３０", s.Items[0].Lines[0].Items[2].Text)
+}
+
+func TestSubtitles_Validate(t *testing.T) {
+	s := mockSubtitles()
+	s.Items[1].StartAt = 2 * time.Second
+	s.Items[1].Lines = append(s.Items[1].Lines, astisub.Line{Items: []astisub.LineItem{{Text: "a much longer line"}}})
+	r := astisub.ValidationRules{
+		MaxCPL:      12,
+		MaxCPS:      5,
+		MaxDuration: 4 * time.Second,
+		MaxLines:    1,
+		MinDuration: time.Second,
+		MinGap:      100 * time.Millisecond,
+	}
+
+	// Item
+	assert.Empty(t, s.Items[0].Validate(r))
+	assert.Equal(t, []astisub.ValidationIssue{
+		{LineIndex: -1, Message: "duration 5s is bigger than 4s", Type: astisub.ValidationIssueTypeDuration},
+		{LineIndex: -1, Message: "2 lines is more than 1", Type: astisub.ValidationIssueTypeLines},
+		{LineIndex: 1, Message: "18 characters is more than 12", Type: astisub.ValidationIssueTypeCPL},
+		{LineIndex: -1, Message: "5.60 characters per second is more than 5.00", Type: astisub.ValidationIssueTypeCPS},
+	}, s.Items[1].Validate(r))
+	assert.Equal(t, []astisub.ValidationIssue{{LineIndex: -1, Message: "end 0s is not after start 1s", Type: astisub.ValidationIssueTypeDuration}}, astisub.Item{StartAt: time.Second}.Validate(r))
+
+	// Subtitles
+	is := s.Validate(r)
+	require.Len(t, is, 5)
+	assert.Equal(t, astisub.ValidationIssue{ItemIndex: 1, LineIndex: -1, Message: "start 2s is before previous item end 3s", Type: astisub.ValidationIssueTypeOverlap}, is[4])
+	s.Items[1].StartAt = 3050 * time.Millisecond
+	is = s.Validate(r)
+	require.Len(t, is, 4)
+	assert.Equal(t, astisub.ValidationIssue{ItemIndex: 1, LineIndex: -1, Message: "gap 50ms with previous item is smaller than 100ms", Type: astisub.ValidationIssueTypeGap}, is[3])
+}
+
+func TestSubtitles_ReverseTimeline(t *testing.T) {
+	s := mockSubtitles()
+	assert.EqualError(t, s.ReverseTimeline(6*time.Second), "astisub: total 6s is smaller than duration 7s")
+	require.NoError(t, s.ReverseTimeline(10*time.Second))
+	require.Len(t, s.Items, 2)
+	assert.Equal(t, "subtitle-2", s.Items[0].String())
+	assert.Equal(t, 3*time.Second, s.Items[0].StartAt)
+	assert.Equal(t, 7*time.Second, s.Items[0].EndAt)
+	assert.Equal(t, "subtitle-1", s.Items[1].String())
+	assert.Equal(t, 7*time.Second, s.Items[1].StartAt)
+	assert.Equal(t, 9*time.Second, s.Items[1].EndAt)
+
+	// Reversing twice gives back the original subtitles
+	require.NoError(t, s.ReverseTimeline(10*time.Second))
+	assert.Equal(t, mockSubtitles(), s)
+}
+
+func TestParseAndFormatDuration(t *testing.T) {
+	d := time.Hour + 2*time.Minute + 3*time.Second + 480*time.Millisecond
+	for _, v := range []struct {
+		format string
+		s      string
+	}{
+		{format: "srt", s: "01:02:03,480"},
+		{format: "ssa", s: "01:02:03.48"},
+		{format: "ass", s: "01:02:03.48"},
+		{format: "stl", s: "01020312"},
+		{format: "spruce", s: "01:02:03:12"},
+		{format: "ttml", s: "01:02:03.480"},
+		{format: "vtt", s: "01:02:03.480"},
+	} {
+		f, err := astisub.FormatDuration(v.format, d, 25)
+		require.NoError(t, err, v.format)
+		assert.Equal(t, v.s, f, v.format)
+		p, err := astisub.ParseDuration(v.format, v.s, 25)
+		require.NoError(t, err, v.format)
+		assert.Equal(t, d, p, v.format)
+	}
+
+	// Framerate
+	f, err := astisub.FormatDuration("spruce", d, 50)
+	require.NoError(t, err)
+	assert.Equal(t, "01:02:03:24", f)
+	p, err := astisub.ParseDuration("ttml", "01:02:03:24", 50)
+	require.NoError(t, err)
+	assert.Equal(t, d, p)
+	_, err = astisub.FormatDuration("stl", d, 0)
+	assert.Error(t, err)
+
+	// Invalid format
+	_, err = astisub.ParseDuration("invalid", "01:02:03,480", 25)
+	assert.Equal(t, astisub.ErrInvalidFormat, err)
+	_, err = astisub.FormatDuration("invalid", d, 25)
+	assert.Equal(t, astisub.ErrInvalidFormat, err)
+}
+
+func TestSubtitles_Equal(t *testing.T) {
+	s1, err := astisub.OpenFile("./testdata/example-in.ttml")
+	require.NoError(t, err)
+	s2, err := astisub.OpenFile("./testdata/example-in.ttml")
+	require.NoError(t, err)
+	assert.True(t, s1.Equal(s2))
+	assert.False(t, s1.Equal(nil))
+
+	// Timing
+	s2.Items[0].StartAt++
+	assert.False(t, s1.Equal(s2))
+	assert.True(t, s1.EqualIgnoreTiming(s2))
+
+	// Text
+	s2.Items[0].Lines[0].Items[0].Text = "modified"
+	assert.False(t, s1.EqualIgnoreTiming(s2))
+
+	// Styles are compared by ID
+	s1, s2 = mockSubtitles(), mockSubtitles()
+	s1.Items[0].Style = &astisub.Style{ID: "style"}
+	s2.Items[0].Style = &astisub.Style{ID: "style", InlineStyle: &astisub.StyleAttributes{}}
+	assert.True(t, s1.Equal(s2))
+	s2.Items[0].Style = &astisub.Style{ID: "other"}
+	assert.False(t, s1.Equal(s2))
+
+	// Metadata
+	s2.Items[0].Style = s1.Items[0].Style
+	s2.Metadata = &astisub.Metadata{}
+	assert.True(t, s1.Equal(s2))
+	s2.Metadata.Title = "title"
+	assert.False(t, s1.Equal(s2))
+}
+
+func TestSubtitles_ToString(t *testing.T) {
+	s := mockSubtitles()
+	o, err := s.ToString("SRT")
+	require.NoError(t, err)
+	b := &bytes.Buffer{}
+	require.NoError(t, s.WriteToSRT(b))
+	assert.Equal(t, b.String(), o)
+
+	o, err = s.ToSRTString()
+	require.NoError(t, err)
+	assert.Equal(t, b.String(), o)
+
+	o, err = s.ToWebVTTString()
+	require.NoError(t, err)
+	b.Reset()
+	require.NoError(t, s.WriteToWebVTT(b))
+	assert.Equal(t, b.String(), o)
+
+	_, err = s.ToString("invalid")
+	assert.Equal(t, astisub.ErrInvalidFormat, err)
+	_, err = astisub.Subtitles{}.ToSRTString()
+	assert.Equal(t, astisub.ErrNoSubtitlesToWrite, err)
+}
+
+func TestSubtitles_WordCount(t *testing.T) {
+	s := astisub.Subtitles{Items: []*astisub.Item{
+		{Lines: []astisub.Line{
+			{Items: []astisub.LineItem{{Text: "Hello  world,"}, {Text: "how are"}}},
+			{Items: []astisub.LineItem{{Text: " you? "}}},
+		}},
+		{Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "你好世界"}}}}},
+	}}
+	assert.Equal(t, 6, s.WordCount())
+	assert.Equal(t, 7, s.WordCountWithFunc(func(line string) int {
+		if strings.ContainsRune(line, '好') {
+			return 2
+		}
+		return len(strings.Fields(line))
+	}))
+	assert.Equal(t, 0, astisub.Subtitles{}.WordCount())
+}
+
+func TestSubtitles_EnforceGap(t *testing.T) {
+	s := astisub.Subtitles{Items: []*astisub.Item{
+		{StartAt: 3 * time.Second, EndAt: 4 * time.Second},
+		{StartAt: 0, EndAt: time.Second},
+		{StartAt: 950 * time.Millisecond, EndAt: 3 * time.Second},
+		{StartAt: 4100 * time.Millisecond, EndAt: 5 * time.Second},
+		{StartAt: 6 * time.Second, EndAt: 7 * time.Second},
+		{StartAt: 6050 * time.Millisecond, EndAt: 8 * time.Second},
+	}}
+	s.EnforceGap(200 * time.Millisecond)
+	require.Len(t, s.Items, 6)
+	for idx, e := range [][2]time.Duration{
+		{0, 750 * time.Millisecond},                       // Overlap
+		{950 * time.Millisecond, 2800 * time.Millisecond}, // Touching
+		{3 * time.Second, 3900 * time.Millisecond},        // Gap too small
+		{4100 * time.Millisecond, 5 * time.Second},        // Gap large enough
+		{6 * time.Second, 7 * time.Second},                // Impossible
+		{6050 * time.Millisecond, 8 * time.Second},        // Last item
+	} {
+		assert.Equal(t, e[0], s.Items[idx].StartAt, idx)
+		assert.Equal(t, e[1], s.Items[idx].EndAt, idx)
+	}
+}
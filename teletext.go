@@ -1,6 +1,7 @@
 package astisub
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -17,7 +18,8 @@ import (
 
 // Errors
 var (
-	ErrNoValidTeletextPID = errors.New("astisub: no valid teletext PID")
+	ErrInvalidTeletextPESPacket = errors.New("astisub: invalid teletext PES packet")
+	ErrNoValidTeletextPID       = errors.New("astisub: no valid teletext PID")
 )
 
 type teletextCharset [96][]byte
@@ -323,8 +325,35 @@ const (
 
 // TeletextOptions represents teletext options
 type TeletextOptions struct {
-	Page int
-	PID  int
+	// MergeDoubleHeightRows, if set, ignores the row following a double height row since it only contains the
+	// bottom half of its characters. Blank rows never produce lines.
+	MergeDoubleHeightRows bool
+	// MaxItems, if > 0, makes reading fail with ErrMaxItemsExceeded as soon as more pages with content are parsed
+	MaxItems int
+	Page     int
+	PID      int
+	// Progress, if set, is called periodically with the number of bytes read so far
+	Progress func(bytesRead int64)
+}
+
+// Number of bytes read between two teletext progress callbacks
+const teletextProgressInterval = 1 << 20
+
+type teletextProgressReader struct {
+	fn   func(bytesRead int64)
+	last int64
+	n    int64
+	r    io.Reader
+}
+
+func (r *teletextProgressReader) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	r.n += int64(n)
+	if r.n-r.last >= teletextProgressInterval || (err == io.EOF && r.n > r.last) {
+		r.last = r.n
+		r.fn(r.n)
+	}
+	return
 }
 
 // ReadFromTeletext parses a teletext content
@@ -333,9 +362,17 @@ type TeletextOptions struct {
 // TODO Update README
 // TODO Add tests
 func ReadFromTeletext(r io.Reader, o TeletextOptions) (s *Subtitles, err error) {
+	return ReadFromTeletextContext(context.Background(), r, o)
+}
+
+// ReadFromTeletextContext parses a teletext content and returns early once the context is cancelled
+func ReadFromTeletextContext(ctx context.Context, r io.Reader, o TeletextOptions) (s *Subtitles, err error) {
 	// Init
 	s = &Subtitles{}
-	var dmx = astits.NewDemuxer(context.Background(), r)
+	if o.Progress != nil {
+		r = &teletextProgressReader{fn: o.Progress, r: r}
+	}
+	var dmx = astits.NewDemuxer(ctx, r)
 
 	// Get the teletext PID
 	var pid uint16
@@ -346,16 +383,11 @@ func ReadFromTeletext(r io.Reader, o TeletextOptions) (s *Subtitles, err error)
 		return
 	}
 
-	// Create character decoder
-	cd := newTeletextCharacterDecoder()
-
-	// Create page buffer
-	b := newTeletextPageBuffer(o.Page, cd)
+	// Create PES processor
+	p := newTeletextPESProcessor(o.Page, o.MaxItems)
 
 	// Loop in data
-	var firstTime, lastTime time.Time
 	var d *astits.DemuxerData
-	var ps []*teletextPage
 	for {
 		// Fetch next data
 		if d, err = dmx.NextData(); err != nil {
@@ -377,32 +409,176 @@ func ReadFromTeletext(r io.Reader, o TeletextOptions) (s *Subtitles, err error)
 			continue
 		}
 
-		// Get time
-		t := teletextDataTime(d)
-		if t.IsZero() {
+		// Process PES data
+		if err = p.process(d.PES, teletextDataTime(d)); err != nil {
+			return
+		}
+	}
+
+	// Parse pages
+	p.parse(s, o.MergeDoubleHeightRows)
+	return
+}
+
+// ReadFromTeletextPES parses a teletext content made of consecutive PES packets, i.e. teletext that has already
+// been demuxed from its transport stream. The PID option is ignored.
+func ReadFromTeletextPES(r io.Reader, o TeletextOptions) (s *Subtitles, err error) {
+	return ReadFromTeletextPESContext(context.Background(), r, o)
+}
+
+// ReadFromTeletextPESContext parses a teletext content made of consecutive PES packets and returns early once the
+// context is cancelled
+func ReadFromTeletextPESContext(ctx context.Context, r io.Reader, o TeletextOptions) (s *Subtitles, err error) {
+	// Init
+	s = &Subtitles{}
+	if o.Progress != nil {
+		r = &teletextProgressReader{fn: o.Progress, r: r}
+	}
+
+	// Create PES processor
+	p := newTeletextPESProcessor(o.Page, o.MaxItems)
+
+	// Loop in packets
+	for {
+		// Check context
+		if err = ctx.Err(); err != nil {
+			err = fmt.Errorf("astisub: checking context failed: %w", err)
+			return
+		}
+
+		// Fetch next packet
+		var d *astits.PESData
+		var t time.Time
+		if d, t, err = teletextNextPESPacket(r); err != nil {
+			if err == io.EOF {
+				err = nil
+				break
+			}
+			err = fmt.Errorf("astisub: fetching next PES packet failed: %w", err)
+			return
+		}
+
+		// This data is not of interest to us
+		if d.Header.StreamID != astits.StreamIDPrivateStream1 {
 			continue
 		}
 
-		// First and last time
-		if firstTime.IsZero() || firstTime.After(t) {
-			firstTime = t
+		// Process PES data
+		if err = p.process(d, t); err != nil {
+			return
 		}
-		if lastTime.IsZero() || lastTime.Before(t) {
-			lastTime = t
+	}
+
+	// Parse pages
+	p.parse(s, o.MergeDoubleHeightRows)
+	return
+}
+
+// teletextNextPESPacket reads the next PES packet. It returns io.EOF if there are no more packets and a zero time
+// if the packet has no PTS.
+func teletextNextPESPacket(r io.Reader) (d *astits.PESData, t time.Time, err error) {
+	// Read header
+	var h [6]byte
+	if _, err = io.ReadFull(r, h[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = ErrInvalidTeletextPESPacket
 		}
+		return
+	}
+
+	// Check packet start code prefix and length. Teletext packets are always bounded.
+	length := int(h[4])<<8 | int(h[5])
+	if h[0] != 0x0 || h[1] != 0x0 || h[2] != 0x1 || length == 0 {
+		err = ErrInvalidTeletextPESPacket
+		return
+	}
+
+	// Read packet
+	b := make([]byte, length)
+	if _, err = io.ReadFull(r, b); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrInvalidTeletextPESPacket
+		}
+		return
+	}
+	d = &astits.PESData{Header: &astits.PESHeader{PacketLength: uint16(length), StreamID: h[3]}}
 
-		// Append pages
-		ps = append(ps, b.process(d.PES, t)...)
+	// Only private stream 1 packets are parsed, and they always have an optional header
+	if d.Header.StreamID != astits.StreamIDPrivateStream1 {
+		d.Data = b
+		return
 	}
+	if len(b) < 3 || len(b) < 3+int(b[2]) {
+		err = ErrInvalidTeletextPESPacket
+		return
+	}
+
+	// PTS
+	if b[1]&0x80 > 0 {
+		if b[2] < 5 {
+			err = ErrInvalidTeletextPESPacket
+			return
+		}
+		t = astits.ClockReference{Base: int64(b[3]>>1&0x7)<<30 | int64(b[4])<<22 | int64(b[5]>>1)<<15 | int64(b[6])<<7 | int64(b[7]>>1)}.Time()
+	}
+	d.Data = b[3+int(b[2]):]
+	return
+}
+
+type teletextPESProcessor struct {
+	b                   *teletextPageBuffer
+	cd                  *teletextCharacterDecoder
+	firstTime, lastTime time.Time
+	items, maxItems     int
+	ps                  []*teletextPage
+}
+
+func newTeletextPESProcessor(page, maxItems int) *teletextPESProcessor {
+	cd := newTeletextCharacterDecoder()
+	return &teletextPESProcessor{
+		b:        newTeletextPageBuffer(page, cd),
+		cd:       cd,
+		maxItems: maxItems,
+	}
+}
 
+func (p *teletextPESProcessor) process(d *astits.PESData, t time.Time) (err error) {
+	// No time or no data
+	if t.IsZero() || len(d.Data) == 0 {
+		return
+	}
+
+	// First and last time
+	if p.firstTime.IsZero() || p.firstTime.After(t) {
+		p.firstTime = t
+	}
+	if p.lastTime.IsZero() || p.lastTime.Before(t) {
+		p.lastTime = t
+	}
+
+	// Append pages
+	for _, pg := range p.b.process(d, t) {
+		p.ps = append(p.ps, pg)
+
+		// Only pages with content produce items
+		if len(pg.data) > 0 {
+			p.items++
+			if p.maxItems > 0 && p.items > p.maxItems {
+				return ErrMaxItemsExceeded
+			}
+		}
+	}
+	return
+}
+
+func (p *teletextPESProcessor) parse(s *Subtitles, mergeDoubleHeightRows bool) {
 	// Dump buffer
-	ps = append(ps, b.dump(lastTime)...)
+	p.ps = append(p.ps, p.b.dump(p.lastTime)...)
 
 	// Parse pages
-	for _, p := range ps {
-		p.parse(s, cd, firstTime)
+	for _, pg := range p.ps {
+		pg.parse(s, p.cd, p.firstTime, mergeDoubleHeightRows)
 	}
-	return
 }
 
 // TODO Add tests
@@ -816,7 +992,7 @@ func newTeletextPage(charsetCode uint8, start time.Time) *teletextPage {
 	}
 }
 
-func (p *teletextPage) parse(s *Subtitles, d *teletextCharacterDecoder, firstTime time.Time) {
+func (p *teletextPage) parse(s *Subtitles, d *teletextCharacterDecoder, firstTime time.Time, mergeDoubleHeightRows bool) {
 	// Update charset
 	d.updateCharset(astikit.UInt8Ptr(p.charsetCode), false)
 
@@ -835,8 +1011,26 @@ func (p *teletextPage) parse(s *Subtitles, d *teletextCharacterDecoder, firstTim
 	}
 
 	// Loop through rows
+	var skipRow = -1
 	for _, idxRow := range p.rows {
-		parseTeletextRow(i, d, nil, p.data[uint8(idxRow)])
+		// Row is the bottom half of a double height row
+		if idxRow == skipRow {
+			continue
+		}
+
+		// Parse row
+		row := p.data[uint8(idxRow)]
+		parseTeletextRow(i, d, nil, row)
+
+		// Row contains double height characters
+		if mergeDoubleHeightRows && bytes.IndexByte(row, 0xd) >= 0 {
+			skipRow = idxRow + 1
+		}
+	}
+
+	// Rows that decode to only spaces don't produce any line, in which case no item is added
+	if len(i.Lines) == 0 {
+		return
 	}
 
 	// Append item
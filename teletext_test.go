@@ -1,11 +1,17 @@
 package astisub
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/bits"
 	"testing"
 	"time"
 
 	"github.com/asticode/go-astikit"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTeletextPESDataType(t *testing.T) {
@@ -30,7 +36,7 @@ func TestTeletextPageParse(t *testing.T) {
 	s := Subtitles{}
 	d := newTeletextCharacterDecoder()
 	d.updateCharset(astikit.UInt8Ptr(0), false)
-	p.parse(&s, d, time.Unix(5, 0))
+	p.parse(&s, d, time.Unix(5, 0), false)
 	assert.Equal(t, []*Item{{
 		EndAt: 10 * time.Second,
 		Lines: []Line{
@@ -41,6 +47,60 @@ func TestTeletextPageParse(t *testing.T) {
 	}}, s.Items)
 }
 
+func TestTeletextPageParseBlankRows(t *testing.T) {
+	p := newTeletextPage(0, time.Unix(10, 0))
+	p.end = time.Unix(15, 0)
+	p.rows = []int{1, 2, 3}
+	p.data = map[uint8][]byte{
+		1: append([]byte{0xb}, []byte("  test1 ")...),
+		2: append([]byte{0xb}, []byte("      ")...),
+		3: append([]byte{0xb}, []byte("test2")...),
+	}
+	s := Subtitles{}
+	d := newTeletextCharacterDecoder()
+	d.updateCharset(astikit.UInt8Ptr(0), false)
+	p.parse(&s, d, time.Unix(5, 0), false)
+	assert.Equal(t, []*Item{{
+		EndAt: 10 * time.Second,
+		Lines: []Line{
+			{Items: []LineItem{{InlineStyle: &StyleAttributes{TeletextSpacesAfter: astikit.IntPtr(1), TeletextSpacesBefore: astikit.IntPtr(2)}, Text: "test1"}}},
+			{Items: []LineItem{{InlineStyle: &StyleAttributes{TeletextSpacesAfter: astikit.IntPtr(0), TeletextSpacesBefore: astikit.IntPtr(0)}, Text: "test2"}}},
+		},
+		StartAt: 5 * time.Second,
+	}}, s.Items)
+
+	// Only blank rows
+	p.rows = []int{2}
+	s = Subtitles{}
+	p.parse(&s, d, time.Unix(5, 0), false)
+	assert.Empty(t, s.Items)
+}
+
+func TestTeletextPageParseDoubleHeightRows(t *testing.T) {
+	p := newTeletextPage(0, time.Unix(10, 0))
+	p.end = time.Unix(15, 0)
+	p.rows = []int{20, 21, 22}
+	p.data = map[uint8][]byte{
+		20: append([]byte{0xd, 0xb}, []byte("test1")...),
+		21: append([]byte{0xd, 0xb}, []byte("test1")...),
+		22: append([]byte{0xb}, []byte("test2")...),
+	}
+	s := Subtitles{}
+	d := newTeletextCharacterDecoder()
+	d.updateCharset(astikit.UInt8Ptr(0), false)
+	p.parse(&s, d, time.Unix(5, 0), false)
+	require.Len(t, s.Items, 1)
+	assert.Len(t, s.Items[0].Lines, 3)
+
+	// Merge double height rows
+	s = Subtitles{}
+	p.parse(&s, d, time.Unix(5, 0), true)
+	require.Len(t, s.Items, 1)
+	require.Len(t, s.Items[0].Lines, 2)
+	assert.Equal(t, "test1", s.Items[0].Lines[0].String())
+	assert.Equal(t, "test2", s.Items[0].Lines[1].String())
+}
+
 func TestParseTeletextRow(t *testing.T) {
 	b := []byte("start")
 	b = append(b, 0x0, 0xb)
@@ -175,3 +235,87 @@ func TestAppendTeletextLineItem(t *testing.T) {
 		TeletextSpacesBefore: astikit.IntPtr(1),
 	}, *l.Items[0].InlineStyle)
 }
+
+func TestTeletextProgressReader(t *testing.T) {
+	var ns []int64
+	r := &teletextProgressReader{
+		fn: func(bytesRead int64) { ns = append(ns, bytesRead) },
+		r:  bytes.NewReader(make([]byte, 2*teletextProgressInterval+10)),
+	}
+	b := make([]byte, 1024)
+	for {
+		if _, err := r.Read(b); err != nil {
+			assert.Equal(t, io.EOF, err)
+			break
+		}
+	}
+	assert.Equal(t, []int64{teletextProgressInterval, 2 * teletextProgressInterval, 2*teletextProgressInterval + 10}, ns)
+}
+
+func testTeletextHamming84Encode(v uint8) byte {
+	for b := 0; b < 256; b++ {
+		if o, ok := astikit.ByteHamming84Decode(uint8(b)); ok && o == v {
+			return byte(b)
+		}
+	}
+	return 0
+}
+
+func testTeletextDataUnit(packetNumber uint8, payload []byte) []byte {
+	// Magazine 8 is encoded as 0
+	h := packetNumber << 3
+	b := []byte{teletextPESDataUnitIDEBUSubtitleData, 44, 0x0, 0xe4, testTeletextHamming84Encode(h & 0xf), testTeletextHamming84Encode(h >> 4)}
+	return append(b, astikit.BytesPad(payload, 0x0, 40, astikit.PadRight)...)
+}
+
+func testTeletextPESPacket(streamID uint8, pts int64, data []byte) []byte {
+	var b []byte
+	if streamID == 0xbd {
+		b = []byte{0x80, 0x80, 5, 0x21 | byte(pts>>29&0xe), byte(pts >> 22), byte(pts>>14&0xfe) | 0x1, byte(pts >> 7), byte(pts<<1) | 0x1}
+	}
+	b = append(b, data...)
+	return append([]byte{0x0, 0x0, 0x1, streamID, byte(len(b) >> 8), byte(len(b))}, b...)
+}
+
+func TestReadFromTeletextPES(t *testing.T) {
+	// Page 888 header
+	header := make([]byte, 8)
+	for idx := range header {
+		header[idx] = testTeletextHamming84Encode(0)
+	}
+	header[0] = testTeletextHamming84Encode(8)
+	header[1] = testTeletextHamming84Encode(8)
+
+	// Row with odd parity, transmitted least significant bit first
+	var row []byte
+	for _, c := range append([]byte{0xb}, []byte("test")...) {
+		if bits.OnesCount8(c)%2 == 0 {
+			c |= 0x80
+		}
+		row = append(row, bits.Reverse8(c))
+	}
+
+	// Build stream
+	b := &bytes.Buffer{}
+	b.Write(testTeletextPESPacket(0xbd, 900000, append(append([]byte{0x10}, testTeletextDataUnit(0, header)...), testTeletextDataUnit(1, row)...)))
+	b.Write(testTeletextPESPacket(0xe0, 0, []byte{0x1, 0x2, 0x3}))
+	b.Write(testTeletextPESPacket(0xbd, 1080000, append([]byte{0x10}, testTeletextDataUnit(0, header)...)))
+
+	s, err := ReadFromTeletextPES(b, TeletextOptions{Page: 888})
+	require.NoError(t, err)
+	require.Len(t, s.Items, 1)
+	assert.Equal(t, time.Duration(0), s.Items[0].StartAt)
+	assert.Equal(t, 2*time.Second, s.Items[0].EndAt)
+	assert.Equal(t, "test", s.Items[0].String())
+
+	// Truncated packet
+	_, err = ReadFromTeletextPES(bytes.NewReader([]byte{0x0, 0x0, 0x1, 0xbd, 0x0, 0x10, 0x80}), TeletextOptions{Page: 888})
+	assert.True(t, errors.Is(err, ErrInvalidTeletextPESPacket))
+
+	// Cancelled context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = ReadFromTeletextPESContext(ctx, bytes.NewReader(nil), TeletextOptions{Page: 888})
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.EqualError(t, err, "astisub: checking context failed: context canceled")
+}
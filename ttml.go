@@ -2,6 +2,7 @@ package astisub
 
 import (
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"regexp"
@@ -34,6 +35,25 @@ var ttmlLanguageMapping = astikit.NewBiMap().
 	Set(ttmlLanguageJapanese, LanguageJapanese).
 	Set(ttmlLanguageNorwegian, LanguageNorwegian)
 
+// TTML xml:space value preserving spaces
+const ttmlSpacePreserve = "preserve"
+
+// TTML smpte time base
+const TTMLTimeBaseSMPTE = "smpte"
+
+// TTML drop modes
+const (
+	TTMLDropModeDropNTSC = "dropNTSC"
+	TTMLDropModeDropPAL  = "dropPAL"
+	TTMLDropModeNonDrop  = "nonDrop"
+)
+
+// iTunes Timed Text defaults
+const (
+	ittDefaultExtent    = "1920px 1080px"
+	ittDefaultFramerate = 25
+)
+
 // TTML Clock Time Frames and Offset Time
 var (
 	ttmlRegexpClockTimeFrames = regexp.MustCompile(`\:[\d]+$`)
@@ -43,22 +63,29 @@ var (
 // TTMLIn represents an input TTML that must be unmarshaled
 // We split it from the output TTML as we can't add strict namespace without breaking retrocompatibility
 type TTMLIn struct {
-	Framerate int              `xml:"frameRate,attr"`
-	Lang      string           `xml:"lang,attr"`
-	Metadata  TTMLInMetadata   `xml:"head>metadata"`
-	Regions   []TTMLInRegion   `xml:"head>layout>region"`
-	Styles    []TTMLInStyle    `xml:"head>styling>style"`
-	Subtitles []TTMLInSubtitle `xml:"body>div>p"`
-	Tickrate  int              `xml:"tickRate,attr"`
-	XMLName   xml.Name         `xml:"tt"`
+	DropMode   string           `xml:"dropMode,attr"`
+	Extent     string           `xml:"extent,attr"`
+	Framerate  int              `xml:"frameRate,attr"`
+	Lang       string           `xml:"lang,attr"`
+	MarkerMode string           `xml:"markerMode,attr"`
+	Metadata   TTMLInMetadata   `xml:"head>metadata"`
+	Regions    []TTMLInRegion   `xml:"head>layout>region"`
+	Space      string           `xml:"space,attr,omitempty"`
+	Styles     []TTMLInStyle    `xml:"head>styling>style"`
+	Subtitles  []TTMLInSubtitle `xml:"body>div>p"`
+	Tickrate   int              `xml:"tickRate,attr"`
+	XMLName    xml.Name         `xml:"tt"`
 }
 
 // metadata returns the Metadata of the TTML
 func (t TTMLIn) metadata() (m *Metadata) {
 	m = &Metadata{
-		Framerate:     t.Framerate,
-		Title:         t.Metadata.Title,
-		TTMLCopyright: t.Metadata.Copyright,
+		Framerate:      t.Framerate,
+		Title:          t.Metadata.Title,
+		TTMLCopyright:  t.Metadata.Copyright,
+		TTMLDropMode:   t.DropMode,
+		TTMLMarkerMode: t.MarkerMode,
+		TTMLRootExtent: t.Extent,
 	}
 	if v, ok := ttmlLanguageMapping.Get(astikit.StrPad(t.Lang, ' ', 2, astikit.PadCut)); ok {
 		m.Language = v.(string)
@@ -73,6 +100,7 @@ type TTMLInMetadata struct {
 }
 
 // TTMLInStyleAttributes represents input TTML style attributes
+// Attributes are matched on their local name only so that they are parsed whatever the namespace prefix (tts:, default, etc.)
 type TTMLInStyleAttributes struct {
 	BackgroundColor *string `xml:"backgroundColor,attr,omitempty"`
 	Color           *string `xml:"color,attr,omitempty"`
@@ -101,7 +129,7 @@ type TTMLInStyleAttributes struct {
 }
 
 // StyleAttributes converts TTMLInStyleAttributes into a StyleAttributes
-func (s TTMLInStyleAttributes) styleAttributes() (o *StyleAttributes) {
+func (s TTMLInStyleAttributes) styleAttributes(rootExtent string) (o *StyleAttributes) {
 	o = &StyleAttributes{
 		TTMLBackgroundColor: s.BackgroundColor,
 		TTMLColor:           s.Color,
@@ -128,7 +156,7 @@ func (s TTMLInStyleAttributes) styleAttributes() (o *StyleAttributes) {
 		TTMLWritingMode:     s.WritingMode,
 		TTMLZIndex:          s.ZIndex,
 	}
-	o.propagateTTMLAttributes()
+	o.propagateTTMLAttributes(rootExtent)
 	return
 }
 
@@ -158,6 +186,7 @@ type TTMLInSubtitle struct {
 	ID     string          `xml:"id,attr,omitempty"`
 	Items  string          `xml:",innerxml"` // We must store inner XML here since there's no tag to describe both any tag and chardata
 	Region string          `xml:"region,attr,omitempty"`
+	Space  string          `xml:"space,attr,omitempty"`
 	Style  string          `xml:"style,attr,omitempty"`
 	TTMLInStyleAttributes
 }
@@ -167,6 +196,14 @@ type TTMLInItems []TTMLInItem
 
 // UnmarshalXML implements the XML unmarshaler interface
 func (i *TTMLInItems) UnmarshalXML(d *xml.Decoder, start xml.StartElement) (err error) {
+	// Check whether spaces should be preserved
+	var preserveSpaces bool
+	for _, a := range start.Attr {
+		if a.Name.Local == "space" {
+			preserveSpaces = a.Value == ttmlSpacePreserve
+		}
+	}
+
 	// Get next tokens
 	var t xml.Token
 	for {
@@ -188,7 +225,10 @@ func (i *TTMLInItems) UnmarshalXML(d *xml.Decoder, start xml.StartElement) (err
 			}
 			*i = append(*i, e)
 		} else if b, ok := t.(xml.CharData); ok {
-			var str = strings.TrimSpace(string(b))
+			var str = string(b)
+			if !preserveSpaces {
+				str = strings.TrimSpace(str)
+			}
 			if len(str) > 0 {
 				*i = append(*i, TTMLInItem{Text: str})
 			}
@@ -225,10 +265,14 @@ func (r *ttmlXmlTokenReader) Token() (xml.Token, error) {
 	return t, nil
 }
 
-func newTTMLXmlDecoder(ts TTMLInSubtitle) *xml.Decoder {
+func newTTMLXmlDecoder(ts TTMLInSubtitle, preserveSpaces bool) *xml.Decoder {
+	var p = "<p>"
+	if preserveSpaces {
+		p = `<p xml:space="` + ttmlSpacePreserve + `">`
+	}
 	return xml.NewTokenDecoder(
 		&ttmlXmlTokenReader{
-			xmlTokenReader: xml.NewDecoder(strings.NewReader("<p>" + ts.Items + "</p>")),
+			xmlTokenReader: xml.NewDecoder(strings.NewReader(p + ts.Items + "</p>")),
 			holdingToken:   nil,
 		},
 	)
@@ -236,15 +280,19 @@ func newTTMLXmlDecoder(ts TTMLInSubtitle) *xml.Decoder {
 
 // TTMLInItem represents an input TTML item
 type TTMLInItem struct {
-	Style string `xml:"style,attr,omitempty"`
-	Text  string `xml:",chardata"`
+	Begin *TTMLInDuration `xml:"begin,attr,omitempty"`
+	End   *TTMLInDuration `xml:"end,attr,omitempty"`
+	Style string          `xml:"style,attr,omitempty"`
+	Text  string          `xml:",chardata"`
 	TTMLInStyleAttributes
 	XMLName xml.Name
 }
 
 // TTMLInDuration represents an input TTML duration
 type TTMLInDuration struct {
+	clockTimeFrames   bool
 	d                 time.Duration
+	dropMode          string
 	frames, framerate int // Framerate is in frame/s
 	ticks, tickrate   int // Tickrate is in ticks/s
 }
@@ -256,6 +304,7 @@ type TTMLInDuration struct {
 // - [ticks]t ([ticks] being the tick amount)
 func (d *TTMLInDuration) UnmarshalText(i []byte) (err error) {
 	// Reset duration
+	d.clockTimeFrames = false
 	d.d = time.Duration(0)
 	d.frames = 0
 	d.ticks = 0
@@ -311,6 +360,7 @@ func (d *TTMLInDuration) UnmarshalText(i []byte) (err error) {
 		}
 
 		// Update text
+		d.clockTimeFrames = true
 		text = text[:indexes[0]] + ".000"
 	}
 
@@ -323,6 +373,10 @@ func (d TTMLInDuration) duration() (o time.Duration) {
 	if d.ticks > 0 && d.tickrate > 0 {
 		return time.Duration(float64(d.ticks) * 1e9 / float64(d.tickrate))
 	}
+	if d.clockTimeFrames && d.dropMode == TTMLDropModeDropNTSC && d.framerate > 0 {
+		s := int(d.d / time.Second)
+		return dropFrameDuration(s/3600, s%3600/60, s%60, d.frames, d.framerate)
+	}
 	o = d.d
 	if d.frames > 0 && d.framerate > 0 {
 		o += time.Duration(float64(d.frames) / float64(d.framerate) * float64(time.Second.Nanoseconds()))
@@ -330,8 +384,19 @@ func (d TTMLInDuration) duration() (o time.Duration) {
 	return
 }
 
+// TTMLOptions represents TTML parsing options
+type TTMLOptions struct {
+	// MaxItems - if > 0, reading fails with ErrMaxItemsExceeded if there are more items
+	MaxItems int
+}
+
 // ReadFromTTML parses a .ttml content
 func ReadFromTTML(i io.Reader) (o *Subtitles, err error) {
+	return ReadFromTTMLWithOptions(i, TTMLOptions{})
+}
+
+// ReadFromTTMLWithOptions parses a .ttml content
+func ReadFromTTMLWithOptions(i io.Reader, opts TTMLOptions) (o *Subtitles, err error) {
 	// Init
 	o = NewSubtitles()
 
@@ -342,24 +407,33 @@ func ReadFromTTML(i io.Reader) (o *Subtitles, err error) {
 		return
 	}
 
+	// Check limit
+	if opts.MaxItems > 0 && len(ttml.Subtitles) > opts.MaxItems {
+		err = ErrMaxItemsExceeded
+		return
+	}
+
 	// Add metadata
 	o.Metadata = ttml.metadata()
 
 	// Loop through styles
-	var parentStyles = make(map[string]*Style)
+	var childStyles []*Style
+	var parentStyleIDs []string
 	for _, ts := range ttml.Styles {
 		var s = &Style{
 			ID:          ts.ID,
-			InlineStyle: ts.TTMLInStyleAttributes.styleAttributes(),
+			InlineStyle: ts.TTMLInStyleAttributes.styleAttributes(ttml.Extent),
 		}
 		o.Styles[s.ID] = s
 		if len(ts.Style) > 0 {
-			parentStyles[ts.Style] = s
+			childStyles = append(childStyles, s)
+			parentStyleIDs = append(parentStyleIDs, ts.Style)
 		}
 	}
 
-	// Take care of parent styles
-	for id, s := range parentStyles {
+	// Take care of parent styles in source order
+	for idx, s := range childStyles {
+		id := parentStyleIDs[idx]
 		if _, ok := o.Styles[id]; !ok {
 			err = fmt.Errorf("astisub: Style %s requested by style %s doesn't exist", id, s.ID)
 			return
@@ -371,7 +445,7 @@ func ReadFromTTML(i io.Reader) (o *Subtitles, err error) {
 	for _, tr := range ttml.Regions {
 		var r = &Region{
 			ID:          tr.ID,
-			InlineStyle: tr.TTMLInStyleAttributes.styleAttributes(),
+			InlineStyle: tr.TTMLInStyleAttributes.styleAttributes(ttml.Extent),
 		}
 		if len(tr.Style) > 0 {
 			if _, ok := o.Styles[tr.Style]; !ok {
@@ -386,14 +460,16 @@ func ReadFromTTML(i io.Reader) (o *Subtitles, err error) {
 	// Loop through subtitles
 	for _, ts := range ttml.Subtitles {
 		// Init item
+		ts.Begin.dropMode = ttml.DropMode
 		ts.Begin.framerate = ttml.Framerate
 		ts.Begin.tickrate = ttml.Tickrate
+		ts.End.dropMode = ttml.DropMode
 		ts.End.framerate = ttml.Framerate
 		ts.End.tickrate = ttml.Tickrate
 
 		var s = &Item{
 			EndAt:       ts.End.duration(),
-			InlineStyle: ts.TTMLInStyleAttributes.styleAttributes(),
+			InlineStyle: ts.TTMLInStyleAttributes.styleAttributes(ttml.Extent),
 			StartAt:     ts.Begin.duration(),
 		}
 
@@ -415,9 +491,12 @@ func ReadFromTTML(i io.Reader) (o *Subtitles, err error) {
 			s.Style = o.Styles[ts.Style]
 		}
 
+		// Spaces are preserved if requested by the subtitle or, by inheritance, by the root element
+		preserveSpaces := ts.Space == ttmlSpacePreserve || (ts.Space == "" && ttml.Space == ttmlSpacePreserve)
+
 		// Unmarshal items
 		var items = TTMLInItems{}
-		if err = newTTMLXmlDecoder(ts).Decode(&items); err != nil {
+		if err = newTTMLXmlDecoder(ts, preserveSpaces).Decode(&items); err != nil {
 			err = fmt.Errorf("astisub: unmarshaling items failed: %w", err)
 			return
 		}
@@ -444,8 +523,25 @@ func ReadFromTTML(i io.Reader) (o *Subtitles, err error) {
 
 				// Init line item
 				var t = LineItem{
-					InlineStyle: tt.TTMLInStyleAttributes.styleAttributes(),
-					Text:        strings.TrimSpace(li),
+					InlineStyle: tt.TTMLInStyleAttributes.styleAttributes(ttml.Extent),
+					Text:        li,
+				}
+				if !preserveSpaces {
+					t.Text = strings.TrimSpace(li)
+				}
+
+				// Add time boundaries, which are relative to the subtitle's begin
+				if tt.Begin != nil {
+					tt.Begin.dropMode = ttml.DropMode
+					tt.Begin.framerate = ttml.Framerate
+					tt.Begin.tickrate = ttml.Tickrate
+					t.StartAt = s.StartAt + tt.Begin.duration()
+				}
+				if tt.End != nil {
+					tt.End.dropMode = ttml.DropMode
+					tt.End.framerate = ttml.Framerate
+					tt.End.tickrate = ttml.Tickrate
+					t.EndAt = s.StartAt + tt.End.duration()
 				}
 
 				// Add style
@@ -473,14 +569,21 @@ func ReadFromTTML(i io.Reader) (o *Subtitles, err error) {
 // TTMLOut represents an output TTML that must be marshaled
 // We split it from the input TTML as this time we'll add strict namespaces
 type TTMLOut struct {
-	Lang            string            `xml:"xml:lang,attr,omitempty"`
-	Metadata        *TTMLOutMetadata  `xml:"head>metadata,omitempty"`
-	Styles          []TTMLOutStyle    `xml:"head>styling>style,omitempty"` //!\\ Order is important! Keep Styling above Layout
-	Regions         []TTMLOutRegion   `xml:"head>layout>region,omitempty"`
-	Subtitles       []TTMLOutSubtitle `xml:"body>div>p,omitempty"`
-	XMLName         xml.Name          `xml:"http://www.w3.org/ns/ttml tt"`
-	XMLNamespaceTTM string            `xml:"xmlns:ttm,attr"`
-	XMLNamespaceTTS string            `xml:"xmlns:tts,attr"`
+	DropMode            string            `xml:"ttp:dropMode,attr,omitempty"`
+	Extent              string            `xml:"tts:extent,attr,omitempty"`
+	Framerate           int               `xml:"ttp:frameRate,attr,omitempty"`
+	FramerateMultiplier string            `xml:"ttp:frameRateMultiplier,attr,omitempty"`
+	Lang                string            `xml:"xml:lang,attr,omitempty"`
+	MarkerMode          string            `xml:"ttp:markerMode,attr,omitempty"`
+	Metadata            *TTMLOutMetadata  `xml:"head>metadata,omitempty"`
+	Styles              []TTMLOutStyle    `xml:"head>styling>style,omitempty"` //!\\ Order is important! Keep Styling above Layout
+	Regions             []TTMLOutRegion   `xml:"head>layout>region,omitempty"`
+	Subtitles           []TTMLOutSubtitle `xml:"body>div>p,omitempty"`
+	TimeBase            string            `xml:"ttp:timeBase,attr,omitempty"`
+	XMLName             xml.Name          `xml:"http://www.w3.org/ns/ttml tt"`
+	XMLNamespaceTTM     string            `xml:"xmlns:ttm,attr"`
+	XMLNamespaceTTP     string            `xml:"xmlns:ttp,attr,omitempty"`
+	XMLNamespaceTTS     string            `xml:"xmlns:tts,attr"`
 }
 
 // TTMLOutMetadata represents an output TTML Metadata
@@ -571,19 +674,79 @@ type TTMLOutStyle struct {
 
 // TTMLOutSubtitle represents an output TTML subtitle
 type TTMLOutSubtitle struct {
-	Begin  TTMLOutDuration `xml:"begin,attr"`
-	End    TTMLOutDuration `xml:"end,attr"`
-	ID     string          `xml:"id,attr,omitempty"`
-	Items  []TTMLOutItem
-	Region string `xml:"region,attr,omitempty"`
-	Style  string `xml:"style,attr,omitempty"`
+	Begin     TTMLOutDuration `xml:"begin,attr"`
+	DropFrame bool            `xml:"-"` // NTSC drop frame, Framerate being the nominal one
+	End       TTMLOutDuration `xml:"end,attr"`
+	Framerate int             `xml:"-"` // If > 0, times of the subtitle and its items are written as hh:mm:ss:ff
+	ID        string          `xml:"id,attr,omitempty"`
+	Items     []TTMLOutItem
+	Region    string `xml:"region,attr,omitempty"`
+	Style     string `xml:"style,attr,omitempty"`
 	TTMLOutStyleAttributes
 }
 
+// MarshalXML implements the XML marshaler interface
+func (s TTMLOutSubtitle) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	// Times are written as durations
+	type subtitle TTMLOutSubtitle
+	if s.Framerate <= 0 {
+		return e.EncodeElement(subtitle(s), start)
+	}
+
+	// Times are written as frames
+	type item struct {
+		Begin *TTMLOutTime `xml:"begin,attr,omitempty"`
+		End   *TTMLOutTime `xml:"end,attr,omitempty"`
+		Style string       `xml:"style,attr,omitempty"`
+		Text  string       `xml:",chardata"`
+		TTMLOutStyleAttributes
+		XMLName xml.Name
+	}
+	newTime := func(d TTMLOutDuration) TTMLOutTime {
+		return TTMLOutTime{DropFrame: s.DropFrame, Duration: time.Duration(d), Framerate: s.Framerate}
+	}
+	v := struct {
+		Begin  TTMLOutTime `xml:"begin,attr"`
+		End    TTMLOutTime `xml:"end,attr"`
+		ID     string      `xml:"id,attr,omitempty"`
+		Items  []item
+		Region string `xml:"region,attr,omitempty"`
+		Style  string `xml:"style,attr,omitempty"`
+		TTMLOutStyleAttributes
+	}{
+		Begin:                  newTime(s.Begin),
+		End:                    newTime(s.End),
+		ID:                     s.ID,
+		Region:                 s.Region,
+		Style:                  s.Style,
+		TTMLOutStyleAttributes: s.TTMLOutStyleAttributes,
+	}
+	for _, i := range s.Items {
+		ti := item{
+			Style:                  i.Style,
+			Text:                   i.Text,
+			TTMLOutStyleAttributes: i.TTMLOutStyleAttributes,
+			XMLName:                i.XMLName,
+		}
+		if i.Begin != nil {
+			t := newTime(*i.Begin)
+			ti.Begin = &t
+		}
+		if i.End != nil {
+			t := newTime(*i.End)
+			ti.End = &t
+		}
+		v.Items = append(v.Items, ti)
+	}
+	return e.EncodeElement(v, start)
+}
+
 // TTMLOutItem represents an output TTML Item
 type TTMLOutItem struct {
-	Style string `xml:"style,attr,omitempty"`
-	Text  string `xml:",chardata"`
+	Begin *TTMLOutDuration `xml:"begin,attr,omitempty"`
+	End   *TTMLOutDuration `xml:"end,attr,omitempty"`
+	Style string           `xml:"style,attr,omitempty"`
+	Text  string           `xml:",chardata"`
 	TTMLOutStyleAttributes
 	XMLName xml.Name
 }
@@ -593,12 +756,44 @@ type TTMLOutDuration time.Duration
 
 // MarshalText implements the TextMarshaler interface
 func (t TTMLOutDuration) MarshalText() ([]byte, error) {
-	return []byte(formatDuration(time.Duration(t), ".", 3)), nil
+	return []byte(DurationFormat{Digits: 3, Sep: "."}.Format(time.Duration(t))), nil
+}
+
+// TTMLOutTime represents an output TTML time expression
+type TTMLOutTime struct {
+	DropFrame bool // NTSC drop frame, Framerate being the nominal one
+	Duration  time.Duration
+	Framerate int // If > 0, time is written as hh:mm:ss:ff
 }
 
+// MarshalText implements the TextMarshaler interface
+func (t TTMLOutTime) MarshalText() ([]byte, error) {
+	if t.Framerate <= 0 {
+		return TTMLOutDuration(t.Duration).MarshalText()
+	}
+	return []byte(DurationFormat{DropFrame: t.DropFrame, FrameRate: t.Framerate, RoundFrames: true, Sep: ":", UseFrames: true}.Format(t.Duration)), nil
+}
+
+// TTML line break modes
+const (
+	TTMLLineBreakModeBR        = "br"
+	TTMLLineBreakModeParagraph = "paragraph"
+)
+
+// TTML time formats
+const (
+	TTMLTimeFormatFrames       = "frames"
+	TTMLTimeFormatMilliseconds = "ms"
+)
+
 // WriteToTTMLOptions represents TTML write options.
 type WriteToTTMLOptions struct {
-	Indent string // Default is 4 spaces.
+	Indent               string // Default is 4 spaces.
+	LineBreakMode        string // Either TTMLLineBreakModeBR (default) which separates lines with <br/> or TTMLLineBreakModeParagraph which writes each line in its own <p>.
+	RegionsFromPositions bool   // Inline origin/extent of items are moved to generated regions.
+	RootExtent           string // Written as the root tts:extent if not empty. Default is Metadata.TTMLRootExtent.
+	TimeBase             string // Written as the root ttp:timeBase if not empty, e.g. TTMLTimeBaseSMPTE which .itt expects.
+	TimeFormat           string // Either TTMLTimeFormatMilliseconds (default) or TTMLTimeFormatFrames which uses Metadata.Framerate, Metadata.TTMLDropMode and Metadata.TTMLMarkerMode.
 }
 
 // WriteToTTMLOption represents a WriteToTTML option.
@@ -611,14 +806,87 @@ func WriteToTTMLWithIndentOption(indent string) WriteToTTMLOption {
 	}
 }
 
+// WriteToTTMLWithLineBreakModeOption sets the line break mode option.
+func WriteToTTMLWithLineBreakModeOption(mode string) WriteToTTMLOption {
+	return func(o *WriteToTTMLOptions) {
+		o.LineBreakMode = mode
+	}
+}
+
+// WriteToTTMLWithRegionsFromPositionsOption sets the regions from positions option.
+func WriteToTTMLWithRegionsFromPositionsOption() WriteToTTMLOption {
+	return func(o *WriteToTTMLOptions) {
+		o.RegionsFromPositions = true
+	}
+}
+
+// WriteToTTMLWithRootExtentOption sets the root extent option.
+func WriteToTTMLWithRootExtentOption(extent string) WriteToTTMLOption {
+	return func(o *WriteToTTMLOptions) {
+		o.RootExtent = extent
+	}
+}
+
+// WriteToTTMLWithTimeBaseOption sets the time base option.
+func WriteToTTMLWithTimeBaseOption(timeBase string) WriteToTTMLOption {
+	return func(o *WriteToTTMLOptions) {
+		o.TimeBase = timeBase
+	}
+}
+
+// WriteToTTMLWithTimeFormatOption sets the time format option.
+func WriteToTTMLWithTimeFormatOption(format string) WriteToTTMLOption {
+	return func(o *WriteToTTMLOptions) {
+		o.TimeFormat = format
+	}
+}
+
+// WriteToITT writes subtitles in .itt format which is the TTML profile expected by Apple's tools:
+// smpte time base, frames based timing and root extent.
+// If not set, framerate defaults to 25 and root extent to 1920px 1080px.
+func (s Subtitles) WriteToITT(o io.Writer, opts ...WriteToTTMLOption) (err error) {
+	// Make sure there's a framerate without modifying the original metadata
+	var m Metadata
+	if s.Metadata != nil {
+		m = *s.Metadata
+	}
+	if m.Framerate <= 0 {
+		m.Framerate = ittDefaultFramerate
+	}
+	s.Metadata = &m
+
+	// Default options
+	do := []WriteToTTMLOption{
+		WriteToTTMLWithTimeBaseOption(TTMLTimeBaseSMPTE),
+		WriteToTTMLWithTimeFormatOption(TTMLTimeFormatFrames),
+	}
+	if m.TTMLRootExtent == "" {
+		do = append(do, WriteToTTMLWithRootExtentOption(ittDefaultExtent))
+	}
+
+	// Write
+	return s.WriteToTTML(o, append(do, opts...)...)
+}
+
 // WriteToTTML writes subtitles in .ttml format
 func (s Subtitles) WriteToTTML(o io.Writer, opts ...WriteToTTMLOption) (err error) {
 	// Create write options
-	wo := &WriteToTTMLOptions{Indent: "    "}
+	wo := &WriteToTTMLOptions{
+		Indent:        "    ",
+		LineBreakMode: TTMLLineBreakModeBR,
+		TimeFormat:    TTMLTimeFormatMilliseconds,
+	}
 	for _, opt := range opts {
 		opt(wo)
 	}
 
+	// Check line break mode
+	switch wo.LineBreakMode {
+	case TTMLLineBreakModeBR, TTMLLineBreakModeParagraph:
+	default:
+		return fmt.Errorf("astisub: invalid ttml line break mode %s", wo.LineBreakMode)
+	}
+
 	// Do not write anything if no subtitles
 	if len(s.Items) == 0 {
 		return ErrNoSubtitlesToWrite
@@ -630,6 +898,46 @@ func (s Subtitles) WriteToTTML(o io.Writer, opts ...WriteToTTMLOption) (err erro
 		XMLNamespaceTTS: "http://www.w3.org/ns/ttml#styling",
 	}
 
+	// Get framerate
+	var dropFrame bool
+	var framerate int
+	switch wo.TimeFormat {
+	case TTMLTimeFormatFrames:
+		if s.Metadata == nil || s.Metadata.Framerate <= 0 {
+			return errors.New("astisub: framerate is mandatory when writing ttml frames")
+		}
+		framerate = s.Metadata.Framerate
+		ttml.Framerate = framerate
+		ttml.MarkerMode = s.Metadata.TTMLMarkerMode
+		ttml.XMLNamespaceTTP = "http://www.w3.org/ns/ttml#parameter"
+
+		// Get drop mode
+		switch s.Metadata.TTMLDropMode {
+		case "", TTMLDropModeNonDrop:
+		case TTMLDropModeDropNTSC:
+			dropFrame = true
+			ttml.FramerateMultiplier = "1000 1001"
+		default:
+			return fmt.Errorf("astisub: unsupported ttml drop mode %s", s.Metadata.TTMLDropMode)
+		}
+		ttml.DropMode = s.Metadata.TTMLDropMode
+	case TTMLTimeFormatMilliseconds:
+	default:
+		return fmt.Errorf("astisub: invalid ttml time format %s", wo.TimeFormat)
+	}
+
+	// Add time base
+	if wo.TimeBase != "" {
+		ttml.TimeBase = wo.TimeBase
+		ttml.XMLNamespaceTTP = "http://www.w3.org/ns/ttml#parameter"
+	}
+
+	// Add root extent
+	ttml.Extent = wo.RootExtent
+	if ttml.Extent == "" && s.Metadata != nil {
+		ttml.Extent = s.Metadata.TTMLRootExtent
+	}
+
 	// Add metadata
 	if s.Metadata != nil {
 		if v, ok := ttmlLanguageMapping.GetInverse(s.Metadata.Language); ok {
@@ -678,17 +986,55 @@ func (s Subtitles) WriteToTTML(o io.Writer, opts ...WriteToTTMLOption) (err erro
 	}
 
 	// Add items
+	var positionRegions = make(map[string]string)
+	var positionRegionIdx int
 	for _, item := range s.Items {
 		// Init subtitle
 		var ttmlSubtitle = TTMLOutSubtitle{
 			Begin:                  TTMLOutDuration(item.StartAt),
+			DropFrame:              dropFrame,
 			End:                    TTMLOutDuration(item.EndAt),
+			Framerate:              framerate,
 			TTMLOutStyleAttributes: ttmlOutStyleAttributesFromStyleAttributes(item.InlineStyle),
 		}
 
 		// Add region
 		if item.Region != nil {
 			ttmlSubtitle.Region = item.Region.ID
+		} else if wo.RegionsFromPositions && (ttmlSubtitle.Origin != nil || ttmlSubtitle.Extent != nil) {
+			// Get region
+			var origin, extent string
+			if ttmlSubtitle.Origin != nil {
+				origin = *ttmlSubtitle.Origin
+			}
+			if ttmlSubtitle.Extent != nil {
+				extent = *ttmlSubtitle.Extent
+			}
+			key := origin + "|" + extent
+			id, ok := positionRegions[key]
+			if !ok {
+				// Create region with an id that doesn't collide with existing regions
+				for {
+					positionRegionIdx++
+					id = "astisub-ttml-region-" + strconv.Itoa(positionRegionIdx)
+					if _, ok := s.Regions[id]; !ok {
+						break
+					}
+				}
+				positionRegions[key] = id
+				ttml.Regions = append(ttml.Regions, TTMLOutRegion{TTMLOutHeader: TTMLOutHeader{
+					ID: id,
+					TTMLOutStyleAttributes: TTMLOutStyleAttributes{
+						Extent: ttmlSubtitle.Extent,
+						Origin: ttmlSubtitle.Origin,
+					},
+				}})
+			}
+
+			// Reference region instead of inline position
+			ttmlSubtitle.Region = id
+			ttmlSubtitle.Extent = nil
+			ttmlSubtitle.Origin = nil
 		}
 
 		// Add style
@@ -697,7 +1043,13 @@ func (s Subtitles) WriteToTTML(o io.Writer, opts ...WriteToTTMLOption) (err erro
 		}
 
 		// Add lines
+		var ttmlSubtitles []TTMLOutSubtitle
 		for _, line := range item.Lines {
+			// Init paragraph
+			if wo.LineBreakMode == TTMLLineBreakModeParagraph {
+				ttmlSubtitles = append(ttmlSubtitles, ttmlSubtitle)
+			}
+
 			// Loop through line items
 			for idx, lineItem := range line.Items {
 				// Init ttml item
@@ -711,17 +1063,50 @@ func (s Subtitles) WriteToTTML(o io.Writer, opts ...WriteToTTMLOption) (err erro
 					ttmlItem.Text = ttmlItem.Text + " "
 				}
 
+				// Add time boundaries, which are relative to the subtitle's begin and are clamped to it
+				if lineItem.StartAt > 0 || lineItem.EndAt > 0 {
+					d := TTMLOutDuration(lineItem.StartAt - item.StartAt)
+					if d < 0 {
+						d = 0
+					}
+					ttmlItem.Begin = &d
+				}
+				if lineItem.EndAt > 0 {
+					d := TTMLOutDuration(lineItem.EndAt - item.StartAt)
+					if d < 0 {
+						d = 0
+					}
+					ttmlItem.End = &d
+				}
+
 				// Add style
 				if lineItem.Style != nil {
 					ttmlItem.Style = lineItem.Style.ID
 				}
 
 				// Add ttml item
-				ttmlSubtitle.Items = append(ttmlSubtitle.Items, ttmlItem)
+				if wo.LineBreakMode == TTMLLineBreakModeParagraph {
+					ttmlSubtitles[len(ttmlSubtitles)-1].Items = append(ttmlSubtitles[len(ttmlSubtitles)-1].Items, ttmlItem)
+				} else {
+					ttmlSubtitle.Items = append(ttmlSubtitle.Items, ttmlItem)
+				}
 			}
 
 			// Add line break
-			ttmlSubtitle.Items = append(ttmlSubtitle.Items, TTMLOutItem{XMLName: xml.Name{Local: "br"}})
+			if wo.LineBreakMode == TTMLLineBreakModeBR {
+				ttmlSubtitle.Items = append(ttmlSubtitle.Items, TTMLOutItem{XMLName: xml.Name{Local: "br"}})
+			}
+		}
+
+		// Paragraph mode
+		if wo.LineBreakMode == TTMLLineBreakModeParagraph {
+			// Append subtitles
+			if len(ttmlSubtitles) > 0 {
+				ttml.Subtitles = append(ttml.Subtitles, ttmlSubtitles...)
+			} else {
+				ttml.Subtitles = append(ttml.Subtitles, ttmlSubtitle)
+			}
+			continue
 		}
 
 		// Remove last line break
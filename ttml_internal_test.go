@@ -73,3 +73,18 @@ func TestTTMLDuration(t *testing.T) {
 	assert.Equal(t, time.Second+500*time.Millisecond, d.duration())
 	assert.NoError(t, err)
 }
+
+func TestTTMLOutTime(t *testing.T) {
+	b, err := TTMLOutTime{Duration: 12*time.Hour + 34*time.Minute + 56*time.Second + 789*time.Millisecond}.MarshalText()
+	assert.NoError(t, err)
+	assert.Equal(t, "12:34:56.789", string(b))
+	b, err = TTMLOutTime{Duration: 12*time.Hour + 34*time.Minute + 56*time.Second + 80*time.Millisecond, Framerate: 25}.MarshalText()
+	assert.NoError(t, err)
+	assert.Equal(t, "12:34:56:02", string(b))
+	b, err = TTMLOutTime{Duration: time.Second + 999999999, Framerate: 30}.MarshalText()
+	assert.NoError(t, err)
+	assert.Equal(t, "00:00:02:00", string(b))
+	b, err = TTMLOutTime{Duration: time.Second / 30 * 29, Framerate: 30}.MarshalText()
+	assert.NoError(t, err)
+	assert.Equal(t, "00:00:00:29", string(b))
+}
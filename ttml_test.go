@@ -5,11 +5,13 @@ import (
 	"io/ioutil"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/asticode/go-astikit"
 
 	"github.com/asticode/go-astisub"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTTML(t *testing.T) {
@@ -18,7 +20,7 @@ func TestTTML(t *testing.T) {
 	assert.NoError(t, err)
 	assertSubtitleItems(t, s)
 	// Metadata
-	assert.Equal(t, &astisub.Metadata{Framerate: 25, Language: astisub.LanguageFrench, Title: "Title test", TTMLCopyright: "Copyright test"}, s.Metadata)
+	assert.Equal(t, &astisub.Metadata{Framerate: 25, Language: astisub.LanguageFrench, Title: "Title test", TTMLCopyright: "Copyright test", TTMLMarkerMode: "discontinuous"}, s.Metadata)
 	// Styles
 	assert.Equal(t, 3, len(s.Styles))
 	assert.Equal(t, astisub.Style{ID: "style_0", InlineStyle: &astisub.StyleAttributes{TTMLColor: astikit.StrPtr("white"), TTMLExtent: astikit.StrPtr("100% 10%"), TTMLFontFamily: astikit.StrPtr("sansSerif"), TTMLFontStyle: astikit.StrPtr("normal"), TTMLOrigin: astikit.StrPtr("0% 90%"), TTMLTextAlign: astikit.StrPtr("center"), WebVTTAlign: "center", WebVTTLine: "0%", WebVTTLines: 2, WebVTTPosition: "90%", WebVTTRegionAnchor: "0%,0%", WebVTTScroll: "up", WebVTTSize: "10%", WebVTTViewportAnchor: "0%,90%", WebVTTWidth: "100%"}, Style: s.Styles["style_2"]}, *s.Styles["style_0"])
@@ -85,3 +87,245 @@ func TestWriteToTTMLWithIndentOption(t *testing.T) {
 
 	assert.Equal(t, strings.TrimSpace(string(c)), strings.TrimSpace(w.String()))
 }
+
+func TestTTMLSpanTiming(t *testing.T) {
+	// Read
+	s, err := astisub.ReadFromTTML(strings.NewReader(`<tt><body><div><p begin="00:00:01.000" end="00:00:03.000"><span begin="00:00:00.000" end="00:00:00.500">Hello</span><span begin="00:00:00.500" end="00:00:02.000">world</span></p></div></body></tt>`))
+	assert.NoError(t, err)
+	assert.Len(t, s.Items, 1)
+	assert.Len(t, s.Items[0].Lines, 1)
+	assert.Len(t, s.Items[0].Lines[0].Items, 2)
+	assert.Equal(t, time.Second, s.Items[0].Lines[0].Items[0].StartAt)
+	assert.Equal(t, 1500*time.Millisecond, s.Items[0].Lines[0].Items[0].EndAt)
+	assert.Equal(t, 1500*time.Millisecond, s.Items[0].Lines[0].Items[1].StartAt)
+	assert.Equal(t, 3*time.Second, s.Items[0].Lines[0].Items[1].EndAt)
+
+	// Write
+	w := &bytes.Buffer{}
+	err = s.WriteToTTML(w, astisub.WriteToTTMLWithIndentOption(""))
+	assert.NoError(t, err)
+	assert.Contains(t, w.String(), `<span begin="00:00:00.000" end="00:00:00.500">Hello </span><span begin="00:00:00.500" end="00:00:02.000">world</span>`)
+
+	// Span starting at 0 or before its subtitle
+	s = &astisub.Subtitles{Items: []*astisub.Item{
+		{EndAt: time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{EndAt: 500 * time.Millisecond, Text: "Hello"}}}}},
+		{EndAt: 3 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{EndAt: 2500 * time.Millisecond, StartAt: time.Second, Text: "world"}}}}, StartAt: 2 * time.Second},
+	}}
+	w.Reset()
+	err = s.WriteToTTML(w, astisub.WriteToTTMLWithIndentOption(""))
+	assert.NoError(t, err)
+	assert.Contains(t, w.String(), `<span begin="00:00:00.000" end="00:00:00.500">Hello</span>`)
+	assert.Contains(t, w.String(), `<span begin="00:00:00.000" end="00:00:00.500">world</span>`)
+}
+
+func TestWriteToTTMLWithRegionsFromPositionsOption(t *testing.T) {
+	s := &astisub.Subtitles{
+		Items: []*astisub.Item{
+			{EndAt: time.Second, InlineStyle: &astisub.StyleAttributes{TTMLExtent: astikit.StrPtr("80% 10%"), TTMLOrigin: astikit.StrPtr("10% 10%")}, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "1"}}}}},
+			{EndAt: 2 * time.Second, InlineStyle: &astisub.StyleAttributes{TTMLExtent: astikit.StrPtr("80% 10%"), TTMLOrigin: astikit.StrPtr("10% 80%")}, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "2"}}}}, StartAt: time.Second},
+			{EndAt: 3 * time.Second, InlineStyle: &astisub.StyleAttributes{TTMLExtent: astikit.StrPtr("80% 10%"), TTMLOrigin: astikit.StrPtr("10% 10%")}, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "3"}}}}, StartAt: 2 * time.Second},
+		},
+		Regions: map[string]*astisub.Region{"astisub-ttml-region-1": {ID: "astisub-ttml-region-1"}},
+	}
+
+	w := &bytes.Buffer{}
+	err := s.WriteToTTML(w, astisub.WriteToTTMLWithIndentOption(""), astisub.WriteToTTMLWithRegionsFromPositionsOption())
+	assert.NoError(t, err)
+	assert.Contains(t, w.String(), `<region xml:id="astisub-ttml-region-2" tts:extent="80% 10%" tts:origin="10% 10%"></region>`)
+	assert.Contains(t, w.String(), `<region xml:id="astisub-ttml-region-3" tts:extent="80% 10%" tts:origin="10% 80%"></region>`)
+	assert.Equal(t, 2, strings.Count(w.String(), `region="astisub-ttml-region-2"`))
+	assert.Equal(t, 1, strings.Count(w.String(), `region="astisub-ttml-region-3"`))
+	assert.NotContains(t, w.String(), `<p begin="00:00:00.000" end="00:00:01.000" tts:extent`)
+}
+
+func TestTTMLSpacePreserve(t *testing.T) {
+	s, err := astisub.ReadFromTTML(strings.NewReader(`<tt><body><div>
+<p begin="00:00:01.000" end="00:00:02.000" xml:space="preserve">  Do   <span>re</span>  mi</p>
+<p begin="00:00:02.000" end="00:00:03.000">  Do   <span>re</span>  mi</p>
+</div></body></tt>`))
+	assert.NoError(t, err)
+	assert.Len(t, s.Items, 2)
+	assert.Len(t, s.Items[0].Lines[0].Items, 3)
+	assert.Equal(t, "  Do   ", s.Items[0].Lines[0].Items[0].Text)
+	assert.Equal(t, "re", s.Items[0].Lines[0].Items[1].Text)
+	assert.Equal(t, "  mi", s.Items[0].Lines[0].Items[2].Text)
+	assert.Equal(t, "Do re mi", s.Items[1].String())
+
+	// Inherited from root
+	s, err = astisub.ReadFromTTML(strings.NewReader(`<tt xml:space="preserve"><body><div><p begin="00:00:01.000" end="00:00:02.000">  Do</p></div></body></tt>`))
+	assert.NoError(t, err)
+	assert.Equal(t, "  Do", s.Items[0].String())
+}
+
+func TestTTMLSharedParentStyle(t *testing.T) {
+	s, err := astisub.ReadFromTTML(strings.NewReader(`<tt><head><styling>
+<style xml:id="parent"/>
+<style xml:id="child_1" style="parent"/>
+<style xml:id="child_2" style="parent"/>
+</styling></head><body><div><p begin="00:00:01.000" end="00:00:02.000">Text</p></div></body></tt>`))
+	assert.NoError(t, err)
+	assert.Equal(t, s.Styles["parent"], s.Styles["child_1"].Style)
+	assert.Equal(t, s.Styles["parent"], s.Styles["child_2"].Style)
+}
+
+func TestWriteToTTMLWithTimeFormatOption(t *testing.T) {
+	// Read
+	s, err := astisub.ReadFromTTML(strings.NewReader(`<tt xmlns:ttp="http://www.w3.org/ns/ttml#parameter" ttp:frameRate="30"><body><div><p begin="00:00:01:10" end="00:00:02:29">Hello <span begin="00:00:00:15" end="00:00:01:00">world</span></p></div></body></tt>`))
+	require.NoError(t, err)
+
+	// Invalid time format
+	w := &bytes.Buffer{}
+	err = s.WriteToTTML(w, astisub.WriteToTTMLWithTimeFormatOption("invalid"))
+	assert.Error(t, err)
+
+	// Milliseconds
+	err = s.WriteToTTML(w, astisub.WriteToTTMLWithIndentOption(""))
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), `<p begin="00:00:01.333" end="00:00:02.966">`)
+
+	// Frames
+	w.Reset()
+	err = s.WriteToTTML(w, astisub.WriteToTTMLWithIndentOption(""), astisub.WriteToTTMLWithTimeFormatOption(astisub.TTMLTimeFormatFrames))
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), `ttp:frameRate="30"`)
+	assert.Contains(t, w.String(), `<p begin="00:00:01:10" end="00:00:02:29">`)
+	assert.Contains(t, w.String(), `<span begin="00:00:00:15" end="00:00:01:00">world</span>`)
+
+	// Round trip
+	s2, err := astisub.ReadFromTTML(bytes.NewReader(w.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, s.Items[0].StartAt, s2.Items[0].StartAt)
+	assert.Equal(t, s.Items[0].EndAt, s2.Items[0].EndAt)
+
+	// No framerate
+	s.Metadata.Framerate = 0
+	err = s.WriteToTTML(w, astisub.WriteToTTMLWithTimeFormatOption(astisub.TTMLTimeFormatFrames))
+	assert.Error(t, err)
+}
+
+func TestTTMLPrefixedNamespaces(t *testing.T) {
+	s, err := astisub.ReadFromTTML(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+<tt:tt xmlns:tt="http://www.w3.org/ns/ttml" xmlns:s="http://www.w3.org/ns/ttml#styling" xmlns:ttp="http://www.w3.org/ns/ttml#parameter" ttp:frameRate="25" xml:lang="en">
+<tt:head><tt:styling><tt:style xml:id="s1" s:color="#ff0000"/></tt:styling><tt:layout><tt:region xml:id="r1" s:origin="10% 80%" s:extent="80% 10%"/></tt:layout></tt:head>
+<tt:body><tt:div><tt:p begin="00:00:01:00" end="00:00:02:00" region="r1" style="s1"><tt:span s:color="#00ff00">Hello</tt:span><tt:br/><tt:span s:fontStyle="italic">World</tt:span></tt:p></tt:div></tt:body></tt:tt>`))
+	require.NoError(t, err)
+	assert.Equal(t, 25, s.Metadata.Framerate)
+	assert.Equal(t, astisub.LanguageEnglish, s.Metadata.Language)
+	assert.Equal(t, astikit.StrPtr("#ff0000"), s.Styles["s1"].InlineStyle.TTMLColor)
+	assert.Equal(t, astikit.StrPtr("10% 80%"), s.Regions["r1"].InlineStyle.TTMLOrigin)
+	require.Len(t, s.Items, 1)
+	assert.Equal(t, time.Second, s.Items[0].StartAt)
+	assert.Equal(t, "r1", s.Items[0].Region.ID)
+	assert.Equal(t, "s1", s.Items[0].Style.ID)
+	require.Len(t, s.Items[0].Lines, 2)
+	assert.Equal(t, "Hello", s.Items[0].Lines[0].String())
+	assert.Equal(t, astikit.StrPtr("#00ff00"), s.Items[0].Lines[0].Items[0].InlineStyle.TTMLColor)
+	assert.Equal(t, "World", s.Items[0].Lines[1].String())
+	assert.Equal(t, astikit.StrPtr("italic"), s.Items[0].Lines[1].Items[0].InlineStyle.TTMLFontStyle)
+}
+
+func TestWriteToITT(t *testing.T) {
+	s := mockSubtitles()
+	w := &bytes.Buffer{}
+	err := s.WriteToITT(w, astisub.WriteToTTMLWithIndentOption(""))
+	require.NoError(t, err)
+	assert.Nil(t, s.Metadata)
+	assert.Contains(t, w.String(), `tts:extent="1920px 1080px" ttp:frameRate="25"`)
+	assert.Contains(t, w.String(), `ttp:timeBase="smpte"`)
+	assert.Contains(t, w.String(), `<p begin="00:00:01:00" end="00:00:03:00">`)
+
+	// Read
+	s2, err := astisub.ReadFromTTML(bytes.NewReader(w.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, s.Items[1].EndAt, s2.Items[1].EndAt)
+	assert.Equal(t, "subtitle-2", s2.Items[1].String())
+
+	// Metadata root extent is preserved
+	s.Metadata = &astisub.Metadata{TTMLRootExtent: "1280px 720px"}
+	w.Reset()
+	err = s.WriteToITT(w, astisub.WriteToTTMLWithIndentOption(""))
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), `tts:extent="1280px 720px"`)
+	assert.NotContains(t, w.String(), `1920px 1080px`)
+}
+
+func TestTTMLDropMode(t *testing.T) {
+	// Read
+	s, err := astisub.ReadFromTTML(strings.NewReader(`<tt xmlns:ttp="http://www.w3.org/ns/ttml#parameter" ttp:timeBase="smpte" ttp:frameRate="30" ttp:frameRateMultiplier="1000 1001" ttp:dropMode="dropNTSC" ttp:markerMode="discontinuous"><body><div><p begin="00:01:00:02" end="00:10:00:00">Hello</p></div></body></tt>`))
+	require.NoError(t, err)
+	assert.Equal(t, astisub.TTMLDropModeDropNTSC, s.Metadata.TTMLDropMode)
+	assert.Equal(t, "discontinuous", s.Metadata.TTMLMarkerMode)
+	assert.Equal(t, 60060*time.Millisecond, s.Items[0].StartAt)
+	assert.Equal(t, 599999400*time.Microsecond, s.Items[0].EndAt)
+
+	// Write
+	w := &bytes.Buffer{}
+	err = s.WriteToTTML(w, astisub.WriteToTTMLWithIndentOption(""), astisub.WriteToTTMLWithTimeFormatOption(astisub.TTMLTimeFormatFrames))
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), `ttp:dropMode="dropNTSC"`)
+	assert.Contains(t, w.String(), `ttp:frameRateMultiplier="1000 1001"`)
+	assert.Contains(t, w.String(), `ttp:markerMode="discontinuous"`)
+	assert.NotContains(t, w.String(), `ttp:timeBase`)
+	assert.Contains(t, w.String(), `<p begin="00:01:00:02" end="00:10:00:00">`)
+
+	// Unsupported drop mode
+	s.Metadata.TTMLDropMode = astisub.TTMLDropModeDropPAL
+	err = s.WriteToTTML(w, astisub.WriteToTTMLWithTimeFormatOption(astisub.TTMLTimeFormatFrames))
+	assert.Error(t, err)
+}
+
+func TestTTMLLineBreakMode(t *testing.T) {
+	s := &astisub.Subtitles{Items: []*astisub.Item{{
+		EndAt: 2 * time.Second,
+		Lines: []astisub.Line{
+			{Items: []astisub.LineItem{{Text: "line-1"}}},
+			{Items: []astisub.LineItem{{Text: "line-2"}}},
+		},
+		StartAt: time.Second,
+	}}}
+
+	// Br
+	w := &bytes.Buffer{}
+	err := s.WriteToTTML(w, astisub.WriteToTTMLWithIndentOption(""))
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), `<p begin="00:00:01.000" end="00:00:02.000"><span>line-1</span><br></br><span>line-2</span></p>`)
+
+	// Paragraph
+	w.Reset()
+	err = s.WriteToTTML(w, astisub.WriteToTTMLWithIndentOption(""), astisub.WriteToTTMLWithLineBreakModeOption(astisub.TTMLLineBreakModeParagraph))
+	require.NoError(t, err)
+	assert.Contains(t, w.String(), `<p begin="00:00:01.000" end="00:00:02.000"><span>line-1</span></p><p begin="00:00:01.000" end="00:00:02.000"><span>line-2</span></p>`)
+	assert.NotContains(t, w.String(), "<br>")
+
+	// Invalid
+	err = s.WriteToTTML(w, astisub.WriteToTTMLWithLineBreakModeOption("invalid"))
+	assert.Error(t, err)
+}
+
+func TestTTMLLengthUnits(t *testing.T) {
+	const i = `<tt xmlns="http://www.w3.org/ns/ttml" xmlns:tts="http://www.w3.org/ns/ttml#styling" tts:extent="1920px 1080px">
+<head><layout>
+<region xml:id="pixels" tts:origin="192px 864px" tts:extent="1536px 108px"/>
+<region xml:id="percentages" tts:origin="10% 80%" tts:extent="80% 10%"/>
+<region xml:id="unitless" tts:origin="10 80" tts:extent="80 10"/>
+<region xml:id="invalid" tts:origin="1c 2c"/>
+</layout></head>
+<body><div><p begin="00:00:01.000" end="00:00:02.000" region="pixels">text</p></div></body>
+</tt>`
+	s, err := astisub.ReadFromTTML(strings.NewReader(i))
+	require.NoError(t, err)
+	assert.Equal(t, "1920px 1080px", s.Metadata.TTMLRootExtent)
+	for _, id := range []string{"pixels", "percentages", "unitless"} {
+		sa := s.Regions[id].InlineStyle
+		assert.Equal(t, "10%,80%", sa.WebVTTViewportAnchor, id)
+		assert.Equal(t, "80%", sa.WebVTTWidth, id)
+		assert.Equal(t, "10%", sa.WebVTTSize, id)
+		assert.Equal(t, 2, sa.WebVTTLines, id)
+	}
+	assert.Equal(t, "", s.Regions["invalid"].InlineStyle.WebVTTViewportAnchor)
+
+	// Root extent is written back
+	w := &bytes.Buffer{}
+	require.NoError(t, s.WriteToTTML(w))
+	assert.Contains(t, w.String(), `tts:extent="1920px 1080px"`)
+}
@@ -1,10 +1,13 @@
 package astisub
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"os"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
@@ -12,6 +15,7 @@ import (
 	"time"
 	"unicode/utf8"
 
+	"github.com/asticode/go-astikit"
 	"golang.org/x/net/html"
 )
 
@@ -24,10 +28,21 @@ const (
 	webvttBlockNameStyle          = "style"
 	webvttBlockNameText           = "text"
 	webvttDefaultStyleID          = "astisub-webvtt-default-style-id"
+	webvttLanguageHeader          = "Language: "
+	webvttLineHeight              = 5.33 // In percentage of the viewport height
+	webvttTagNameLang             = "lang"
 	webvttTimeBoundariesSeparator = "-->"
 	webvttTimestampMapHeader      = "X-TIMESTAMP-MAP"
 )
 
+// WebVTT languages
+var webvttLanguageMapping = astikit.NewBiMap().
+	Set("en", LanguageEnglish).
+	Set("fr", LanguageFrench).
+	Set("ja", LanguageJapanese).
+	Set("no", LanguageNorwegian).
+	Set("zh", LanguageChinese)
+
 // Vars
 var (
 	bytesWebVTTItalicEndTag            = []byte("</i>")
@@ -39,7 +54,7 @@ var (
 
 // parseDurationWebVTT parses a .vtt duration
 func parseDurationWebVTT(i string) (time.Duration, error) {
-	return parseDuration(i, ".", 3)
+	return DurationFormat{Digits: 3, Sep: "."}.Parse(i)
 }
 
 // WebVTTTimestampMap is a structure for storing timestamps for WEBVTT's
@@ -111,10 +126,31 @@ func parseWebVTTTimestampMap(line string) (timestampMap *WebVTTTimestampMap, err
 	return
 }
 
+// WebVTTOptions represents WebVTT parsing options
+type WebVTTOptions struct {
+	// KeepRawText - store the original unparsed text of each item in Item.Raw
+	KeepRawText bool
+	// MaxItems - if > 0, reading fails with ErrMaxItemsExceeded as soon as more items are parsed
+	MaxItems int
+	// PreserveSpaces - keep leading, trailing and consecutive spaces of cue text as is. Use it along with
+	// WriteToWebVTTWithPreserveSpacesOption to round-trip alignment-sensitive cues
+	PreserveSpaces bool
+}
+
 // ReadFromWebVTT parses a .vtt content
+func ReadFromWebVTT(i io.Reader) (o *Subtitles, err error) {
+	return ReadFromWebVTTWithOptions(i, WebVTTOptions{})
+}
+
+// ReadFromWebVTTWithOptions parses a .vtt content
 // TODO Tags (u, i, b)
 // TODO Class
-func ReadFromWebVTT(i io.Reader) (o *Subtitles, err error) {
+func ReadFromWebVTTWithOptions(i io.Reader, opts WebVTTOptions) (o *Subtitles, err error) {
+	return ReadFromWebVTTContext(context.Background(), i, opts)
+}
+
+// ReadFromWebVTTContext parses a .vtt content and returns early once the context is cancelled
+func ReadFromWebVTTContext(ctx context.Context, i io.Reader, opts WebVTTOptions) (o *Subtitles, err error) {
 	// Init
 	o = NewSubtitles()
 	var scanner = newScanner(i)
@@ -124,6 +160,12 @@ func ReadFromWebVTT(i io.Reader) (o *Subtitles, err error) {
 
 	// Skip the header
 	for scanner.Scan() {
+		// Check context
+		if err = ctx.Err(); err != nil {
+			err = fmt.Errorf("astisub: checking context failed: %w", err)
+			return
+		}
+
 		lineNum++
 		line = scanner.Text()
 		line = strings.TrimPrefix(line, string(BytesBOM))
@@ -141,9 +183,16 @@ func ReadFromWebVTT(i io.Reader) (o *Subtitles, err error) {
 	var blockName string
 	var comments []string
 	var index int
+	var region *Region
 	var sa = &StyleAttributes{}
 
 	for scanner.Scan() {
+		// Check context
+		if err = ctx.Err(); err != nil {
+			err = fmt.Errorf("astisub: checking context failed: %w", err)
+			return
+		}
+
 		// Fetch line
 		line = strings.TrimSpace(scanner.Text())
 		lineNum++
@@ -171,41 +220,29 @@ func ReadFromWebVTT(i io.Reader) (o *Subtitles, err error) {
 			// Reset WebVTTTags
 			sa.WebVTTTags = []WebVTTTag{}
 
+		// Language
+		case strings.HasPrefix(line, webvttLanguageHeader) && blockName == "" && len(o.Items) == 0:
+			if v, ok := webvttLanguageMapping.Get(strings.TrimSpace(strings.TrimPrefix(line, webvttLanguageHeader))); ok {
+				if o.Metadata == nil {
+					o.Metadata = new(Metadata)
+				}
+				o.Metadata.Language = v.(string)
+			}
 		// Region
 		case strings.HasPrefix(line, "Region: "):
 			// Add region styles
 			var r = &Region{InlineStyle: &StyleAttributes{}}
-			for _, part := range strings.Split(strings.TrimPrefix(line, "Region: "), " ") {
-				// Split on "="
-				var split = strings.Split(part, "=")
-				if len(split) <= 1 {
-					err = fmt.Errorf("astisub: line %d: Invalid region style %s", lineNum, part)
-					return
-				}
-
-				// Switch on key
-				switch split[0] {
-				case "id":
-					r.ID = split[1]
-				case "lines":
-					if r.InlineStyle.WebVTTLines, err = strconv.Atoi(split[1]); err != nil {
-						err = fmt.Errorf("atoi of %s failed: %w", split[1], err)
-						return
-					}
-				case "regionanchor":
-					r.InlineStyle.WebVTTRegionAnchor = split[1]
-				case "scroll":
-					r.InlineStyle.WebVTTScroll = split[1]
-				case "viewportanchor":
-					r.InlineStyle.WebVTTViewportAnchor = split[1]
-				case "width":
-					r.InlineStyle.WebVTTWidth = split[1]
-				}
+			if err = parseWebVTTRegionSettings(r, strings.TrimPrefix(line, "Region: "), "="); err != nil {
+				err = fmt.Errorf("astisub: line %d: %w", lineNum, err)
+				return
 			}
-			r.InlineStyle.propagateWebVTTAttributes()
 
 			// Add region
 			o.Regions[r.ID] = r
+		// Region block
+		case line == "REGION":
+			blockName = webvttBlockNameRegion
+			region = &Region{InlineStyle: &StyleAttributes{}}
 		// Style
 		case strings.HasPrefix(line, "STYLE"):
 			blockName = webvttBlockNameStyle
@@ -234,10 +271,16 @@ func ReadFromWebVTT(i io.Reader) (o *Subtitles, err error) {
 			index = 0
 
 			// Split line on time boundaries
-			var left = strings.Split(line, webvttTimeBoundariesSeparator)
+			// Whitespaces around the separator may be spaces or tabs, in any number
+			var left = strings.SplitN(line, webvttTimeBoundariesSeparator, 2)
+			left[0] = strings.TrimSpace(left[0])
 
 			// Split line on space to get remaining of time data
 			var right = strings.Fields(left[1])
+			if len(right) == 0 {
+				err = fmt.Errorf("astisub: line %d: time boundaries has no end time", lineNum)
+				return
+			}
 
 			// Parse time boundaries
 			if item.StartAt, err = parseDurationWebVTT(left[0]); err != nil {
@@ -294,6 +337,12 @@ func ReadFromWebVTT(i io.Reader) (o *Subtitles, err error) {
 			// Append item
 			o.Items = append(o.Items, item)
 
+			// Check limit
+			if opts.MaxItems > 0 && len(o.Items) > opts.MaxItems {
+				err = ErrMaxItemsExceeded
+				return
+			}
+
 		case strings.HasPrefix(line, webvttTimestampMapHeader):
 			if len(item.Lines) > 0 {
 				err = errors.New("astisub: found timestamp map after processing subtitle items")
@@ -317,11 +366,34 @@ func ReadFromWebVTT(i io.Reader) (o *Subtitles, err error) {
 			switch blockName {
 			case webvttBlockNameComment:
 				comments = append(comments, line)
+			case webvttBlockNameRegion:
+				// Add region styles
+				if err = parseWebVTTRegionSettings(region, line, ":"); err != nil {
+					err = fmt.Errorf("astisub: line %d: %w", lineNum, err)
+					return
+				}
+
+				// Add region
+				if region.ID != "" {
+					o.Regions[region.ID] = region
+				}
 			case webvttBlockNameStyle:
 				sa.WebVTTStyles = append(sa.WebVTTStyles, line)
 			case webvttBlockNameText:
+				// Store raw line
+				if opts.KeepRawText {
+					if len(item.Raw) > 0 {
+						item.Raw += "\n"
+					}
+					item.Raw += line
+				}
+
 				// Parse line
-				if l := parseTextWebVTT(line, sa); len(l.Items) > 0 {
+				text := line
+				if opts.PreserveSpaces {
+					text = scanner.Text()
+				}
+				if l := parseTextWebVTT(text, sa, opts.PreserveSpaces); len(l.Items) > 0 {
 					item.Lines = append(item.Lines, l)
 				}
 			default:
@@ -333,8 +405,41 @@ func ReadFromWebVTT(i io.Reader) (o *Subtitles, err error) {
 	return
 }
 
+// parseWebVTTRegionSettings parses space separated region settings such as "id<sep>fred width<sep>40%"
+func parseWebVTTRegionSettings(r *Region, line, sep string) (err error) {
+	for _, part := range strings.Fields(line) {
+		// Split on separator
+		var split = strings.SplitN(part, sep, 2)
+		if len(split) <= 1 {
+			err = fmt.Errorf("invalid region style %s", part)
+			return
+		}
+
+		// Switch on key
+		switch split[0] {
+		case "id":
+			r.ID = split[1]
+		case "lines":
+			if r.InlineStyle.WebVTTLines, err = strconv.Atoi(split[1]); err != nil {
+				err = fmt.Errorf("atoi of %s failed: %w", split[1], err)
+				return
+			}
+		case "regionanchor":
+			r.InlineStyle.WebVTTRegionAnchor = split[1]
+		case "scroll":
+			r.InlineStyle.WebVTTScroll = split[1]
+		case "viewportanchor":
+			r.InlineStyle.WebVTTViewportAnchor = split[1]
+		case "width":
+			r.InlineStyle.WebVTTWidth = split[1]
+		}
+	}
+	r.InlineStyle.propagateWebVTTAttributes()
+	return
+}
+
 // parseTextWebVTT parses the input line to fill the Line
-func parseTextWebVTT(i string, sa *StyleAttributes) (o Line) {
+func parseTextWebVTT(i string, sa *StyleAttributes, preserveSpaces bool) (o Line) {
 	// Create tokenizer
 	tr := html.NewTokenizer(strings.NewReader(i))
 
@@ -387,11 +492,19 @@ func parseTextWebVTT(i string, sa *StyleAttributes) (o Line) {
 			}
 
 		case html.TextToken:
-			// Get style attribute
+			// Get style attribute and language
+			// <lang> tags are not stored as tags, the innermost one sets the line item language
+			var lang string
+			var tags []WebVTTTag
+			for _, tag := range sa.WebVTTTags {
+				if tag.Name == webvttTagNameLang {
+					lang = tag.Annotation
+				} else {
+					tags = append(tags, tag)
+				}
+			}
 			var styleAttributes *StyleAttributes
-			if len(sa.WebVTTTags) > 0 {
-				tags := make([]WebVTTTag, len(sa.WebVTTTags))
-				copy(tags, sa.WebVTTTags)
+			if len(tags) > 0 {
 				styleAttributes = &StyleAttributes{
 					WebVTTTags: tags,
 				}
@@ -399,18 +512,31 @@ func parseTextWebVTT(i string, sa *StyleAttributes) (o Line) {
 			}
 
 			// Append items
-			o.Items = append(o.Items, parseTextWebVTTTextToken(styleAttributes, string(tr.Raw()))...)
+			lis := parseTextWebVTTTextToken(styleAttributes, string(tr.Raw()), preserveSpaces)
+			for idx := range lis {
+				lis[idx].Language = lang
+			}
+			o.Items = append(o.Items, lis...)
 		}
 	}
 	return
 }
 
-func parseTextWebVTTTextToken(sa *StyleAttributes, line string) (ret []LineItem) {
+func parseTextWebVTTTextToken(sa *StyleAttributes, line string, preserveSpaces bool) (ret []LineItem) {
+	// Carriage returns must never leak into texts
+	line = strings.ReplaceAll(line, "\r", "")
+
+	// Trim spaces unless they must be preserved
+	trim := strings.TrimSpace
+	if preserveSpaces {
+		trim = func(s string) string { return s }
+	}
+
 	// split the line by inline timestamps
 	indexes := webVTTRegexpInlineTimestamp.FindAllStringSubmatchIndex(line, -1)
 
 	if len(indexes) == 0 {
-		if s := strings.TrimSpace(line); s != "" {
+		if s := trim(line); s != "" {
 			return []LineItem{{
 				InlineStyle: sa,
 				Text:        unescapeHTML(s),
@@ -420,7 +546,7 @@ func parseTextWebVTTTextToken(sa *StyleAttributes, line string) (ret []LineItem)
 	}
 
 	// get the text before the first timestamp
-	if s := strings.TrimSpace(line[:indexes[0][0]]); s != "" {
+	if s := trim(line[:indexes[0][0]]); s != "" {
 		ret = append(ret, LineItem{
 			InlineStyle: sa,
 			Text:        unescapeHTML(s),
@@ -433,7 +559,7 @@ func parseTextWebVTTTextToken(sa *StyleAttributes, line string) (ret []LineItem)
 		if i+1 < len(indexes) {
 			endIndex = indexes[i+1][0]
 		}
-		s := strings.TrimSpace(line[match[1]:endIndex])
+		s := trim(line[match[1]:endIndex])
 		if s == "" {
 			continue
 		}
@@ -456,11 +582,195 @@ func parseTextWebVTTTextToken(sa *StyleAttributes, line string) (ret []LineItem)
 
 // formatDurationWebVTT formats a .vtt duration
 func formatDurationWebVTT(i time.Duration) string {
-	return formatDuration(i, ".", 3)
+	return DurationFormat{Digits: 3, Sep: "."}.Format(i)
+}
+
+// formatCueDurationWebVTT formats a .vtt cue timing, using the mm:ss.ttt form under an hour if requested
+func formatCueDurationWebVTT(i time.Duration, omitHoursUnderOneHour bool) string {
+	s := formatDurationWebVTT(i)
+	if omitHoursUnderOneHour && i < time.Hour {
+		s = strings.TrimPrefix(s, "00:")
+	}
+	return s
+}
+
+// WriteToWebVTTOptions represents WebVTT write options.
+type WriteToWebVTTOptions struct {
+	EmptyCueMode          string // How items without lines are written, default is WebVTTEmptyCueModeKeep.
+	Language              bool   // Metadata language is written in the header.
+	OmitHoursUnderOneHour bool   // Cue timings under an hour are written as mm:ss.ttt.
+	OmitTimestampMap      bool   // Metadata X-TIMESTAMP-MAP is not written, e.g. because it became stale after timings were offset.
+	PreserveSpaces        bool   // Line items are written as is, without adding spaces between them.
+	// X-TIMESTAMP-MAP written instead of the metadata one
+	TimestampMap *WebVTTTimestampMap
+}
+
+// WebVTT empty cue modes
+const (
+	WebVTTEmptyCueModeKeep = ""     // Cue is written without payload, which some validators reject
+	WebVTTEmptyCueModeNBSP = "nbsp" // Cue payload is a single &nbsp;
+	WebVTTEmptyCueModeSkip = "skip" // Cue is not written
+)
+
+// WriteToWebVTTOption represents a WriteToWebVTT option.
+type WriteToWebVTTOption func(o *WriteToWebVTTOptions)
+
+// WriteToWebVTTWithEmptyCueModeOption sets the empty cue mode option.
+func WriteToWebVTTWithEmptyCueModeOption(mode string) WriteToWebVTTOption {
+	return func(o *WriteToWebVTTOptions) {
+		o.EmptyCueMode = mode
+	}
+}
+
+// WriteToWebVTTWithLanguageOption sets the language option.
+func WriteToWebVTTWithLanguageOption() WriteToWebVTTOption {
+	return func(o *WriteToWebVTTOptions) {
+		o.Language = true
+	}
+}
+
+// WriteToWebVTTWithOmitHoursUnderOneHourOption sets the omit hours under one hour option.
+func WriteToWebVTTWithOmitHoursUnderOneHourOption() WriteToWebVTTOption {
+	return func(o *WriteToWebVTTOptions) {
+		o.OmitHoursUnderOneHour = true
+	}
+}
+
+// WriteToWebVTTWithPreserveSpacesOption sets the preserve spaces option.
+func WriteToWebVTTWithPreserveSpacesOption() WriteToWebVTTOption {
+	return func(o *WriteToWebVTTOptions) {
+		o.PreserveSpaces = true
+	}
+}
+
+// WriteToWebVTTWithTimestampMapOption sets the timestamp map option so that X-TIMESTAMP-MAP is regenerated, mapping
+// LOCAL:00:00:00.000 to the provided MPEG-TS base
+func WriteToWebVTTWithTimestampMapOption(mpegTS int64) WriteToWebVTTOption {
+	return func(o *WriteToWebVTTOptions) {
+		o.TimestampMap = &WebVTTTimestampMap{MpegTS: mpegTS}
+	}
+}
+
+// WriteToWebVTTWithoutTimestampMapOption sets the omit timestamp map option.
+func WriteToWebVTTWithoutTimestampMapOption() WriteToWebVTTOption {
+	return func(o *WriteToWebVTTOptions) {
+		o.OmitTimestampMap = true
+	}
+}
+
+// webvttHeader returns the .vtt header, without its trailing blank line
+func (s Subtitles) webvttHeader(wo *WriteToWebVTTOptions) (c []byte) {
+	c = append(c, []byte("WEBVTT")...)
+
+	// Write language if set
+	if wo.Language && s.Metadata != nil {
+		if v, ok := webvttLanguageMapping.GetInverse(s.Metadata.Language); ok {
+			c = append(c, []byte("\n"+webvttLanguageHeader+v.(string))...)
+		}
+	}
+
+	// Write X-TIMESTAMP-MAP if set
+	webVTTTimestampMap := wo.TimestampMap
+	if webVTTTimestampMap == nil && !wo.OmitTimestampMap && s.Metadata != nil {
+		webVTTTimestampMap = s.Metadata.WebVTTTimestampMap
+	}
+	if webVTTTimestampMap != nil {
+		c = append(c, []byte("\n")...)
+		c = append(c, []byte(webVTTTimestampMap.String())...)
+	}
+	return
+}
+
+// WriteToWebVTTSegments writes subtitles in .vtt segments of duration segmentDur in dir, as expected by HLS, and
+// returns their paths in order. Items overlapping segment boundaries are fragmented, cue timings are kept as is
+// and each segment maps LOCAL:00:00:00.000 to baseMpegTS. Segments without items only contain a header.
+func (s Subtitles) WriteToWebVTTSegments(dir string, segmentDur time.Duration, baseMpegTS int64, opts ...WriteToWebVTTOption) (paths []string, err error) {
+	// Invalid segment duration
+	if segmentDur <= 0 {
+		err = fmt.Errorf("astisub: invalid segment duration %s", segmentDur)
+		return
+	}
+
+	// Copy subtitles so that fragmenting doesn't modify them
+	c := &Subtitles{
+		Metadata: s.Metadata,
+		Regions:  s.Regions,
+		Styles:   s.Styles,
+	}
+	for _, i := range s.Items {
+		c.Items = append(c.Items, copyItem(i))
+	}
+	c.Order()
+
+	// Fragment on the segment grid
+	c.Fragment(segmentDur)
+
+	// Every segment shares the same timestamp map
+	opts = append(opts, WriteToWebVTTWithTimestampMapOption(baseMpegTS))
+
+	// Loop through segments
+	var idx int
+	for n := 0; idx < len(c.Items); n++ {
+		// Get segment items
+		seg := *c
+		seg.Items = nil
+		for ; idx < len(c.Items) && c.Items[idx].StartAt < time.Duration(n+1)*segmentDur; idx++ {
+			seg.Items = append(seg.Items, c.Items[idx])
+		}
+
+		// Write segment
+		p := filepath.Join(dir, fmt.Sprintf("segment%d.vtt", n))
+		if err = seg.writeWebVTTSegment(p, opts...); err != nil {
+			err = fmt.Errorf("astisub: writing segment %s failed: %w", p, err)
+			return
+		}
+		paths = append(paths, p)
+	}
+	return
+}
+
+// writeWebVTTSegment writes a .vtt segment, which can be empty contrary to what WriteToWebVTT allows
+func (s Subtitles) writeWebVTTSegment(dst string, opts ...WriteToWebVTTOption) (err error) {
+	// Create the file
+	var f *os.File
+	if f, err = os.Create(dst); err != nil {
+		err = fmt.Errorf("astisub: creating %s failed: %w", dst, err)
+		return
+	}
+	defer f.Close()
+
+	// Write header only
+	if len(s.Items) == 0 {
+		wo := &WriteToWebVTTOptions{}
+		for _, opt := range opts {
+			opt(wo)
+		}
+		if _, err = f.Write(append(s.webvttHeader(wo), []byte("\n\n")...)); err != nil {
+			err = fmt.Errorf("astisub: writing failed: %w", err)
+		}
+		return
+	}
+
+	// Write content
+	err = s.WriteToWebVTT(f, opts...)
+	return
 }
 
 // WriteToWebVTT writes subtitles in .vtt format
-func (s Subtitles) WriteToWebVTT(o io.Writer) (err error) {
+func (s Subtitles) WriteToWebVTT(o io.Writer, opts ...WriteToWebVTTOption) (err error) {
+	// Create write options
+	wo := &WriteToWebVTTOptions{}
+	for _, opt := range opts {
+		opt(wo)
+	}
+
+	// Check empty cue mode
+	switch wo.EmptyCueMode {
+	case WebVTTEmptyCueModeKeep, WebVTTEmptyCueModeNBSP, WebVTTEmptyCueModeSkip:
+	default:
+		return fmt.Errorf("astisub: invalid webvtt empty cue mode %s", wo.EmptyCueMode)
+	}
+
 	// Do not write anything if no subtitles
 	if len(s.Items) == 0 {
 		err = ErrNoSubtitlesToWrite
@@ -468,17 +778,7 @@ func (s Subtitles) WriteToWebVTT(o io.Writer) (err error) {
 	}
 
 	// Add header
-	var c []byte
-	c = append(c, []byte("WEBVTT")...)
-
-	// Write X-TIMESTAMP-MAP if set
-	if s.Metadata != nil {
-		webVTTTimestampMap := s.Metadata.WebVTTTimestampMap
-		if webVTTTimestampMap != nil {
-			c = append(c, []byte("\n")...)
-			c = append(c, []byte(webVTTTimestampMap.String())...)
-		}
-	}
+	c := s.webvttHeader(wo)
 	c = append(c, []byte("\n\n")...)
 
 	var style []string
@@ -494,44 +794,51 @@ func (s Subtitles) WriteToWebVTT(o io.Writer) (err error) {
 
 	// Add regions
 	var k []string
-	for _, region := range s.Regions {
-		k = append(k, region.ID)
+	for id, region := range s.Regions {
+		if region != nil {
+			k = append(k, id)
+		}
 	}
 
 	sort.Strings(k)
 	for _, id := range k {
+		// Regions built programmatically may have no inline style
+		sa := s.Regions[id].InlineStyle
+		if sa == nil {
+			sa = &StyleAttributes{}
+		}
 		c = append(c, []byte("Region: id="+s.Regions[id].ID)...)
-		if s.Regions[id].InlineStyle.WebVTTLines != 0 {
+		if sa.WebVTTLines != 0 {
 			c = append(c, bytesSpace...)
-			c = append(c, []byte("lines="+strconv.Itoa(s.Regions[id].InlineStyle.WebVTTLines))...)
+			c = append(c, []byte("lines="+strconv.Itoa(sa.WebVTTLines))...)
 		} else if s.Regions[id].Style != nil && s.Regions[id].Style.InlineStyle != nil && s.Regions[id].Style.InlineStyle.WebVTTLines != 0 {
 			c = append(c, bytesSpace...)
 			c = append(c, []byte("lines="+strconv.Itoa(s.Regions[id].Style.InlineStyle.WebVTTLines))...)
 		}
-		if s.Regions[id].InlineStyle.WebVTTRegionAnchor != "" {
+		if sa.WebVTTRegionAnchor != "" {
 			c = append(c, bytesSpace...)
-			c = append(c, []byte("regionanchor="+s.Regions[id].InlineStyle.WebVTTRegionAnchor)...)
+			c = append(c, []byte("regionanchor="+sa.WebVTTRegionAnchor)...)
 		} else if s.Regions[id].Style != nil && s.Regions[id].Style.InlineStyle != nil && s.Regions[id].Style.InlineStyle.WebVTTRegionAnchor != "" {
 			c = append(c, bytesSpace...)
 			c = append(c, []byte("regionanchor="+s.Regions[id].Style.InlineStyle.WebVTTRegionAnchor)...)
 		}
-		if s.Regions[id].InlineStyle.WebVTTScroll != "" {
+		if sa.WebVTTScroll != "" {
 			c = append(c, bytesSpace...)
-			c = append(c, []byte("scroll="+s.Regions[id].InlineStyle.WebVTTScroll)...)
+			c = append(c, []byte("scroll="+sa.WebVTTScroll)...)
 		} else if s.Regions[id].Style != nil && s.Regions[id].Style.InlineStyle != nil && s.Regions[id].Style.InlineStyle.WebVTTScroll != "" {
 			c = append(c, bytesSpace...)
 			c = append(c, []byte("scroll="+s.Regions[id].Style.InlineStyle.WebVTTScroll)...)
 		}
-		if s.Regions[id].InlineStyle.WebVTTViewportAnchor != "" {
+		if sa.WebVTTViewportAnchor != "" {
 			c = append(c, bytesSpace...)
-			c = append(c, []byte("viewportanchor="+s.Regions[id].InlineStyle.WebVTTViewportAnchor)...)
+			c = append(c, []byte("viewportanchor="+sa.WebVTTViewportAnchor)...)
 		} else if s.Regions[id].Style != nil && s.Regions[id].Style.InlineStyle != nil && s.Regions[id].Style.InlineStyle.WebVTTViewportAnchor != "" {
 			c = append(c, bytesSpace...)
 			c = append(c, []byte("viewportanchor="+s.Regions[id].Style.InlineStyle.WebVTTViewportAnchor)...)
 		}
-		if s.Regions[id].InlineStyle.WebVTTWidth != "" {
+		if sa.WebVTTWidth != "" {
 			c = append(c, bytesSpace...)
-			c = append(c, []byte("width="+s.Regions[id].InlineStyle.WebVTTWidth)...)
+			c = append(c, []byte("width="+sa.WebVTTWidth)...)
 		} else if s.Regions[id].Style != nil && s.Regions[id].Style.InlineStyle != nil && s.Regions[id].Style.InlineStyle.WebVTTWidth != "" {
 			c = append(c, bytesSpace...)
 			c = append(c, []byte("width="+s.Regions[id].Style.InlineStyle.WebVTTWidth)...)
@@ -543,7 +850,14 @@ func (s Subtitles) WriteToWebVTT(o io.Writer) (err error) {
 	}
 
 	// Loop through subtitles
-	for index, item := range s.Items {
+	var index int
+	for _, item := range s.Items {
+		// Skip empty cues
+		if len(item.Lines) == 0 && wo.EmptyCueMode == WebVTTEmptyCueModeSkip {
+			continue
+		}
+		index++
+
 		// Add comments
 		if len(item.Comments) > 0 {
 			c = append(c, []byte("NOTE ")...)
@@ -555,11 +869,11 @@ func (s Subtitles) WriteToWebVTT(o io.Writer) (err error) {
 		}
 
 		// Add time boundaries
-		c = append(c, []byte(strconv.Itoa(index+1))...)
+		c = append(c, []byte(strconv.Itoa(index))...)
 		c = append(c, bytesLineSeparator...)
-		c = append(c, []byte(formatDurationWebVTT(item.StartAt))...)
+		c = append(c, []byte(formatCueDurationWebVTT(item.StartAt, wo.OmitHoursUnderOneHour))...)
 		c = append(c, bytesWebVTTTimeBoundariesSeparator...)
-		c = append(c, []byte(formatDurationWebVTT(item.EndAt))...)
+		c = append(c, []byte(formatCueDurationWebVTT(item.EndAt, wo.OmitHoursUnderOneHour))...)
 
 		// Add styles
 		if item.InlineStyle != nil {
@@ -609,7 +923,13 @@ func (s Subtitles) WriteToWebVTT(o io.Writer) (err error) {
 
 		// Loop through lines
 		for _, l := range item.Lines {
-			c = append(c, l.webVTTBytes()...)
+			c = append(c, l.webVTTBytes(wo.PreserveSpaces)...)
+		}
+
+		// Make sure empty cues have a payload
+		if len(item.Lines) == 0 && wo.EmptyCueMode == WebVTTEmptyCueModeNBSP {
+			c = append(c, []byte("&nbsp;")...)
+			c = append(c, bytesLineSeparator...)
 		}
 
 		// Add new line
@@ -617,7 +937,9 @@ func (s Subtitles) WriteToWebVTT(o io.Writer) (err error) {
 	}
 
 	// Remove last new line
-	c = c[:len(c)-1]
+	if len(c) > 0 {
+		c = c[:len(c)-1]
+	}
 
 	// Write
 	if _, err = o.Write(c); err != nil {
@@ -627,14 +949,14 @@ func (s Subtitles) WriteToWebVTT(o io.Writer) (err error) {
 	return
 }
 
-func (l Line) webVTTBytes() (c []byte) {
+func (l Line) webVTTBytes(preserveSpaces bool) (c []byte) {
 	if l.VoiceName != "" {
 		c = append(c, []byte("<v "+l.VoiceName+">")...)
 	}
 	for idx, li := range l.Items {
 		c = append(c, li.webVTTBytes()...)
 		// condition to avoid adding space as the last character.
-		if idx < len(l.Items)-1 {
+		if !preserveSpaces && idx < len(l.Items)-1 {
 			c = append(c, []byte(" ")...)
 		}
 	}
@@ -655,6 +977,9 @@ func (li LineItem) webVTTBytes() (c []byte) {
 	}
 
 	// Append
+	if li.Language != "" {
+		c = append(c, []byte("<"+webvttTagNameLang+" "+li.Language+">")...)
+	}
 	if color != "" {
 		c = append(c, []byte("<c."+color+">")...)
 	}
@@ -663,7 +988,7 @@ func (li LineItem) webVTTBytes() (c []byte) {
 			c = append(c, []byte(tag.startTag())...)
 		}
 	}
-	c = append(c, []byte(escapeHTML(li.Text))...)
+	c = append(c, []byte(escapeHTMLWebVTT(li.Text))...)
 	if li.InlineStyle != nil {
 		noTags := len(li.InlineStyle.WebVTTTags)
 		for i := noTags - 1; i >= 0; i-- {
@@ -673,6 +998,9 @@ func (li LineItem) webVTTBytes() (c []byte) {
 	if color != "" {
 		c = append(c, []byte("</c>")...)
 	}
+	if li.Language != "" {
+		c = append(c, []byte("</"+webvttTagNameLang+">")...)
+	}
 	return
 }
 
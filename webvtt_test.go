@@ -2,9 +2,14 @@ package astisub_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/asticode/go-astisub"
@@ -143,6 +148,19 @@ X-TIMESTAMP-MAP=LOCAL:00:00:00.000,MPEGTS:180000
 00:00:02.400 --> 00:00:03.633
 Evening.
 `, b.String())
+
+	// Offset and regenerate the timestamp map
+	s.Add(time.Second)
+	b.Reset()
+	err = s.WriteToWebVTT(b, astisub.WriteToWebVTTWithTimestampMapOption(90000))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(b.String(), "WEBVTT\nX-TIMESTAMP-MAP=LOCAL:00:00:00.000,MPEGTS:90000\n\n1\n00:00:01.933 --> "))
+
+	// Drop the timestamp map
+	b.Reset()
+	err = s.WriteToWebVTT(b, astisub.WriteToWebVTTWithoutTimestampMapOption())
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(b.String(), "WEBVTT\n\n1\n"))
 }
 
 func TestWebVTTTags(t *testing.T) {
@@ -248,3 +266,259 @@ func TestWebVTTParseDuration(t *testing.T) {
 	assert.NotNil(t, s.Items[1].InlineStyle)
 	assert.Equal(t, s.Items[1].InlineStyle.WebVTTAlign, "middle")
 }
+
+func TestWebVTTTabDelimitedTimeBoundaries(t *testing.T) {
+	s, err := astisub.ReadFromWebVTT(strings.NewReader("WEBVTT\n\n00:00:01.000\t-->\t00:00:02.000\tline:0\nTabs\n\n00:00:03.000  \t-->  00:00:04.000\nMixed"))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 2)
+	assert.Equal(t, time.Second, s.Items[0].StartAt)
+	assert.Equal(t, 2*time.Second, s.Items[0].EndAt)
+	assert.Equal(t, "0", s.Items[0].InlineStyle.WebVTTLine)
+	assert.Equal(t, "Tabs", s.Items[0].String())
+	assert.Equal(t, 3*time.Second, s.Items[1].StartAt)
+	assert.Equal(t, 4*time.Second, s.Items[1].EndAt)
+	assert.Equal(t, "Mixed", s.Items[1].String())
+}
+
+func TestWebVTTHeaderWithoutBlankLine(t *testing.T) {
+	for _, i := range []string{
+		"WEBVTT\nX-TIMESTAMP-MAP=MPEGTS:900000,LOCAL:00:00:00.000\n00:00:01.000 --> 00:00:02.000\nfirst\n\n00:00:03.000 --> 00:00:04.000\nsecond",
+		"WEBVTT\nX-TIMESTAMP-MAP=MPEGTS:900000,LOCAL:00:00:00.000\n1\n00:00:01.000 --> 00:00:02.000\nfirst\n\n2\n00:00:03.000 --> 00:00:04.000\nsecond",
+	} {
+		s, err := astisub.ReadFromWebVTT(strings.NewReader(i))
+		require.NoError(t, err)
+		require.Len(t, s.Items, 2)
+		assert.Equal(t, int64(900000), s.Metadata.WebVTTTimestampMap.MpegTS)
+		assert.Equal(t, time.Second, s.Items[0].StartAt)
+		assert.Equal(t, 2*time.Second, s.Items[0].EndAt)
+		assert.Equal(t, "first", s.Items[0].String())
+		assert.Equal(t, "second", s.Items[1].String())
+	}
+}
+
+func TestWebVTTKeepRawText(t *testing.T) {
+	testData := `WEBVTT
+
+00:00:01.000 --> 00:00:02.000
+<v Bob>Hello <b>world</b>
+Second line`
+
+	s, err := astisub.ReadFromWebVTTWithOptions(strings.NewReader(testData), astisub.WebVTTOptions{KeepRawText: true})
+	require.NoError(t, err)
+	require.Len(t, s.Items, 1)
+	assert.Equal(t, "<v Bob>Hello <b>world</b>\nSecond line", s.Items[0].Raw)
+}
+
+func TestWebVTTPreserveSpaces(t *testing.T) {
+	testData := `WEBVTT
+
+00:00:01.000 --> 00:00:02.000
+  Do   re&nbsp;&nbsp;<b>mi</b>  fa
+`
+
+	// Default
+	s, err := astisub.ReadFromWebVTT(strings.NewReader(testData))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 1)
+	assert.Equal(t, "Do   re\u00a0\u00a0 mi fa", s.Items[0].String())
+
+	// Preserve spaces
+	s, err = astisub.ReadFromWebVTTWithOptions(strings.NewReader(testData), astisub.WebVTTOptions{PreserveSpaces: true})
+	require.NoError(t, err)
+	require.Len(t, s.Items, 1)
+	require.Len(t, s.Items[0].Lines, 1)
+	require.Len(t, s.Items[0].Lines[0].Items, 3)
+	assert.Equal(t, "  Do   re\u00a0\u00a0", s.Items[0].Lines[0].Items[0].Text)
+	assert.Equal(t, "mi", s.Items[0].Lines[0].Items[1].Text)
+	assert.Equal(t, "  fa", s.Items[0].Lines[0].Items[2].Text)
+	w := &bytes.Buffer{}
+	err = s.WriteToWebVTT(w, astisub.WriteToWebVTTWithPreserveSpacesOption())
+	require.NoError(t, err)
+	assert.Equal(t, "WEBVTT\n\n1\n00:00:01.000 --> 00:00:02.000\n  Do   re&nbsp;&nbsp;<b>mi</b>  fa\n", w.String())
+}
+
+func TestWebVTTRegionBlock(t *testing.T) {
+	testData := `WEBVTT
+
+REGION
+id:fred
+width:40% lines:3
+regionanchor:0%,100%
+viewportanchor:10%,90%
+scroll:up
+
+00:00:01.000 --> 00:00:02.000 region:fred
+Hello`
+
+	s, err := astisub.ReadFromWebVTT(strings.NewReader(testData))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 1)
+	require.Contains(t, s.Regions, "fred")
+	r := s.Regions["fred"]
+	assert.Equal(t, r, s.Items[0].Region)
+	assert.Equal(t, "40%", r.InlineStyle.WebVTTWidth)
+	assert.Equal(t, 3, r.InlineStyle.WebVTTLines)
+	assert.Equal(t, "0%,100%", r.InlineStyle.WebVTTRegionAnchor)
+	assert.Equal(t, "10%,90%", r.InlineStyle.WebVTTViewportAnchor)
+	assert.Equal(t, "up", r.InlineStyle.WebVTTScroll)
+	assert.Equal(t, "Hello", s.Items[0].String())
+}
+
+func TestWebVTTContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := astisub.ReadFromWebVTTContext(ctx, strings.NewReader("WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nTest\n"), astisub.WebVTTOptions{})
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestWebVTTLanguage(t *testing.T) {
+	testData := `WEBVTT
+Language: fr
+
+00:00:01.000 --> 00:00:02.000
+<lang en>Hello</lang> <lang fr><i>Bonjour</i></lang>
+`
+	s, err := astisub.ReadFromWebVTT(strings.NewReader(testData))
+	require.NoError(t, err)
+	assert.Equal(t, astisub.LanguageFrench, s.Metadata.Language)
+	require.Len(t, s.Items, 1)
+	require.Len(t, s.Items[0].Lines, 1)
+	require.Len(t, s.Items[0].Lines[0].Items, 2)
+	assert.Equal(t, "en", s.Items[0].Lines[0].Items[0].Language)
+	assert.Nil(t, s.Items[0].Lines[0].Items[0].InlineStyle)
+	assert.Equal(t, "fr", s.Items[0].Lines[0].Items[1].Language)
+	assert.Equal(t, []astisub.WebVTTTag{{Name: "i"}}, s.Items[0].Lines[0].Items[1].InlineStyle.WebVTTTags)
+
+	b := &bytes.Buffer{}
+	err = s.WriteToWebVTT(b)
+	require.NoError(t, err)
+	assert.Equal(t, "WEBVTT\n\n1\n00:00:01.000 --> 00:00:02.000\n<lang en>Hello</lang> <lang fr><i>Bonjour</i></lang>\n", b.String())
+
+	b.Reset()
+	err = s.WriteToWebVTT(b, astisub.WriteToWebVTTWithLanguageOption())
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(b.String(), "WEBVTT\nLanguage: fr\n\n"))
+}
+
+func TestWebVTTCRLF(t *testing.T) {
+	// Reading one byte at a time makes sure \r and \n are not split into 2 line breaks
+	s, err := astisub.ReadFromWebVTTWithOptions(iotest.OneByteReader(strings.NewReader("WEBVTT\r\n\r\n00:00:01.000 --> 00:00:03.000\r\nFirst <00:00:02.000>line\r\nSecond line\r\n")), astisub.WebVTTOptions{PreserveSpaces: true})
+	require.NoError(t, err)
+	require.Len(t, s.Items, 1)
+	require.Len(t, s.Items[0].Lines, 2)
+	assert.Equal(t, "First ", s.Items[0].Lines[0].Items[0].Text)
+	assert.Equal(t, "line", s.Items[0].Lines[0].Items[1].Text)
+	assert.Equal(t, "Second line", s.Items[0].Lines[1].Items[0].Text)
+}
+
+func TestWebVTTOmitHoursUnderOneHour(t *testing.T) {
+	s := &astisub.Subtitles{Items: []*astisub.Item{
+		{EndAt: 2 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "1"}}}}, StartAt: time.Second},
+		{EndAt: time.Hour + time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "2"}}}}, StartAt: 59 * time.Minute},
+	}}
+	w := &bytes.Buffer{}
+	err := s.WriteToWebVTT(w, astisub.WriteToWebVTTWithOmitHoursUnderOneHourOption())
+	require.NoError(t, err)
+	assert.Equal(t, "WEBVTT\n\n1\n00:01.000 --> 00:02.000\n1\n\n2\n59:00.000 --> 01:00:01.000\n2\n", w.String())
+
+	// Read
+	s2, err := astisub.ReadFromWebVTT(bytes.NewReader(w.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, s.Items[1].StartAt, s2.Items[1].StartAt)
+	assert.Equal(t, s.Items[1].EndAt, s2.Items[1].EndAt)
+}
+
+func TestWebVTTEmptyCueMode(t *testing.T) {
+	s := &astisub.Subtitles{Items: []*astisub.Item{
+		{EndAt: 2 * time.Second, StartAt: time.Second},
+		{EndAt: 4 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "2"}}}}, StartAt: 3 * time.Second},
+	}}
+
+	// Keep
+	w := &bytes.Buffer{}
+	err := s.WriteToWebVTT(w)
+	require.NoError(t, err)
+	assert.Equal(t, "WEBVTT\n\n1\n00:00:01.000 --> 00:00:02.000\n\n2\n00:00:03.000 --> 00:00:04.000\n2\n", w.String())
+
+	// Nbsp
+	w.Reset()
+	err = s.WriteToWebVTT(w, astisub.WriteToWebVTTWithEmptyCueModeOption(astisub.WebVTTEmptyCueModeNBSP))
+	require.NoError(t, err)
+	assert.Equal(t, "WEBVTT\n\n1\n00:00:01.000 --> 00:00:02.000\n&nbsp;\n\n2\n00:00:03.000 --> 00:00:04.000\n2\n", w.String())
+
+	// Skip
+	w.Reset()
+	err = s.WriteToWebVTT(w, astisub.WriteToWebVTTWithEmptyCueModeOption(astisub.WebVTTEmptyCueModeSkip))
+	require.NoError(t, err)
+	assert.Equal(t, "WEBVTT\n\n1\n00:00:03.000 --> 00:00:04.000\n2\n", w.String())
+
+	// Invalid
+	err = s.WriteToWebVTT(&bytes.Buffer{}, astisub.WriteToWebVTTWithEmptyCueModeOption("invalid"))
+	assert.Error(t, err)
+}
+
+func TestWebVTTSegments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "astisub")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s := mockSubtitles()
+	s.Items = append(s.Items, &astisub.Item{EndAt: 14 * time.Second, Lines: []astisub.Line{{Items: []astisub.LineItem{{Text: "subtitle-3"}}}}, StartAt: 13 * time.Second})
+	ps, err := s.WriteToWebVTTSegments(dir, 4*time.Second, 900000)
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "segment0.vtt"), filepath.Join(dir, "segment1.vtt"), filepath.Join(dir, "segment2.vtt"), filepath.Join(dir, "segment3.vtt")}, ps)
+	for idx, e := range []string{
+		"WEBVTT\nX-TIMESTAMP-MAP=LOCAL:00:00:00.000,MPEGTS:900000\n\n1\n00:00:01.000 --> 00:00:03.000\nsubtitle-1\n\n2\n00:00:03.000 --> 00:00:04.000\nsubtitle-2\n",
+		"WEBVTT\nX-TIMESTAMP-MAP=LOCAL:00:00:00.000,MPEGTS:900000\n\n1\n00:00:04.000 --> 00:00:07.000\nsubtitle-2\n",
+		"WEBVTT\nX-TIMESTAMP-MAP=LOCAL:00:00:00.000,MPEGTS:900000\n\n",
+		"WEBVTT\nX-TIMESTAMP-MAP=LOCAL:00:00:00.000,MPEGTS:900000\n\n1\n00:00:13.000 --> 00:00:14.000\nsubtitle-3\n",
+	} {
+		b, err := ioutil.ReadFile(ps[idx])
+		require.NoError(t, err)
+		assert.Equal(t, e, string(b))
+	}
+
+	// Original subtitles are left untouched
+	assert.Len(t, s.Items, 3)
+	assert.Nil(t, s.Metadata)
+}
+
+func TestWebVTTMissingEndTime(t *testing.T) {
+	_, err := astisub.ReadFromWebVTT(strings.NewReader("WEBVTT\n\n00:01.000 -->\nHello\n"))
+	assert.EqualError(t, err, "astisub: line 3: time boundaries has no end time")
+}
+
+func TestWebVTTRegionWithoutInlineStyle(t *testing.T) {
+	r := &astisub.Region{ID: "r1"}
+	s := &astisub.Subtitles{
+		Items: []*astisub.Item{{
+			EndAt:       2 * time.Second,
+			InlineStyle: &astisub.StyleAttributes{},
+			Lines:       []astisub.Line{{Items: []astisub.LineItem{{Text: "text"}}}},
+			Region:      r,
+			StartAt:     time.Second,
+		}},
+		Regions: map[string]*astisub.Region{"r1": r},
+	}
+	w := &bytes.Buffer{}
+	require.NotPanics(t, func() { require.NoError(t, s.WriteToWebVTT(w)) })
+	assert.Contains(t, w.String(), "Region: id=r1\n")
+	assert.Contains(t, w.String(), "region:r1")
+}
+
+func TestWebVTTShortFractionTimings(t *testing.T) {
+	s, err := astisub.ReadFromWebVTT(strings.NewReader(`WEBVTT
+
+00:00.9 --> 00:01.93
+1 and 2 digits
+
+00:02.000 --> 00:00:03.5
+compact and full forms
+`))
+	require.NoError(t, err)
+	require.Len(t, s.Items, 2)
+	assert.Equal(t, 900*time.Millisecond, s.Items[0].StartAt)
+	assert.Equal(t, 1930*time.Millisecond, s.Items[0].EndAt)
+	assert.Equal(t, 2*time.Second, s.Items[1].StartAt)
+	assert.Equal(t, 3500*time.Millisecond, s.Items[1].EndAt)
+}